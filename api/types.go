@@ -0,0 +1,101 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api
+
+import (
+	"time"
+
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+// ErrorBody is the body of every failed response.
+type ErrorBody struct {
+	Code    errs.Code   `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// SessionClone is the body of the session clone.
+type SessionClone struct {
+	Name        string `json:"name"`
+	Description string `json:"descript"`
+}
+
+// TokenRequest is the body of the token creation, roles are keyed by project id or `*`.
+type TokenRequest struct {
+	Name  string            `json:"name"`
+	Roles map[string]string `json:"roles"`
+}
+
+// TokenResponse is the created token with its secret.
+type TokenResponse struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+// WorkloadPage is one page of the workloads, Count is the total of all pages.
+type WorkloadPage struct {
+	Count     int64                 `json:"count"`
+	Workloads []repository.Workload `json:"workloads"`
+}
+
+type WorkloadMetrics struct {
+	repository.Workload
+	Metrics []repository.Metrics
+	Labels  map[string]string `json:",omitempty"`
+}
+
+// MetricsMap returns the metrics values keyed by metric key.
+func (w WorkloadMetrics) MetricsMap() map[string]float64 {
+	m := make(map[string]float64, len(w.Metrics))
+	for _, v := range w.Metrics {
+		m[v.Key] = v.Value
+	}
+	return m
+}
+
+type WorkloadDiff struct {
+	Old     repository.Workload `json:"old"`
+	New     repository.Workload `json:"new"`
+	Config  []core.ConfigChange `json:"config"`
+	Metrics []core.MetricDelta  `json:"metrics"`
+}
+
+// MetricPoint is one value of the metrics, Index is the sequence of the run in its session to align sessions.
+type MetricPoint struct {
+	WID   uint      `json:"wid"`
+	Index int       `json:"index"`
+	Start time.Time `json:"start"`
+	Value float64   `json:"value"`
+}
+
+// SessionSeries is the metrics of one session keyed by metrics key.
+type SessionSeries struct {
+	SessionID uint                     `json:"session_id"`
+	Metrics   map[string][]MetricPoint `json:"metrics"`
+}
+
+// SearchHit is the matched workload with the values of the metric keys in the predicates and the sort.
+type SearchHit struct {
+	repository.Workload
+	Metrics map[string]float64 `json:",omitempty"`
+}
+
+// SearchPage is one page of the search, Next is the cursor of the next page and empty on the last page.
+type SearchPage struct {
+	Workloads []SearchHit `json:"workloads"`
+	Next      string      `json:"next,omitempty"`
+}
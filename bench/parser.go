@@ -0,0 +1,236 @@
+package bench
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/mattn/go-shellwords"
+)
+
+// OutputParser turns the stdout of a bench tool into metrics, latencies are in milliseconds.
+type OutputParser func(output []byte) (map[string]float64, error)
+
+var parsers = map[string]OutputParser{
+	"sysbench": parseSysbench,
+	"go-tpc":   parseTPC,
+	"go-ycsb":  parseYCSB,
+}
+
+// RegisterParser adds or replaces the parser of the tool.
+func RegisterParser(tool string, parser OutputParser) {
+	parsers[tool] = parser
+}
+
+// Tools returns the tools which have parsers.
+func Tools() []string {
+	tools := make([]string, 0, len(parsers))
+	for tool := range parsers {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	return tools
+}
+
+// DetectTool returns the tool of the bench command if it has a parser, otherwise empty.
+func DetectTool(cmd string) string {
+	words, err := shellwords.Parse(cmd)
+	if err != nil {
+		return ""
+	}
+	for _, word := range words {
+		if strings.Contains(word, "=") && !strings.Contains(word, "/") {
+			continue // environment assignments
+		}
+		if _, ok := parsers[filepath.Base(word)]; ok {
+			return filepath.Base(word)
+		}
+		return ""
+	}
+	return ""
+}
+
+// ParseOutput parses the stdout of the tool.
+func ParseOutput(tool string, output []byte) (map[string]float64, error) {
+	parser, ok := parsers[tool]
+	if !ok {
+		return nil, errs.InvalidArgument("tool %s has no parser, it must be one of %s", tool, strings.Join(Tools(), ", "))
+	}
+	return parser(output)
+}
+
+var (
+	sysbenchLine    = regexp.MustCompile(`^\s*([a-z0-9 ]+):\s+([0-9.]+)s?\s*(?:\(([0-9.]+) per sec\.\))?\s*$`)
+	sysbenchSection = regexp.MustCompile(`^(\S.*):\s*$`)
+	percentile      = regexp.MustCompile(`^([0-9.]+)th percentile$`)
+)
+
+// parseSysbench parses the final report of sysbench like:
+//
+//	transactions:                        100    (9.98 per sec.)
+//	95th percentile:                      200.47
+func parseSysbench(output []byte) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := sysbenchSection.FindStringSubmatch(line); m != nil {
+			section = m[1]
+			continue
+		}
+		m := sysbenchLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		switch name := strings.TrimSpace(m[1]); {
+		case name == "transactions" && m[3] != "":
+			metrics["sysbench_tps"], _ = strconv.ParseFloat(m[3], 64)
+		case name == "queries" && m[3] != "":
+			metrics["sysbench_qps"], _ = strconv.ParseFloat(m[3], 64)
+		case name == "ignored errors":
+			metrics["sysbench_errors"] = value
+		case name == "reconnects":
+			metrics["sysbench_reconnects"] = value
+		case name == "total time":
+			metrics["sysbench_time"] = value
+		case strings.HasPrefix(section, "Latency"):
+			if p := percentile.FindStringSubmatch(name); p != nil {
+				name = "p" + strings.Replace(p[1], ".", "_", 1)
+			}
+			if name != "sum" {
+				metrics["sysbench_latency_"+name] = value
+			}
+		}
+	}
+	if _, ok := metrics["sysbench_tps"]; !ok {
+		return nil, errs.InvalidArgument("no sysbench summary found in the output")
+	}
+	return metrics, nil
+}
+
+// parseTPC parses the summary of go-tpc tpcc like:
+//
+//	[Summary] NEW_ORDER - Takes(s): 59.9, Count: 20439, TPM: 20474.5, Avg(ms): 49.9, 99th(ms): 100.7
+//	tpmC: 20474.5, tpmTotal: 45481.8, efficiency: 159.2%
+func parseTPC(output []byte) (map[string]float64, error) {
+	metrics := map[string]float64{"tpcc_errors": 0}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[Summary] ") {
+			op, fields, err := parseOpLine(strings.TrimPrefix(line, "[Summary] "))
+			if err != nil {
+				return nil, err
+			}
+			if strings.HasSuffix(op, "_ERR") {
+				metrics["tpcc_errors"] += fields["count"]
+				continue
+			}
+			for k, v := range fields {
+				metrics["tpcc_"+strings.ToLower(op)+"_"+k] = v
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, "tpmC:") {
+			continue
+		}
+		for _, field := range strings.Split(line, ",") {
+			kv := strings.SplitN(field, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(kv[1]), "%"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s failed err:%v", field, err)
+			}
+			metrics["tpcc_"+strings.TrimSpace(kv[0])] = value
+		}
+	}
+	if _, ok := metrics["tpcc_tpmC"]; !ok {
+		return nil, errs.InvalidArgument("no go-tpc summary found in the output")
+	}
+	return metrics, nil
+}
+
+// parseYCSB parses the last statistics of every operation of go-ycsb like:
+//
+//	READ   - Takes(s): 10.0, Count: 99837, OPS: 9982.8, Avg(us): 378, Max(us): 15487, 99th(us): 876
+func parseYCSB(output []byte) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	errors := make(map[string]float64)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.Contains(line, " - Takes(s):") {
+			continue
+		}
+		op, fields, err := parseOpLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(op, "_ERROR") {
+			errors[op] = fields["count"]
+			continue
+		}
+		for k, v := range fields {
+			metrics["ycsb_"+strings.ToLower(op)+"_"+k] = v
+		}
+	}
+	if len(metrics) == 0 {
+		return nil, errs.InvalidArgument("no go-ycsb statistics found in the output")
+	}
+	metrics["ycsb_errors"] = 0
+	for _, count := range errors {
+		metrics["ycsb_errors"] += count
+	}
+	return metrics, nil
+}
+
+var opField = regexp.MustCompile(`^([A-Za-z0-9.]+)(?:\((s|ms|us)\))?$`)
+
+// parseOpLine parses the line of go-tpc and go-ycsb like `OP - Takes(s): 10.0, Count: 10, 99th(us): 876`,
+// the keys are lower case like count, ops, avg and p99, latencies are converted to milliseconds.
+func parseOpLine(line string) (string, map[string]float64, error) {
+	parts := strings.SplitN(line, " - ", 2)
+	if len(parts) != 2 {
+		return "", nil, errs.InvalidArgument("%q is not a operation statistics", line)
+	}
+	fields := make(map[string]float64)
+	for _, field := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(field, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		m := opField.FindStringSubmatch(strings.TrimSpace(kv[0]))
+		if m == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+		if err != nil {
+			return "", nil, errs.InvalidArgument("parse %q failed: %v", field, err)
+		}
+		key := strings.ToLower(m[1])
+		switch {
+		case key == "takes" || key == "sum":
+			continue
+		case strings.HasSuffix(key, "th"):
+			key = "p" + strings.Replace(strings.TrimSuffix(key, "th"), ".", "_", 1)
+		}
+		if m[2] == "us" {
+			value /= 1000
+		}
+		fields[key] = value
+	}
+	return strings.TrimSpace(parts[0]), fields, nil
+}
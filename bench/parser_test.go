@@ -0,0 +1,52 @@
+package bench
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the parsers")
+
+func TestParseOutputGolden(t *testing.T) {
+	as := assert.New(t)
+	files, err := filepath.Glob("testdata/*.out")
+	as.Nil(err)
+	as.Len(files, len(Tools()))
+	for _, file := range files {
+		tool := strings.TrimSuffix(filepath.Base(file), ".out")
+		output, err := ioutil.ReadFile(file)
+		as.Nil(err)
+		metrics, err := ParseOutput(tool, output)
+		as.Nil(err, tool)
+		actual, err := json.MarshalIndent(metrics, "", "  ")
+		as.Nil(err)
+
+		golden := strings.TrimSuffix(file, ".out") + ".golden"
+		if *update {
+			as.Nil(ioutil.WriteFile(golden, append(actual, '\n'), 0644))
+		}
+		expected, err := ioutil.ReadFile(golden)
+		as.Nil(err)
+		as.JSONEq(string(expected), string(actual), tool)
+
+		_, err = ParseOutput(tool, []byte("connection refused\n"))
+		as.NotNil(err, tool)
+	}
+	_, err = ParseOutput("tiup-bench", nil)
+	as.NotNil(err)
+}
+
+func TestDetectTool(t *testing.T) {
+	as := assert.New(t)
+	as.Equal("sysbench", DetectTool("sysbench --config-file=/go/config oltp_read_write --time=1200 run"))
+	as.Equal("go-tpc", DetectTool("/bin/go-tpc tpcc --warehouses 100 run"))
+	as.Equal("go-ycsb", DetectTool("GOMAXPROCS=4 go-ycsb run tikv -P /ycsb/workloads/workloada"))
+	as.Equal("", DetectTool("mysql -e 'select 1'"))
+	as.Equal("", DetectTool("echo 'sysbench"))
+}
@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gopkg.in/yaml.v2"
+)
+
+// Plan is the workloads of a bench executed in order.
+type Plan struct {
+	Name   string            `yaml:"name"`   // bench name the records are reported as
+	Labels map[string]string `yaml:"labels"` // labels of every record
+	Shell  string            `yaml:"shell"`  // shell running the commands with -c, default is sh
+	Dir    string            `yaml:"dir"`    // working directory of the commands
+	Env    []string          `yaml:"env"`    // extra environment of the commands like KEY=value
+	// Warmup and Cooldown are the defaults of the workloads.
+	Warmup    time.Duration `yaml:"warmup"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+	Workloads []Workload    `yaml:"workloads"`
+}
+
+// Workload is one bench command of the plan.
+type Workload struct {
+	Name   string            `yaml:"name"`
+	Cmd    string            `yaml:"cmd"`
+	Labels map[string]string `yaml:"labels"` // labels of the record, override the plan labels
+	// Tool parses the stdout into the metrics of the record, it is detected from the command if empty.
+	Tool string `yaml:"tool"`
+	// Warmup is excluded from the head of the record window, so the ramp up of the workload is not analyzed.
+	Warmup *time.Duration `yaml:"warmup"`
+	// Cooldown is waited after the workload exits, so the metrics settle before the next workload.
+	Cooldown *time.Duration `yaml:"cooldown"`
+}
+
+// ReadPlan reads and validates the yaml plan.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlan(data)
+}
+
+// ParsePlan parses and validates the yaml plan.
+func ParsePlan(data []byte) (*Plan, error) {
+	plan := &Plan{}
+	if err := yaml.UnmarshalStrict(data, plan); err != nil {
+		return nil, errs.InvalidArgument("parse plan failed: %v", err)
+	}
+	if err := plan.validate(); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (p *Plan) validate() error {
+	if len(p.Workloads) == 0 {
+		return errs.InvalidArgument("plan has no workloads")
+	}
+	if p.Warmup < 0 || p.Cooldown < 0 {
+		return errs.InvalidArgument("warmup and cooldown must not be negative")
+	}
+	names := make(map[string]struct{}, len(p.Workloads))
+	for i, w := range p.Workloads {
+		if w.Name == "" || w.Cmd == "" {
+			return errs.InvalidArgument("workload %d must have name and cmd", i)
+		}
+		if _, ok := names[w.Name]; ok {
+			return errs.InvalidArgument("workload %s is duplicated", w.Name)
+		}
+		names[w.Name] = struct{}{}
+		if _, ok := parsers[w.Tool]; w.Tool != "" && !ok {
+			return errs.InvalidArgument("tool %s of workload %s has no parser", w.Tool, w.Name)
+		}
+		if (w.Warmup != nil && *w.Warmup < 0) || (w.Cooldown != nil && *w.Cooldown < 0) {
+			return errs.InvalidArgument("warmup and cooldown of workload %s must not be negative", w.Name)
+		}
+	}
+	return nil
+}
+
+func (p *Plan) shell() string {
+	if p.Shell == "" {
+		return "sh"
+	}
+	return p.Shell
+}
+
+func (p *Plan) warmup(w *Workload) time.Duration {
+	if w.Warmup != nil {
+		return *w.Warmup
+	}
+	return p.Warmup
+}
+
+func (p *Plan) cooldown(w *Workload) time.Duration {
+	if w.Cooldown != nil {
+		return *w.Cooldown
+	}
+	return p.Cooldown
+}
+
+func (p *Plan) labels(w *Workload) map[string]string {
+	if len(p.Labels) == 0 && len(w.Labels) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(p.Labels)+len(w.Labels))
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	for k, v := range w.Labels {
+		labels[k] = v
+	}
+	return labels
+}
@@ -0,0 +1,163 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+// Runner executes the workloads of the plan in order and records their windows.
+type Runner struct {
+	plan *Plan
+	// Log receives the progress and the stdout and stderr of the commands, nil discards them.
+	Log io.Writer
+	// OutDir saves the stdout of every workload as <workload>.out if it is not empty.
+	OutDir string
+	// Record receives the record of every workload as soon as it finishes, an error stops the run.
+	Record func(repository.Record) error
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func NewRunner(plan *Plan) *Runner {
+	return &Runner{plan: plan, Log: ioutil.Discard, now: time.Now, sleep: sleep}
+}
+
+// Run returns the records of the finished workloads, it stops at the first failed workload.
+func (r *Runner) Run(ctx context.Context) ([]repository.Record, error) {
+	if r.OutDir != "" {
+		if err := os.MkdirAll(r.OutDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	records := make([]repository.Record, 0, len(r.plan.Workloads))
+	for i := range r.plan.Workloads {
+		w := &r.plan.Workloads[i]
+		if i > 0 {
+			if err := r.sleep(ctx, r.plan.cooldown(&r.plan.Workloads[i-1])); err != nil {
+				return records, err
+			}
+		}
+		fmt.Fprintf(r.Log, "[%d/%d] run workload %s: %s\n", i+1, len(r.plan.Workloads), w.Name, w.Cmd)
+		record, err := r.runWorkload(ctx, w)
+		if err != nil {
+			return records, err
+		}
+		if r.Record != nil {
+			if err := r.Record(record); err != nil {
+				return records, err
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (r *Runner) runWorkload(ctx context.Context, w *Workload) (repository.Record, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(r.plan.shell(), "-c", w.Cmd)
+	// the bench tools started by the shell are in its process group, which is killed on the cancellation
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Dir = r.plan.Dir
+	cmd.Env = append(os.Environ(), r.plan.Env...)
+	log := &lockedWriter{w: r.Log}
+	cmd.Stdout = io.MultiWriter(&stdout, log)
+	cmd.Stderr = log
+
+	start := r.now()
+	err := run(ctx, cmd)
+	end := r.now()
+	if err != nil {
+		return repository.Record{}, fmt.Errorf("workload %s failed err:%v", w.Name, err)
+	}
+	if r.OutDir != "" {
+		if err := ioutil.WriteFile(filepath.Join(r.OutDir, w.Name+".out"), stdout.Bytes(), 0644); err != nil {
+			return repository.Record{}, err
+		}
+	}
+	elapsed := end.Sub(start)
+	fmt.Fprintf(r.Log, "workload %s finished in %v\n", w.Name, elapsed)
+	warmup := r.plan.warmup(w)
+	if elapsed <= warmup {
+		return repository.Record{}, fmt.Errorf("workload %s ran %v, not longer than the warmup %v", w.Name, elapsed, warmup)
+	}
+	start = start.Add(warmup)
+	record := repository.Record{
+		Workload: w.Name,
+		Start:    strconv.FormatInt(start.Unix(), 10),
+		End:      strconv.FormatInt(end.Unix(), 10),
+		Cmd:      w.Cmd,
+		Labels:   r.plan.labels(w),
+	}
+	tool := w.Tool
+	if tool == "" {
+		tool = DetectTool(w.Cmd)
+	}
+	if tool != "" {
+		// the bench finished, so the unexpected output is only warned
+		if record.Metrics, err = ParseOutput(tool, stdout.Bytes()); err != nil {
+			fmt.Fprintf(r.Log, "parse %s output of workload %s failed err:%v\n", tool, w.Name, err)
+		}
+	}
+	return record, nil
+}
+
+// run runs the command and kills its process group on the cancellation of the context.
+func run(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// lockedWriter serializes the writes of the stdout and stderr of the command.
+type lockedWriter struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+	return l.w.Write(p)
+}
+
+// sleep waits d or the cancellation of the context.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
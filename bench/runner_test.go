@@ -0,0 +1,149 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlan(t *testing.T) {
+	as := assert.New(t)
+	plan, err := ParsePlan([]byte(`
+name: hot
+labels: {pd: v5.3}
+warmup: 1m
+workloads:
+  - name: write
+    cmd: sysbench oltp_write_only run
+    labels: {pd: v5.4, tables: "16"}
+  - name: read
+    cmd: sysbench oltp_read_only run
+    warmup: 0s
+    cooldown: 30s
+`))
+	as.Nil(err)
+	as.Equal(time.Minute, plan.warmup(&plan.Workloads[0]))
+	as.Equal(time.Duration(0), plan.warmup(&plan.Workloads[1]))
+	as.Equal(30*time.Second, plan.cooldown(&plan.Workloads[1]))
+	as.Equal(map[string]string{"pd": "v5.4", "tables": "16"}, plan.labels(&plan.Workloads[0]))
+	as.Equal("sh", plan.shell())
+
+	for _, data := range []string{
+		`workloads: []`,
+		`workloads: [{name: a}]`,
+		`workloads: [{name: a, cmd: x}, {name: a, cmd: y}]`,
+		`workloads: [{name: a, cmd: x, cooldown: -1s}]`,
+		`workload: [{name: a, cmd: x}]`,
+	} {
+		_, err = ParsePlan([]byte(data))
+		as.NotNil(err, data)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	as := assert.New(t)
+	plan, err := ParsePlan([]byte(`
+name: stub
+labels: {pd: v5.3}
+env: [GREETING=hello]
+warmup: 10s
+cooldown: 5s
+workloads:
+  - name: first
+    cmd: echo $GREETING first
+  - name: second
+    cmd: echo second; echo warn >&2
+    warmup: 0s
+  - name: failed
+    cmd: exit 3
+  - name: skipped
+    cmd: echo skipped
+`))
+	as.Nil(err)
+
+	clock := time.Unix(1634479813, 0)
+	var sleeps []time.Duration
+	var log bytes.Buffer
+	runner := NewRunner(plan)
+	runner.Log = &log
+	runner.OutDir = filepath.Join(t.TempDir(), "out")
+	runner.now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	runner.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+
+	var recorded []string
+	runner.Record = func(record repository.Record) error {
+		recorded = append(recorded, record.Workload)
+		return nil
+	}
+	records, err := runner.Run(context.Background())
+	as.NotNil(err)
+	as.Equal([]string{"first", "second"}, recorded)
+	as.Contains(err.Error(), "workload failed failed")
+	as.Len(records, 2)
+	as.Equal("first", records[0].Workload)
+	as.Equal("1634479883", records[0].Start)
+	as.Equal("1634479933", records[0].End)
+	as.Equal(map[string]string{"pd": "v5.3"}, records[0].Labels)
+	as.Equal("1634479993", records[1].Start)
+	as.Equal("echo second; echo warn >&2", records[1].Cmd)
+	as.Equal([]time.Duration{5 * time.Second, 5 * time.Second}, sleeps)
+	as.Contains(log.String(), "hello first\n")
+	as.Contains(log.String(), "warn\n")
+	as.NotContains(log.String(), "skipped")
+
+	out, err := ioutil.ReadFile(filepath.Join(runner.OutDir, "second.out"))
+	as.Nil(err)
+	as.Equal("second\n", string(out))
+
+	plan, err = ParsePlan([]byte(`
+workloads:
+  - {name: sysbench, cmd: cat testdata/sysbench.out, tool: sysbench}
+  - {name: detected, cmd: sysbench --help || true}
+`))
+	as.Nil(err)
+	log.Reset()
+	runner = NewRunner(plan)
+	runner.Log = &log
+	runner.sleep = func(context.Context, time.Duration) error { return nil }
+	records, err = runner.Run(context.Background())
+	as.Nil(err)
+	as.Equal(1214.85, records[0].Metrics["sysbench_tps"])
+	as.Nil(records[1].Metrics)
+	as.Contains(log.String(), "parse sysbench output of workload detected failed")
+
+	plan.Warmup = time.Hour
+	plan.Workloads = plan.Workloads[:1]
+	_, err = NewRunner(plan).Run(context.Background())
+	as.NotNil(err)
+	as.Contains(err.Error(), "not longer than the warmup")
+}
+
+func TestRunnerCancel(t *testing.T) {
+	as := assert.New(t)
+	plan, err := ParsePlan([]byte(`
+workloads:
+  - {name: orphan, cmd: sleep 30 & sleep 30}
+`))
+	as.Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// the background sleep holds the stdout, so the run only returns if the process group is killed.
+	records, err := NewRunner(plan).Run(ctx)
+	as.NotNil(err)
+	as.Contains(err.Error(), context.DeadlineExceeded.Error())
+	as.Empty(records)
+	as.Less(time.Since(start), 10*time.Second)
+}
@@ -0,0 +1,221 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+// WorkloadQuery filters the workloads of the session, zero page and size use the server defaults.
+type WorkloadQuery struct {
+	Workload string
+	Version  string
+	Page     int
+	Size     int
+	Labels   []string
+}
+
+func (c *Client) GetWorkloads(sessionID uint, q WorkloadQuery) (api.WorkloadPage, error) {
+	query := url.Values{"label": q.Labels}
+	if q.Workload != "" {
+		query.Set("workload", q.Workload)
+	}
+	if q.Version != "" {
+		query.Set("version", q.Version)
+	}
+	if q.Page > 0 {
+		query.Set("page", strconv.Itoa(q.Page))
+	}
+	if q.Size > 0 {
+		query.Set("size", strconv.Itoa(q.Size))
+	}
+	var page api.WorkloadPage
+	err := c.call(http.MethodGet, "/analyze/workload/"+id(sessionID), query, nil, &page)
+	return page, err
+}
+
+// SearchQuery filters, sorts and pages the workloads, zero fields are not filtered and zero time is unbounded.
+type SearchQuery struct {
+	SessionIDs []uint
+	ProjectID  uint
+	Workload   string
+	Bench      string
+	Version    string
+	Cmd        string
+	CmdRegexp  string
+	From       time.Time
+	To         time.Time
+	Labels     []string
+	Metrics    []string // predicates like tikv_cpu_std/avg>0.3
+	Sort       string
+	Asc        bool
+	Limit      int
+	Cursor     string
+}
+
+// SearchWorkloads returns one page of the matched workloads, pass the Next of the page as Cursor for the next page.
+func (c *Client) SearchWorkloads(q SearchQuery) (api.SearchPage, error) {
+	query := url.Values{"session_id": ids(q.SessionIDs), "label": q.Labels, "metric": q.Metrics}
+	for k, v := range map[string]string{"workload": q.Workload, "bench": q.Bench, "version": q.Version, "cmd": q.Cmd,
+		"cmd_regexp": q.CmdRegexp, "sort": q.Sort, "cursor": q.Cursor} {
+		if v != "" {
+			query.Set(k, v)
+		}
+	}
+	if q.ProjectID > 0 {
+		query.Set("project_id", id(q.ProjectID))
+	}
+	if !q.From.IsZero() {
+		query.Set("from", strconv.FormatInt(q.From.Unix(), 10))
+	}
+	if !q.To.IsZero() {
+		query.Set("to", strconv.FormatInt(q.To.Unix(), 10))
+	}
+	if q.Asc {
+		query.Set("order", "asc")
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	var page api.SearchPage
+	err := c.call(http.MethodGet, "/analyze/search", query, nil, &page)
+	return page, err
+}
+
+func (c *Client) GetWorkloadNames(sessionID uint) ([]repository.Workload, error) {
+	var loads []repository.Workload
+	err := c.call(http.MethodGet, "/analyze/config/"+id(sessionID), nil, nil, &loads)
+	return loads, err
+}
+
+// GetBench returns the workloads of the bench with metrics and labels, labels are selectors like key=value.
+func (c *Client) GetBench(sessionID uint, name string, labels []string) ([]api.WorkloadMetrics, error) {
+	var result []api.WorkloadMetrics
+	err := c.call(http.MethodGet, "/analyze/bench/"+id(sessionID)+"/"+url.PathEscape(name), url.Values{"label": labels}, nil, &result)
+	return result, err
+}
+
+// ExportBench returns the pivot table of the bench in csv, md or html, it must be closed by the caller.
+// The delta versus the baseline bench is included if baseline is not empty.
+func (c *Client) ExportBench(sessionID uint, name, format, baseline string, labels []string) (io.ReadCloser, error) {
+	query := url.Values{"format": {format}, "label": labels}
+	if baseline != "" {
+		query.Set("baseline", baseline)
+	}
+	rsp, err := c.do(http.MethodGet, "/analyze/bench/"+id(sessionID)+"/"+url.PathEscape(name)+"/export", query, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// GetMetrics returns the last metrics of the workload keyed by metrics key, zero limit uses the server default.
+func (c *Client) GetMetrics(sessionID uint, workload string, limit int, metrics []string) (map[string][]repository.Metrics, error) {
+	query := url.Values{"workload": {workload}, "metrics": metrics}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var result map[string][]repository.Metrics
+	err := c.call(http.MethodGet, "/analyze/metrics/"+id(sessionID), query, nil, &result)
+	return result, err
+}
+
+// GetWorkload returns the workload with its metrics and labels.
+func (c *Client) GetWorkload(workloadID uint) (api.WorkloadMetrics, error) {
+	var load api.WorkloadMetrics
+	err := c.call(http.MethodGet, "/analyze/detail/"+id(workloadID), nil, nil, &load)
+	return load, err
+}
+
+// GetBenches returns the benches of the session ordered by start time.
+func (c *Client) GetBenches(sessionID uint) ([]repository.BenchSummary, error) {
+	var benches []repository.BenchSummary
+	err := c.call(http.MethodGet, "/analyze/benches/"+id(sessionID), nil, nil, &benches)
+	return benches, err
+}
+
+func (c *Client) DiffWorkloads(workloadID, otherID uint) (api.WorkloadDiff, error) {
+	var diff api.WorkloadDiff
+	err := c.call(http.MethodGet, "/analyze/diff/"+id(workloadID)+"/"+id(otherID), nil, nil, &diff)
+	return diff, err
+}
+
+// GetSeries returns the stored raw series of the workload, empty names returns all.
+func (c *Client) GetSeries(workloadID uint, names []string) ([]repository.Series, error) {
+	var series []repository.Series
+	err := c.call(http.MethodGet, "/analyze/series/"+id(workloadID), url.Values{"name": names}, nil, &series)
+	return series, err
+}
+
+// MetricsQuery selects the metrics of the workload across the sessions, zero time is unbounded.
+type MetricsQuery struct {
+	SessionIDs []uint
+	ProjectID  uint
+	Workload   string
+	Metrics    []string
+	Start      time.Time
+	End        time.Time
+}
+
+func (c *Client) QueryMetrics(q MetricsQuery) ([]api.SessionSeries, error) {
+	query := url.Values{"session_id": ids(q.SessionIDs), "workload": {q.Workload}, "metrics": q.Metrics}
+	if q.ProjectID > 0 {
+		query.Set("project_id", id(q.ProjectID))
+	}
+	if !q.Start.IsZero() {
+		query.Set("start", strconv.FormatInt(q.Start.Unix(), 10))
+	}
+	if !q.End.IsZero() {
+		query.Set("end", strconv.FormatInt(q.End.Unix(), 10))
+	}
+	var result []api.SessionSeries
+	err := c.call(http.MethodGet, "/analyze/query", query, nil, &result)
+	return result, err
+}
+
+// Evaluate evaluates the checker expression over the stored series name of the workload.
+func (c *Client) Evaluate(workloadID uint, name, expr string) (json.RawMessage, error) {
+	var result json.RawMessage
+	err := c.call(http.MethodGet, "/analyze/evaluate/"+id(workloadID), url.Values{"name": {name}, "expr": {expr}}, nil, &result)
+	return result, err
+}
+
+func (c *Client) SetBaseline(sessionID uint, benchName string, baseline bool) error {
+	method := http.MethodPost
+	if !baseline {
+		method = http.MethodDelete
+	}
+	return c.call(method, "/analyze/baseline/"+id(sessionID)+"/"+url.PathEscape(benchName), nil, nil, nil)
+}
+
+func (c *Client) DeleteWorkload(workloadID uint) error {
+	return c.call(http.MethodDelete, "/analyze/workload/"+id(workloadID), nil, nil, nil)
+}
+
+func (c *Client) DeleteWorkloadByName(sessionID uint, name string) error {
+	return c.call(http.MethodDelete, "/analyze/session/"+id(sessionID), url.Values{"workload_name": {name}}, nil, nil)
+}
+
+// SaveRecords saves the records of the bench, labels are like key=value.
+func (c *Client) SaveRecords(sessionID uint, benchName string, records []repository.Record, labels []string) error {
+	return c.call(http.MethodPost, "/tools/"+id(sessionID)+"/"+url.PathEscape(benchName), url.Values{"label": labels}, records, nil)
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
+)
+
+// Client is the typed client of the analyze server api, failed responses are returned as *errs.Error.
+type Client struct {
+	addr       string
+	token      string
+	httpClient *http.Client
+}
+
+type Option func(*Client)
+
+// WithToken attaches the api token to every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func NewClient(addr string, opts ...Option) *Client {
+	c := &Client{
+		addr:       strings.TrimSuffix(addr, "/"),
+		httpClient: &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do sends the request, the body of the successful response must be closed by the caller.
+func (c *Client) do(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode/100 != 2 {
+		defer rsp.Body.Close()
+		return nil, decodeError(rsp)
+	}
+	return rsp, nil
+}
+
+// decodeError converts the error body into the typed error, the raw body is the message if it is not json.
+func decodeError(rsp *http.Response) error {
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return err
+	}
+	var e api.ErrorBody
+	if err := json.Unmarshal(body, &e); err != nil || e.Code == "" {
+		return &errs.Error{
+			Code:    errs.CodeInternal,
+			Message: fmt.Sprintf("response is not ok code:%d body:%s", rsp.StatusCode, body),
+		}
+	}
+	return &errs.Error{Code: e.Code, Message: e.Message, Details: e.Details}
+}
+
+// call sends the request with the json body if in is not nil and decodes the json response into out if it is not nil.
+func (c *Client) call(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	}
+	rsp, err := c.do(method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, rsp.Body)
+		return err
+	}
+	return decodeJSON(rsp.Body, out)
+}
+
+func decodeJSON(body io.Reader, out interface{}) error {
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("response is not json err:%v", err)
+	}
+	return nil
+}
+
+func id(v uint) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+func ids(v []uint) []string {
+	result := make([]string, len(v))
+	for i := range v {
+		result[i] = id(v[i])
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveRecords(t *testing.T) {
+	as := assert.New(t)
+	var records []repository.Record
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal(http.MethodPost, r.Method)
+		as.Equal("/tools/3/bench a", r.URL.Path)
+		as.Equal([]string{"env=ci", "os=linux"}, r.URL.Query()["label"])
+		as.Equal("Bearer secret", r.Header.Get("Authorization"))
+		as.Nil(json.NewDecoder(r.Body).Decode(&records))
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL+"/", WithToken("secret"))
+	err := c.SaveRecords(3, "bench a", []repository.Record{{Workload: "w1"}}, []string{"env=ci", "os=linux"})
+	as.Nil(err)
+	as.Len(records, 1)
+	as.Equal("w1", records[0].Workload)
+}
+
+func TestError(t *testing.T) {
+	as := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/project/session/1" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not_found","message":"session 1 not found"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("bad gateway"))
+	}))
+	defer ts.Close()
+
+	c := NewClient(ts.URL)
+	_, err := c.GetSession(1)
+	var e *errs.Error
+	as.True(errors.As(err, &e))
+	as.Equal(errs.CodeNotFound, e.Code)
+	as.Equal("session 1 not found", e.Message)
+
+	_, err = c.GetProjects()
+	as.True(errors.As(err, &e))
+	as.Equal(errs.CodeInternal, e.Code)
+	as.Contains(e.Message, "bad gateway")
+}
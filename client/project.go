@@ -0,0 +1,162 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+func (c *Client) GetProjects() ([]repository.Project, error) {
+	var projects []repository.Project
+	err := c.call(http.MethodGet, "/project/", nil, nil, &projects)
+	return projects, err
+}
+
+func (c *Client) NewProject(name, description string) (repository.Project, error) {
+	project := repository.Project{Name: name, Description: description}
+	err := c.call(http.MethodPost, "/project/new", nil, project, &project)
+	return project, err
+}
+
+func (c *Client) GetProject(projectID uint) (repository.Project, error) {
+	var project repository.Project
+	err := c.call(http.MethodGet, "/project/"+id(projectID), nil, nil, &project)
+	return project, err
+}
+
+// UpdateProject renames or updates the description of the project.
+func (c *Client) UpdateProject(project repository.Project) (repository.Project, error) {
+	err := c.call(http.MethodPut, "/project/"+id(project.ID), nil, project, &project)
+	return project, err
+}
+
+// DeleteProject deletes the project with its sessions, workloads, retention and webhooks.
+func (c *Client) DeleteProject(projectID uint) error {
+	return c.call(http.MethodDelete, "/project/"+id(projectID), nil, nil, nil)
+}
+
+func (c *Client) NewSession(session repository.Session) (repository.Session, error) {
+	err := c.call(http.MethodPost, "/project/session/new", nil, session, &session)
+	return session, err
+}
+
+// SaveSession replaces the fields of the session, the project of the session can not be changed.
+func (c *Client) SaveSession(session repository.Session) (repository.Session, error) {
+	err := c.call(http.MethodPut, "/project/session/"+id(session.ID), nil, session, &session)
+	return session, err
+}
+
+// CloneSession copies the addresses, objectives and dashboards of the session under the new name, empty description keeps the source's.
+func (c *Client) CloneSession(sessionID uint, name, description string) (repository.Session, error) {
+	var session repository.Session
+	err := c.call(http.MethodPost, "/project/session/"+id(sessionID)+"/clone", nil, api.SessionClone{Name: name, Description: description}, &session)
+	return session, err
+}
+
+func (c *Client) UpdateSession(sessionID uint, name, targetObject string, objects []string) error {
+	query := url.Values{"name": {name}, "target_object": {targetObject}, "objects": objects}
+	return c.call(http.MethodPost, "/project/session/"+id(sessionID), query, nil, nil)
+}
+
+func (c *Client) GetSessions(projectID uint) ([]repository.Session, error) {
+	var sessions []repository.Session
+	err := c.call(http.MethodGet, "/project/sessions/"+id(projectID), nil, nil, &sessions)
+	return sessions, err
+}
+
+func (c *Client) GetSession(sessionID uint) (repository.Session, error) {
+	var session repository.Session
+	err := c.call(http.MethodGet, "/project/session/"+id(sessionID), nil, nil, &session)
+	return session, err
+}
+
+func (c *Client) DeleteSession(sessionID uint) error {
+	return c.call(http.MethodDelete, "/project/session/"+id(sessionID), nil, nil, nil)
+}
+
+func (c *Client) GetRetention(projectID uint) (repository.Retention, error) {
+	var retention repository.Retention
+	err := c.call(http.MethodGet, "/project/retention/"+id(projectID), nil, nil, &retention)
+	return retention, err
+}
+
+func (c *Client) SaveRetention(projectID uint, retention repository.Retention) error {
+	return c.call(http.MethodPost, "/project/retention/"+id(projectID), nil, retention, nil)
+}
+
+// ExportProject returns the archive stream of the project, it must be closed by the caller.
+func (c *Client) ExportProject(projectID uint, gzip bool) (io.ReadCloser, error) {
+	format := "json"
+	if gzip {
+		format = "gzip"
+	}
+	rsp, err := c.do(http.MethodGet, "/project/"+id(projectID)+"/export", url.Values{"format": {format}}, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return rsp.Body, nil
+}
+
+// ImportProject imports the json or gzip'd json archive, conflict is skip, overwrite or rename.
+func (c *Client) ImportProject(archive io.Reader, conflict string) (repository.Project, error) {
+	var project repository.Project
+	rsp, err := c.do(http.MethodPost, "/project/import", url.Values{"conflict": {conflict}}, "application/octet-stream", archive)
+	if err != nil {
+		return project, err
+	}
+	defer rsp.Body.Close()
+	err = decodeJSON(rsp.Body, &project)
+	return project, err
+}
+
+// CreateToken creates the db-backed token, roles are keyed by project id or `*`.
+func (c *Client) CreateToken(name string, roles map[string]string) (api.TokenResponse, error) {
+	var token api.TokenResponse
+	err := c.call(http.MethodPost, "/auth/token", nil, api.TokenRequest{Name: name, Roles: roles}, &token)
+	return token, err
+}
+
+func (c *Client) DeleteToken(name string) error {
+	return c.call(http.MethodDelete, "/auth/token/"+url.PathEscape(name), nil, nil, nil)
+}
+
+func (c *Client) GetWebhooks(projectID uint) ([]repository.Webhook, error) {
+	var webhooks []repository.Webhook
+	err := c.call(http.MethodGet, "/project/webhook/"+id(projectID), nil, nil, &webhooks)
+	return webhooks, err
+}
+
+// SaveWebhook creates the webhook or updates it if the id is set, the secret is not returned.
+func (c *Client) SaveWebhook(projectID uint, webhook repository.Webhook) (repository.Webhook, error) {
+	var saved repository.Webhook
+	err := c.call(http.MethodPost, "/project/webhook/"+id(projectID), nil, webhook, &saved)
+	return saved, err
+}
+
+func (c *Client) DeleteWebhook(projectID, webhookID uint) error {
+	return c.call(http.MethodDelete, "/project/webhook/"+id(projectID)+"/"+id(webhookID), nil, nil, nil)
+}
+
+func (c *Client) GetDeliveries(projectID, webhookID uint, limit int) ([]repository.WebhookDelivery, error) {
+	var deliveries []repository.WebhookDelivery
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	err := c.call(http.MethodGet, "/project/webhook/"+id(projectID)+"/"+id(webhookID)+"/deliveries", query, nil, &deliveries)
+	return deliveries, err
+}
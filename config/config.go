@@ -14,12 +14,37 @@
 package config
 
 import (
-	"flag"
+	"time"
 )
 
+// Config is the config of the server, the toml keys are the flags of the start command
+// which are layered by Layers.
 type Config struct {
-	ListenAddress     string `json:"listen_address" toml:"listen_port"`
+	ListenAddress     string `json:"listen_address" toml:"listen_address"`
 	PrometheusAddress string `json:"prometheus_address" toml:"prometheus_address"`
 	StorageAddress    string `json:"storage_address" toml:"storage_address"`
-	flagSet           *flag.FlagSet
+	// ArchiveDirectory is where the runs expired by retention are exported to.
+	ArchiveDirectory string `json:"archive_directory" toml:"archive_directory"`
+	// RetentionInterval is the interval of the retention janitor, zero disables it.
+	RetentionInterval time.Duration `json:"retention_interval" toml:"retention_interval"`
+	// TokenFile is the json file of the static api tokens.
+	TokenFile string `json:"token_file" toml:"token_file"`
+	// TokenDB enables the api tokens stored in the database.
+	TokenDB bool `json:"token_db" toml:"token_db"`
+	// AllowOrigins is the CORS allowlist, empty allows any origin.
+	AllowOrigins []string `json:"allow_origins" toml:"cors_origins"`
+	// ReadTimeout and WriteTimeout bound every request but the live streams, ShutdownTimeout bounds the drain of the
+	// in-flight requests.
+	ReadTimeout     time.Duration `json:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    time.Duration `json:"write_timeout" toml:"write_timeout"`
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" toml:"shutdown_timeout"`
+	// DrainDelay is how long the readiness probe fails before the listener closes on shutdown.
+	DrainDelay time.Duration `json:"drain_delay" toml:"drain_delay"`
+	// WebhookRetries is the retries of the failed webhook deliveries.
+	WebhookRetries int `json:"webhook_retries" toml:"webhook_retries"`
+	// RegressionThreshold is the ratio of the metric delta versus baseline reported as regression.
+	RegressionThreshold float64 `json:"regression_threshold" toml:"regression_threshold"`
+	// ProxyTimeout bounds every proxied request, ProxyMaxBodySize bounds its request and response body.
+	ProxyTimeout     time.Duration `json:"proxy_timeout" toml:"proxy_timeout"`
+	ProxyMaxBodySize int64         `json:"proxy_max_body_size" toml:"proxy_max_body_size"`
 }
@@ -0,0 +1,166 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix is the prefix of the environment variables of the flags, e.g. ANALYZE_STORAGE_ADDRESS.
+const EnvPrefix = "ANALYZE_"
+
+// Source is the layer the effective value of a flag comes from.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Layers are the config file and the environment variables under the command line flags.
+// The keys of the file are the flag names, the top level keys apply to every command
+// and the keys of the table named by the command path, e.g. [start] or [project.export], override them.
+type Layers struct {
+	Path   string
+	file   map[string]interface{}
+	lookup func(string) (string, bool)
+}
+
+// Load reads the toml config file, empty path means no file.
+func Load(path string) (*Layers, error) {
+	l := &Layers{Path: path, file: make(map[string]interface{}), lookup: os.LookupEnv}
+	if path == "" {
+		return l, nil
+	}
+	if _, err := toml.DecodeFile(path, &l.file); err != nil {
+		return nil, fmt.Errorf("read config %s failed err:%v", path, err)
+	}
+	return l, nil
+}
+
+// EnvName returns the environment variable of the flag.
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.Replace(flag, "-", "_", -1))
+}
+
+// ScopedEnvName returns the environment variable of the flag of the command path, e.g. ANALYZE_WORKLOAD_LIST_VERSION,
+// it overrides the one of EnvName.
+func ScopedEnvName(path []string, flag string) string {
+	return EnvName(strings.Join(append(append([]string{}, path...), flag), "_"))
+}
+
+// Apply sets the flags not set in the command line from the environment variables or the file,
+// path is the command path without the root, the sources of all flags are returned.
+func (l *Layers) Apply(flags *pflag.FlagSet, path []string) (map[string]Source, error) {
+	sources := make(map[string]Source)
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil {
+			return
+		}
+		switch {
+		case f.Changed:
+			sources[f.Name] = SourceFlag
+		case l.setEnv(f, path, &err):
+			sources[f.Name] = SourceEnv
+		case l.setFile(f, path, &err):
+			sources[f.Name] = SourceFile
+		default:
+			sources[f.Name] = SourceDefault
+		}
+	})
+	return sources, err
+}
+
+// setEnv sets the flag from the scoped environment variable, or from the unscoped one if its value fits the flag,
+// because the flags of different commands may share the name but not the type, e.g. version.
+func (l *Layers) setEnv(f *pflag.Flag, path []string, err *error) bool {
+	if len(path) > 0 {
+		name := ScopedEnvName(path, f.Name)
+		if v, ok := l.lookup(name); ok {
+			if e := set(f, v); e != nil {
+				*err = fmt.Errorf("invalid %s %q err:%v", name, v, e)
+			}
+			return true
+		}
+	}
+	v, ok := l.lookup(EnvName(f.Name))
+	return ok && set(f, v) == nil
+}
+
+// set replaces the value of the flag, the slice flags append on every Set after the first.
+func set(f *pflag.Flag, values ...string) error {
+	if slice, ok := f.Value.(pflag.SliceValue); ok {
+		if err := slice.Replace([]string{}); err != nil {
+			return err
+		}
+	}
+	for _, v := range values {
+		if err := f.Value.Set(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Layers) setFile(f *pflag.Flag, path []string, err *error) bool {
+	v, ok := l.value(f.Name, path)
+	if !ok {
+		return false
+	}
+	items, isArray := v.([]interface{})
+	if !isArray {
+		items = []interface{}{v}
+	}
+	values := make([]string, len(items))
+	for i, item := range items {
+		values[i] = fmt.Sprint(item)
+	}
+	if e := set(f, values...); e != nil {
+		*err = fmt.Errorf("invalid %s = %v in %s err:%v", f.Name, v, l.Path, e)
+	}
+	return true
+}
+
+// value returns the value of the key in the deepest table of the command path.
+func (l *Layers) value(key string, path []string) (interface{}, bool) {
+	table := l.file
+	value, ok := scalar(table, key)
+	for _, name := range path {
+		next, isTable := table[name].(map[string]interface{})
+		if !isTable {
+			break
+		}
+		table = next
+		if v, found := scalar(table, key); found {
+			value, ok = v, true
+		}
+	}
+	return value, ok
+}
+
+func scalar(table map[string]interface{}, key string) (interface{}, bool) {
+	v, ok := table[key]
+	if _, isTable := v.(map[string]interface{}); isTable {
+		return nil, false
+	}
+	return v, ok
+}
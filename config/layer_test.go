@@ -0,0 +1,101 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayers(t *testing.T) {
+	as := assert.New(t)
+	path := filepath.Join(t.TempDir(), "analyze.toml")
+	as.NoError(ioutil.WriteFile(path, []byte(`
+server = "http://file"
+listen_address = "top"
+[start]
+listen_address = "start"
+cors_origins = ["a", "b"]
+[project.export]
+server = "http://export"
+`), 0644))
+	l, err := Load(path)
+	as.NoError(err)
+	env := map[string]string{"ANALYZE_TOKEN": "env", "ANALYZE_STORAGE_ADDRESS": "env:3306"}
+	l.lookup = func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	flags := pflag.NewFlagSet("start", pflag.ContinueOnError)
+	flags.String("listen_address", "default", "")
+	flags.String("storage_address", "default", "")
+	flags.String("prometheus_address", "default", "")
+	flags.String("token", "", "")
+	flags.StringSlice("cors_origins", nil, "")
+	as.NoError(flags.Parse([]string{"--token", "flag"}))
+	sources, err := l.Apply(flags, []string{"start"})
+	as.NoError(err)
+	as.Equal(map[string]Source{"listen_address": SourceFile, "storage_address": SourceEnv, "prometheus_address": SourceDefault,
+		"token": SourceFlag, "cors_origins": SourceFile}, sources)
+	as.Equal("start", getString(flags, "listen_address"))
+	as.Equal("env:3306", getString(flags, "storage_address"))
+	as.Equal("default", getString(flags, "prometheus_address"))
+	as.Equal("flag", getString(flags, "token"))
+	origins, _ := flags.GetStringSlice("cors_origins")
+	as.Equal([]string{"a", "b"}, origins)
+
+	// the deepest table of the command path wins
+	for expect, path := range map[string][]string{"http://export": {"project", "export"}, "http://file": {"project", "list"}} {
+		flags := pflag.NewFlagSet("project", pflag.ContinueOnError)
+		flags.String("server", "default", "")
+		_, err := l.Apply(flags, path)
+		as.NoError(err)
+		as.Equal(expect, getString(flags, "server"))
+	}
+
+	// applying again replaces the slices instead of appending
+	_, err = l.Apply(flags, []string{"start"})
+	as.NoError(err)
+	origins, _ = flags.GetStringSlice("cors_origins")
+	as.Equal([]string{"a", "b"}, origins)
+
+	// the unscoped variable is skipped by the flag of another type sharing the name, the scoped one is strict
+	env["ANALYZE_VERSION"] = "v5.0.0"
+	root := pflag.NewFlagSet("pd-analyze", pflag.ContinueOnError)
+	root.Bool("version", false, "")
+	sources, err = l.Apply(root, nil)
+	as.NoError(err)
+	as.Equal(SourceDefault, sources["version"])
+	list := pflag.NewFlagSet("list", pflag.ContinueOnError)
+	list.String("version", "", "")
+	sources, err = l.Apply(list, []string{"workload", "list"})
+	as.NoError(err)
+	as.Equal(SourceEnv, sources["version"])
+	as.Equal("v5.0.0", getString(list, "version"))
+	env["ANALYZE_WORKLOAD_LIST_VERSION"] = "v5.1.0"
+	_, err = l.Apply(list, []string{"workload", "list"})
+	as.NoError(err)
+	as.Equal("v5.1.0", getString(list, "version"))
+	env["ANALYZE_VERSION"] = "true"
+	_, err = l.Apply(root, nil)
+	as.NoError(err)
+	v, _ := root.GetBool("version")
+	as.True(v)
+
+	flags = pflag.NewFlagSet("start", pflag.ContinueOnError)
+	flags.Int("webhook_retries", 3, "")
+	env["ANALYZE_START_WEBHOOK_RETRIES"] = "x"
+	_, err = l.Apply(flags, []string{"start"})
+	as.Error(err)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.toml"))
+	as.Error(err)
+}
+
+func getString(flags *pflag.FlagSet, name string) string {
+	v, _ := flags.GetString(name)
+	return v
+}
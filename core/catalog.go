@@ -0,0 +1,66 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// Catalog is the prometheus queries summarized for every workload keyed by metric name.
+var Catalog = map[string]string{
+	// tikv metrics
+	"tikv_cpu": "sum(rate(tikv_thread_cpu_seconds_total{}[1m])) by (instance)",
+
+	// pd metrics
+	"store_write_rate_bytes": "pd_scheduler_store_status{ type=\"store_write_rate_bytes\"}",
+	"store_write_rate_keys":  "pd_scheduler_store_status{type=\"store_write_rate_keys\"}",
+	"store_write_query":      "pd_scheduler_store_status{type=\"store_write_query_rate\"}",
+
+	"store_read_rate_bytes": "pd_scheduler_store_status{ type=\"store_read_rate_bytes\"}",
+	"store_read_rate_keys":  "pd_scheduler_store_status{type=\"store_read_rate_keys\"}",
+	"store_read_query":      "pd_scheduler_store_status{type=\"store_read_query_rate\"}",
+
+	//tidb
+	"tidb_duration_P999": "histogram_quantile(0.999, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
+	"tidb_duration_P99":  "histogram_quantile(0.99, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
+	"tidb_duration_P95":  "histogram_quantile(0.95, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
+	"tidb_duration_P80":  "histogram_quantile(0.80, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
+
+	"tidb_command_per_second": "sum(rate(tidb_server_query_total{}[1m])) by (result)",
+}
+
+// Summarize applies the mean of every metric in the window, the instances of tikv and pd metrics are also
+// summarized as `<name>_avg`, `<name>_std` and `<name>_std/avg` to show the balance.
+// The values which are not a number, e.g. the mean of no series, are left out.
+func Summarize(parser Parser, catalog map[string]string, start, end string) (map[string]float64, error) {
+	result := make(map[string]float64)
+	set := func(key string, value float64) {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			result[key] = value
+		}
+	}
+	for name, metrics := range catalog {
+		d, err := parser.Apply(start, end, name, metrics, fmt.Sprintf("mean(%s)", name))
+		if err != nil {
+			return nil, err
+		}
+		data, ok := d.([]float64)
+		if !ok {
+			return nil, fmt.Errorf("mean of %s is not numbers", name)
+		}
+
+		mean, std := stat.MeanStdDev(data, nil)
+		if strings.HasPrefix(name, "tidb") {
+			set(name, mean)
+		} else {
+			set(strings.Join([]string{name, "avg"}, "_"), mean)
+			set(strings.Join([]string{name, "std"}, "_"), std)
+			if mean != 0 {
+				set(strings.Join([]string{name, "std/avg"}, "_"), std/mean)
+			}
+		}
+	}
+	return result, nil
+}
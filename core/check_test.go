@@ -20,7 +20,7 @@ func (m *mockSource) Source(metrics, start, end string) (data [][]float64, err e
 func TestMean(t *testing.T) {
 	as := assert.New(t)
 	c := NewChecker(&mockSource{})
-	r, err := c.Apply("1630381080", "1630386080", "store_available", "pd_scheduler_store_status{type='store_available'}", "max(mean(%s))")
+	r, err := c.Apply("1630381080", "1630386080", "store_available", "pd_scheduler_store_status{type='store_available'}", "max(mean(store_available))")
 	as.Nil(err)
-	as.Equal(float64(4), r)
+	as.Equal(2.5, r)
 }
@@ -1,9 +1,16 @@
 package core
 
+import (
+	"time"
+)
+
 type Source interface {
 	Source(metrics, start, end string) (data [][]float64, err error)
 }
 
+// QueryHook observes the query of the source, err is nil if the query succeeds.
+type QueryHook func(query string, duration time.Duration, err error)
+
 type Parser interface {
 	Apply(start, end string, name, metrics, cmd string) (v interface{}, err error)
 }
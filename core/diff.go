@@ -0,0 +1,171 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type ChangeType string
+
+const (
+	Added   ChangeType = "added"
+	Removed ChangeType = "removed"
+	Changed ChangeType = "changed"
+)
+
+// ConfigChange is one difference between two config snapshots, Path is the dotted key path.
+type ConfigChange struct {
+	Path string      `json:"path"`
+	Type ChangeType  `json:"type"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+// MetricDelta is the difference of one metric key between two workloads.
+type MetricDelta struct {
+	Key   string  `json:"key"`
+	Old   float64 `json:"old"`
+	New   float64 `json:"new"`
+	Delta float64 `json:"delta"`
+	Ratio float64 `json:"ratio"`
+}
+
+// DiffConfig returns the structural differences between two json config snapshots.
+func DiffConfig(old, new string) ([]ConfigChange, error) {
+	o, err := decodeConfig(old)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeConfig(new)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]ConfigChange, 0)
+	diffValue("", o, n, &changes)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// DiffMetrics returns the deltas of the metrics keys, keys only exist in one side will be ignored.
+func DiffMetrics(old, new map[string]float64) []MetricDelta {
+	deltas := make([]MetricDelta, 0, len(new))
+	for k, n := range new {
+		o, ok := old[k]
+		if !ok {
+			continue
+		}
+		d := MetricDelta{Key: k, Old: o, New: n, Delta: n - o}
+		if o != 0 {
+			d.Ratio = (n - o) / o
+		}
+		deltas = append(deltas, d)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Key < deltas[j].Key
+	})
+	return deltas
+}
+
+// higherIsBetter are the metrics keys whose increase is an improvement, the other keys like the latencies,
+// errors, cpu and the std of the instances are better when lower.
+var higherIsBetter = map[string]bool{
+	"sysbench_tps":            true,
+	"sysbench_qps":            true,
+	"tpcc_tpmC":               true,
+	"tpcc_tpmTotal":           true,
+	"tpcc_efficiency":         true,
+	"tidb_command_per_second": true,
+}
+
+// higherIsBetterFields are the fields of the go-tpc and go-ycsb operations whose increase is an improvement,
+// like tpcc_new_order_tpm or ycsb_read_ops.
+var higherIsBetterFields = map[string]bool{
+	"tpm":   true,
+	"ops":   true,
+	"count": true,
+}
+
+// HigherIsBetter returns true if the increase of the metric is an improvement, e.g. sysbench_qps or tpcc_tpmC.
+func HigherIsBetter(key string) bool {
+	if higherIsBetter[key] {
+		return true
+	}
+	if !strings.HasPrefix(key, "tpcc_") && !strings.HasPrefix(key, "ycsb_") {
+		return false
+	}
+	tokens := strings.Split(strings.ToLower(key), "_")
+	// the errors of the operations like ycsb_read_error_count are better when lower.
+	for _, t := range tokens {
+		if strings.HasPrefix(t, "err") || strings.HasPrefix(t, "fail") {
+			return false
+		}
+	}
+	return higherIsBetterFields[tokens[len(tokens)-1]]
+}
+
+func decodeConfig(config string) (interface{}, error) {
+	if strings.TrimSpace(config) == "" {
+		return map[string]interface{}{}, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(config), &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffValue(path string, old, new interface{}, changes *[]ConfigChange) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		n, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, ov := range o {
+			nv, ok := n[k]
+			if !ok {
+				*changes = append(*changes, ConfigChange{Path: joinPath(path, k), Type: Removed, Old: ov})
+				continue
+			}
+			diffValue(joinPath(path, k), ov, nv, changes)
+		}
+		for k, nv := range n {
+			if _, ok := o[k]; !ok {
+				*changes = append(*changes, ConfigChange{Path: joinPath(path, k), Type: Added, New: nv})
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(n):
+				*changes = append(*changes, ConfigChange{Path: p, Type: Removed, Old: o[i]})
+			case i >= len(o):
+				*changes = append(*changes, ConfigChange{Path: p, Type: Added, New: n[i]})
+			default:
+				diffValue(p, o[i], n[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, ConfigChange{Path: path, Type: Changed, Old: old, New: new})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfig(t *testing.T) {
+	as := assert.New(t)
+	old := `{"schedule":{"leader-schedule-limit":4,"region-schedule-limit":2048},"labels":["zone"],"version":"v5.2"}`
+	new := `{"schedule":{"leader-schedule-limit":8,"hot-regions-write-limit":16},"labels":["zone","host"],"version":"v5.2"}`
+	changes, err := DiffConfig(old, new)
+	as.Nil(err)
+	as.Equal([]ConfigChange{
+		{Path: "labels[1]", Type: Added, New: "host"},
+		{Path: "schedule.hot-regions-write-limit", Type: Added, New: float64(16)},
+		{Path: "schedule.leader-schedule-limit", Type: Changed, Old: float64(4), New: float64(8)},
+		{Path: "schedule.region-schedule-limit", Type: Removed, Old: float64(2048)},
+	}, changes)
+
+	changes, err = DiffConfig("", `{"a":1}`)
+	as.Nil(err)
+	as.Equal([]ConfigChange{{Path: "a", Type: Added, New: float64(1)}}, changes)
+
+	_, err = DiffConfig("{", "")
+	as.NotNil(err)
+}
+
+func TestDiffMetrics(t *testing.T) {
+	as := assert.New(t)
+	deltas := DiffMetrics(map[string]float64{"a": 2, "b": 0, "c": 1}, map[string]float64{"a": 3, "b": 1, "d": 1})
+	as.Equal([]MetricDelta{
+		{Key: "a", Old: 2, New: 3, Delta: 1, Ratio: 0.5},
+		{Key: "b", Old: 0, New: 1, Delta: 1},
+	}, deltas)
+}
+
+func TestHigherIsBetter(t *testing.T) {
+	as := assert.New(t)
+	for _, key := range []string{"sysbench_tps", "sysbench_qps", "tpcc_tpmC", "tpcc_efficiency", "tpcc_new_order_tpm",
+		"tpcc_payment_count", "ycsb_read_ops", "ycsb_read_count", "tidb_command_per_second"} {
+		as.True(HigherIsBetter(key), key)
+	}
+	// the unknown keys are better when lower, so a new error metric is never an improvement when it increases.
+	for _, key := range []string{"sysbench_latency_p95", "sysbench_errors", "sysbench_reconnects", "tpcc_new_order_p99",
+		"tpcc_errors", "ycsb_errors", "ycsb_read_avg", "ycsb_read_error_count", "tpcc_new_order_failed_count",
+		"sysbench_error_rate", "tidb_query_error_rate", "tidb_duration_P99", "tikv_cpu_avg", "tikv_cpu_std/avg",
+		"store_write_rate_bytes_std", "store_read_query_std/avg", "unknown"} {
+		as.False(HigherIsBetter(key), key)
+	}
+}
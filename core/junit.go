@@ -0,0 +1,59 @@
+package core
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the results as a junit xml test suite, every rule of every workload is a test case.
+func WriteJUnit(w io.Writer, name string, results []RuleResult) error {
+	suite := junitSuite{Name: name, Tests: len(results), Cases: make([]junitCase, 0, len(results))}
+	for _, r := range results {
+		c := junitCase{Name: r.Rule, Classname: r.Workload}
+		switch {
+		case r.Err != nil:
+			suite.Errors++
+			c.Error = &junitMessage{Message: r.Err.Error(), Text: r.Expr}
+		case !r.Passed:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: fmt.Sprintf("%g does not satisfy the threshold %g", r.Value, r.Threshold), Text: r.Expr}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strconv"
@@ -25,6 +26,7 @@ type Prometheus struct {
 	Address string
 	Step    string
 	client  http.Client
+	hook    QueryHook
 }
 
 func NewPrometheus(address string) *Prometheus {
@@ -61,15 +63,61 @@ func (p *Prometheus) Source(metrics, start, end string) (data [][]float64, err e
 
 // Get returns values from prometheus
 func (p *Prometheus) Get(metrics, _, end string) (values *PrometheusData, err error) {
-	req, err := http.NewRequest(http.MethodGet, p.Address+prefix, nil)
+	start, err := addDuration(end, duration)
 	if err != nil {
 		return nil, err
 	}
+	return p.query(metrics, start, end, step)
+}
 
-	start, err := addDuration(end, duration)
+// Range returns the values of the whole window, downsampled to at most points samples per series.
+func (p *Prometheus) Range(metrics, start, end string, points int) (values *PrometheusData, err error) {
+	s, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	e, err := strconv.ParseInt(end, 10, 64)
 	if err != nil {
 		return nil, err
 	}
+	stepSeconds := int64(15)
+	if points > 0 && (e-s)/int64(points) > stepSeconds {
+		stepSeconds = (e - s) / int64(points)
+	}
+	return p.query(metrics, start, end, fmt.Sprintf("%ds", stepSeconds))
+}
+
+// RangeSource is the source of the whole window downsampled to at most Points samples per series, while the
+// Source of Prometheus only queries the last minutes of the window.
+type RangeSource struct {
+	*Prometheus
+	Points int
+}
+
+func (s RangeSource) Source(metrics, start, end string) ([][]float64, error) {
+	values, err := s.Range(metrics, start, end, s.Points)
+	if err != nil {
+		return nil, err
+	}
+	return values.ToArray(), nil
+}
+
+// SetHook sets the hook called after every query.
+func (p *Prometheus) SetHook(hook QueryHook) {
+	p.hook = hook
+}
+
+func (p *Prometheus) query(metrics, start, end, step string) (values *PrometheusData, err error) {
+	if p.hook != nil {
+		defer func(begin time.Time) {
+			p.hook(metrics, time.Since(begin), err)
+		}(time.Now())
+	}
+	req, err := http.NewRequest(http.MethodGet, p.Address+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	q := req.URL.Query()
 	q.Add("query", metrics)
 	q.Add("start", start)
@@ -94,7 +142,7 @@ func (p *Prometheus) Get(metrics, _, end string) (values *PrometheusData, err er
 		return
 	}
 	if data.Status == fail {
-		return
+		return nil, errs.Result_Not_Match
 	}
 	return &data.Data, nil
 }
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusHook(t *testing.T) {
+	as := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") == "bad" {
+			w.Write([]byte(`{"status":"error"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1,"2"]]}]}}`))
+	}))
+	defer ts.Close()
+
+	var queries []string
+	var failed int
+	p := NewPrometheus(ts.URL)
+	p.SetHook(func(query string, _ time.Duration, err error) {
+		queries = append(queries, query)
+		if err != nil {
+			failed++
+		}
+	})
+	data, err := p.Source("up", "100", "200")
+	as.Nil(err)
+	as.Equal([][]float64{{2}}, data)
+	_, err = p.Source("bad", "100", "200")
+	as.NotNil(err)
+	as.Equal([]string{"up", "bad"}, queries)
+	as.Equal(1, failed)
+}
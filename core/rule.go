@@ -0,0 +1,305 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/bufferflies/pd-analyze/errs"
+	"gopkg.in/yaml.v2"
+)
+
+// BaselineVar is the value of the left side of the rule in the baseline workload.
+const BaselineVar = "baseline"
+
+// RuleSet is the rules a bench must pass.
+type RuleSet struct {
+	Baseline string `yaml:"baseline"` // bench name compared by the rules using baseline
+	Rules    []Rule `yaml:"rules"`
+}
+
+// Rule compares a checker expression or a metrics key of the workload with a threshold, like
+// `mean(tidb_duration_P99) < 50` or `store_write_rate_bytes_std/avg <= baseline * 1.1`.
+type Rule struct {
+	Name      string   `yaml:"name"`
+	Expr      string   `yaml:"expr"`
+	Workloads []string `yaml:"workloads"` // empty means all workloads
+
+	op          string
+	value       *govaluate.EvaluableExpression
+	threshold   *govaluate.EvaluableExpression
+	useBaseline bool
+}
+
+// Window is the workload the rules evaluate.
+type Window struct {
+	Workload string
+	Start    string
+	End      string
+	Metrics  map[string]float64 // summary of the workload keyed like record metrics
+}
+
+// RuleResult is the result of a rule in a workload, Err is set if the rule can not be evaluated.
+type RuleResult struct {
+	Rule      string
+	Expr      string
+	Workload  string
+	Value     float64
+	Threshold float64
+	Passed    bool
+	Err       error
+}
+
+// ParseRules parses and compiles the yaml rules.
+func ParseRules(data []byte) (*RuleSet, error) {
+	set := &RuleSet{}
+	if err := yaml.UnmarshalStrict(data, set); err != nil {
+		return nil, errs.InvalidArgument("parse rules failed: %v", err)
+	}
+	if len(set.Rules) == 0 {
+		return nil, errs.InvalidArgument("no rules")
+	}
+	for i := range set.Rules {
+		rule := &set.Rules[i]
+		if rule.Name == "" {
+			rule.Name = rule.Expr
+		}
+		if err := rule.compile(); err != nil {
+			return nil, errs.InvalidArgument("rule %s: %v", rule.Name, err)
+		}
+	}
+	return set, nil
+}
+
+// UseBaseline returns true if any rule compares with the baseline.
+func (s *RuleSet) UseBaseline() bool {
+	for _, r := range s.Rules {
+		if r.useBaseline {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	comparators = []string{"<=", ">=", "==", "!=", "<", ">"}
+	metricsKey  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./]*$`)
+)
+
+func (r *Rule) compile() error {
+	left, op, right, err := splitComparison(r.Expr)
+	if err != nil {
+		return err
+	}
+	// keys like store_write_rate_bytes_std/avg are escaped as a variable
+	if metricsKey.MatchString(left) {
+		left = "[" + left + "]"
+	}
+	if r.value, err = govaluate.NewEvaluableExpressionWithFunctions(left, ExpressionMap); err != nil {
+		return err
+	}
+	for _, v := range r.value.Vars() {
+		if v == BaselineVar {
+			return fmt.Errorf("baseline must be on the right side")
+		}
+	}
+	if r.threshold, err = govaluate.NewEvaluableExpressionWithFunctions(right, ExpressionMap); err != nil {
+		return err
+	}
+	for _, v := range r.threshold.Vars() {
+		if v != BaselineVar {
+			return fmt.Errorf("threshold can only use baseline, but got %s", v)
+		}
+		r.useBaseline = true
+	}
+	r.op = op
+	return nil
+}
+
+// splitComparison splits the expression at the only comparison outside the parentheses and brackets.
+func splitComparison(expr string) (left, op, right string, err error) {
+	depth, at := 0, -1
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '(', '[':
+			depth++
+			continue
+		case ')', ']':
+			depth--
+			continue
+		}
+		if depth != 0 {
+			continue
+		}
+		for _, c := range comparators {
+			if strings.HasPrefix(expr[i:], c) {
+				if at >= 0 {
+					return "", "", "", fmt.Errorf("%q has more than one comparison", expr)
+				}
+				at, op = i, c
+				i += len(c) - 1
+				break
+			}
+		}
+	}
+	if at < 0 {
+		return "", "", "", fmt.Errorf("%q has no comparison like <, <=, >, >=, == or !=", expr)
+	}
+	left, right = strings.TrimSpace(expr[:at]), strings.TrimSpace(expr[at+len(op):])
+	if left == "" || right == "" {
+		return "", "", "", fmt.Errorf("%q must have both sides of the comparison", expr)
+	}
+	return left, op, right, nil
+}
+
+func (r *Rule) match(workload string) bool {
+	if len(r.Workloads) == 0 {
+		return true
+	}
+	for _, w := range r.Workloads {
+		if w == workload {
+			return true
+		}
+	}
+	return false
+}
+
+// Check evaluates the rules in every window, baselines are the windows of the baseline bench keyed by workload.
+// The rule matching no window is an error, so a typo in its workloads does not pass silently.
+func (c *Checker) Check(set *RuleSet, windows []Window, baselines map[string]Window) []RuleResult {
+	results := make([]RuleResult, 0, len(set.Rules)*len(windows))
+	matched := make([]bool, len(set.Rules))
+	for _, window := range windows {
+		for i := range set.Rules {
+			rule := &set.Rules[i]
+			if !rule.match(window.Workload) {
+				continue
+			}
+			matched[i] = true
+			result := RuleResult{Rule: rule.Name, Expr: rule.Expr, Workload: window.Workload}
+			result.Value, result.Threshold, result.Err = c.checkRule(rule, window, baselines)
+			if result.Err == nil {
+				result.Passed = compare(result.Value, rule.op, result.Threshold)
+			}
+			results = append(results, result)
+		}
+	}
+	for i, rule := range set.Rules {
+		if !matched[i] {
+			results = append(results, RuleResult{Rule: rule.Name, Expr: rule.Expr, Err: fmt.Errorf("rule matches no workload")})
+		}
+	}
+	return results
+}
+
+func (c *Checker) checkRule(rule *Rule, window Window, baselines map[string]Window) (value, threshold float64, err error) {
+	if value, err = c.evaluate(rule.value, window, nil); err != nil {
+		return 0, 0, err
+	}
+	var parameters map[string]interface{}
+	if rule.useBaseline {
+		baseline, ok := baselines[window.Workload]
+		if !ok {
+			return value, 0, fmt.Errorf("baseline has no workload %s", window.Workload)
+		}
+		v, err := c.evaluate(rule.value, baseline, nil)
+		if err != nil {
+			return value, 0, fmt.Errorf("evaluate baseline failed: %v", err)
+		}
+		parameters = map[string]interface{}{BaselineVar: v}
+	}
+	threshold, err = c.evaluate(rule.threshold, window, parameters)
+	return value, threshold, err
+}
+
+// evaluate resolves the variables from the metrics of the window first, then from the catalog series.
+// The arguments of the functions are always the catalog series, e.g. tidb_duration_P99 in mean(tidb_duration_P99)
+// is the series though the window has its summary with the same key.
+func (c *Checker) evaluate(expr *govaluate.EvaluableExpression, window Window, parameters map[string]interface{}) (float64, error) {
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	args := functionArgs(expr)
+	for _, v := range expr.Vars() {
+		if _, ok := parameters[v]; ok {
+			continue
+		}
+		if value, ok := window.Metrics[v]; ok && !args[v] {
+			parameters[v] = value
+			continue
+		}
+		metrics, ok := Catalog[v]
+		if !ok {
+			return 0, fmt.Errorf("%s is neither a metrics key of the workload nor a catalog metric", v)
+		}
+		data, err := c.source.Source(metrics, window.Start, window.End)
+		if err != nil {
+			return 0, err
+		}
+		parameters[v] = data
+	}
+	result, err := expr.Evaluate(parameters)
+	if err != nil {
+		return 0, err
+	}
+	switch v := result.(type) {
+	case float64:
+		return v, nil
+	case []float64:
+		if len(v) == 1 {
+			return v[0], nil
+		}
+		return 0, fmt.Errorf("%s has %d values, aggregate them like max(mean(...))", expr.String(), len(v))
+	default:
+		return 0, fmt.Errorf("%s is not a number", expr.String())
+	}
+}
+
+// functionArgs returns the variables inside the parentheses of a function call.
+func functionArgs(expr *govaluate.EvaluableExpression) map[string]bool {
+	args := make(map[string]bool)
+	// calls is the stack of the open parentheses, true if the parenthesis is a function call
+	var calls []bool
+	inCall := func() bool {
+		for _, call := range calls {
+			if call {
+				return true
+			}
+		}
+		return false
+	}
+	tokens := expr.Tokens()
+	for i, token := range tokens {
+		switch token.Kind {
+		case govaluate.CLAUSE:
+			calls = append(calls, i > 0 && tokens[i-1].Kind == govaluate.FUNCTION)
+		case govaluate.CLAUSE_CLOSE:
+			if len(calls) > 0 {
+				calls = calls[:len(calls)-1]
+			}
+		case govaluate.VARIABLE:
+			if inCall() {
+				args[token.Value.(string)] = true
+			}
+		}
+	}
+	return args
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	default:
+		return value != threshold
+	}
+}
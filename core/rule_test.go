@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type windowSource map[string][][]float64
+
+func (s windowSource) Source(metrics, start, end string) ([][]float64, error) {
+	data, ok := s[end]
+	if !ok {
+		return nil, errors.New("no data")
+	}
+	return data, nil
+}
+
+func TestParseRules(t *testing.T) {
+	as := assert.New(t)
+	set, err := ParseRules([]byte(`
+baseline: nightly
+rules:
+  - name: p99
+    expr: mean(tidb_duration_P99) < 50
+  - expr: store_write_rate_bytes_std/avg <= baseline * 1.1
+    workloads: [write]
+`))
+	as.Nil(err)
+	as.True(set.UseBaseline())
+	as.Equal("store_write_rate_bytes_std/avg <= baseline * 1.1", set.Rules[1].Name)
+	as.Equal("<=", set.Rules[1].op)
+	set, err = ParseRules([]byte(`rules: [{expr: "sysbench_tps > 0.9 * baseline"}]`))
+	as.Nil(err)
+	as.True(set.UseBaseline())
+	as.Empty(set.Baseline)
+
+	for _, data := range []string{
+		`rules: []`,
+		`rules: [{expr: "mean(tidb_duration_P99)"}]`,
+		`rules: [{expr: "1 < 2 < 3"}]`,
+		`{baseline: b, rules: [{expr: "baseline < sysbench_tps"}]}`,
+		`rules: [{expr: "sysbench_tps > other"}]`,
+		`rules: [{expr: "mean(tidb_duration_P99 < 5"}]`,
+	} {
+		_, err = ParseRules([]byte(data))
+		as.NotNil(err, data)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	as := assert.New(t)
+	set, err := ParseRules([]byte(`
+baseline: nightly
+rules:
+  - name: p99
+    expr: max(mean(tidb_duration_P99)) <= 50
+  - name: balance
+    expr: store_write_rate_bytes_std/avg <= baseline * 1.1
+    workloads: [write, read]
+  - name: cpu
+    expr: mean(tikv_cpu) < 1
+  - name: typo
+    expr: qps > 0
+    workloads: [wirte]
+`))
+	as.Nil(err)
+	checker := NewChecker(windowSource{
+		"20": {{40, 60}},
+		"40": {{60, 80}},
+		"10": {{10, 20}},
+	})
+	windows := []Window{
+		{Workload: "write", Start: "0", End: "20", Metrics: map[string]float64{"store_write_rate_bytes_std/avg": 0.2}},
+		{Workload: "read", Start: "20", End: "40", Metrics: map[string]float64{"store_write_rate_bytes_std/avg": 0.5}},
+	}
+	baselines := map[string]Window{
+		"write": {Workload: "write", Start: "0", End: "10", Metrics: map[string]float64{"store_write_rate_bytes_std/avg": 0.25}},
+	}
+	results := checker.Check(set, windows, baselines)
+	as.Len(results, 7)
+
+	as.Equal("p99", results[0].Rule)
+	as.True(results[0].Passed)
+	as.Equal(50.0, results[0].Value)
+	as.True(results[1].Passed)
+	as.InDelta(0.275, results[1].Threshold, 1e-9)
+	as.Nil(results[2].Err) // one series
+	as.False(results[2].Passed)
+
+	as.Equal("read", results[3].Workload)
+	as.False(results[3].Passed)
+	as.Equal(70.0, results[3].Value)
+	as.NotNil(results[4].Err)
+	as.Contains(results[4].Err.Error(), "baseline has no workload read")
+	as.Equal("typo", results[6].Rule)
+	as.EqualError(results[6].Err, "rule matches no workload")
+	as.Len(checker.Check(set, nil, baselines), 4)
+
+	var buf bytes.Buffer
+	as.Nil(WriteJUnit(&buf, "hot", results[:6]))
+	xml := buf.String()
+	as.True(strings.HasPrefix(xml, "<?xml"))
+	as.Contains(xml, `<testsuite name="hot" tests="6" failures="3" errors="1">`)
+	as.Contains(xml, `<testcase name="p99" classname="write"></testcase>`)
+	as.Contains(xml, `<failure message="70 does not satisfy the threshold 50">max(mean(tidb_duration_P99)) &lt;= 50</failure>`)
+}
+
+func TestCheckSummarized(t *testing.T) {
+	as := assert.New(t)
+	set, err := ParseRules([]byte(`
+rules:
+  - expr: mean(tidb_duration_P99) < 50
+  - expr: tidb_duration_P99 < 50
+  - expr: max(mean(store_write_rate_bytes)) - store_write_rate_bytes_avg < 20
+`))
+	as.Nil(err)
+	checker := NewChecker(windowSource{
+		"20": {{40, 50}},
+	})
+	catalog := map[string]string{
+		"tidb_duration_P99":      Catalog["tidb_duration_P99"],
+		"store_write_rate_bytes": Catalog["store_write_rate_bytes"],
+	}
+	// the window is summarized like the check command does, so its metrics have the keys of the catalog.
+	metrics, err := Summarize(checker, catalog, "0", "20")
+	as.Nil(err)
+	as.Equal(45.0, metrics["tidb_duration_P99"])
+	results := checker.Check(set, []Window{{Workload: "write", Start: "0", End: "20", Metrics: metrics}}, nil)
+	as.Len(results, 3)
+	for i, value := range []float64{45, 45, 0} {
+		as.Nil(results[i].Err, results[i].Expr)
+		as.True(results[i].Passed, results[i].Expr)
+		as.Equal(value, results[i].Value, results[i].Expr)
+	}
+}
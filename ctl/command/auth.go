@@ -0,0 +1,38 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"github.com/bufferflies/pd-analyze/client"
+	"github.com/spf13/cobra"
+)
+
+// TokenEnv is the environment variable of the api token if --token is not set.
+const TokenEnv = "ANALYZE_TOKEN"
+
+var apiToken string
+
+// SetToken sets the token of the clients of the analyze server.
+func SetToken(token string) {
+	apiToken = token
+}
+
+// newClient returns the client of the analyze server of the --server flag.
+func newClient(cmd *cobra.Command) (*client.Client, error) {
+	addr, err := cmd.Flags().GetString("server")
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClient(addr, client.WithToken(apiToken)), nil
+}
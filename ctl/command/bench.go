@@ -0,0 +1,205 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"sort"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/spf13/cobra"
+)
+
+// NewBenchCommand return a bench subcommand of rootCmd
+func NewBenchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench <subcommand>",
+		Short: "bench commands",
+	}
+	cmd.PersistentFlags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	cmd.PersistentFlags().StringSliceP("label", "l", nil, "label selectors like key=value")
+	list := &cobra.Command{
+		Use:   "list <session_id>",
+		Short: "list the benches of the session",
+		Args:  cobra.ExactArgs(1),
+		Run:   ListBenches,
+	}
+	get := &cobra.Command{
+		Use:   "get <session_id> <bench_name>",
+		Short: "get the metrics of the workloads of the bench",
+		Args:  cobra.ExactArgs(2),
+		Run:   GetBench,
+	}
+	compare := &cobra.Command{
+		Use:   "compare <session_id> <bench_name> <baseline>",
+		Short: "compare the metrics of the last run of every workload with the baseline bench",
+		Args:  cobra.ExactArgs(3),
+		Run:   CompareBench,
+	}
+	for _, c := range []*cobra.Command{list, get, compare} {
+		outputFlag(c)
+	}
+	cmd.AddCommand(list, get, compare, &cobra.Command{
+		Use:   "delete <session_id> <bench_name>",
+		Short: "delete the workloads of the bench",
+		Args:  cobra.ExactArgs(2),
+		Run:   DeleteBench,
+	})
+	return cmd
+}
+
+func ListBenches(cmd *cobra.Command, args []string) {
+	sid, err := argID(args, 0, "session id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	benches, err := cli.GetBenches(sid)
+	if err != nil {
+		cmd.Printf("list benches failed err:%v\n", err)
+		return
+	}
+	rows := make([][]string, 0, len(benches))
+	for _, b := range benches {
+		baseline := ""
+		if b.Baseline {
+			baseline = "yes"
+		}
+		rows = append(rows, []string{b.Name, formatID(uint(b.Workloads)), formatTime(b.Start), formatTime(b.End), baseline})
+	}
+	if err := printOutput(cmd, benches, []string{"name", "workloads", "start", "end", "baseline"}, rows); err != nil {
+		cmd.Printf("print benches failed err:%v\n", err)
+	}
+}
+
+// getBench returns the workloads of the bench selected by the --label flag.
+func getBench(cmd *cobra.Command, sessionID string, name string) ([]api.WorkloadMetrics, error) {
+	sid, err := argID([]string{sessionID}, 0, "session id")
+	if err != nil {
+		return nil, err
+	}
+	labels, err := cmd.Flags().GetStringSlice("label")
+	if err != nil {
+		return nil, err
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return cli.GetBench(sid, name, labels)
+}
+
+func GetBench(cmd *cobra.Command, args []string) {
+	loads, err := getBench(cmd, args[0], args[1])
+	if err != nil {
+		cmd.Printf("get bench failed err:%v\n", err)
+		return
+	}
+	rows := make([][]string, 0)
+	for _, load := range loads {
+		metrics := load.MetricsMap()
+		for _, k := range sortedKeys(metrics) {
+			rows = append(rows, []string{formatID(load.ID), load.Name, k, formatFloat(metrics[k])})
+		}
+	}
+	if err := printOutput(cmd, loads, []string{"workload_id", "workload", "key", "value"}, rows); err != nil {
+		cmd.Printf("print bench failed err:%v\n", err)
+	}
+}
+
+// BenchDelta is the metrics of the last run of the workload versus the baseline bench.
+type BenchDelta struct {
+	Workload string             `json:"workload"`
+	Metrics  []core.MetricDelta `json:"metrics"`
+}
+
+func CompareBench(cmd *cobra.Command, args []string) {
+	loads, err := getBench(cmd, args[0], args[1])
+	if err != nil {
+		cmd.Printf("get bench failed err:%v\n", err)
+		return
+	}
+	baseline, err := getBench(cmd, args[0], args[2])
+	if err != nil {
+		cmd.Printf("get baseline failed err:%v\n", err)
+		return
+	}
+	current, old := lastRuns(loads), lastRuns(baseline)
+	deltas := make([]BenchDelta, 0, len(current))
+	rows := make([][]string, 0)
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		base, ok := old[name]
+		if !ok {
+			continue
+		}
+		delta := BenchDelta{Workload: name, Metrics: core.DiffMetrics(base.MetricsMap(), current[name].MetricsMap())}
+		for _, m := range delta.Metrics {
+			rows = append(rows, []string{name, m.Key, formatFloat(m.Old), formatFloat(m.New), formatFloat(m.Delta), formatFloat(m.Ratio*100) + "%"})
+		}
+		deltas = append(deltas, delta)
+	}
+	if err := printOutput(cmd, deltas, []string{"workload", "key", args[2], args[1], "delta", "ratio"}, rows); err != nil {
+		cmd.Printf("print compare failed err:%v\n", err)
+	}
+}
+
+// lastRuns returns the last run of every workload keyed by workload name.
+func lastRuns(loads []api.WorkloadMetrics) map[string]api.WorkloadMetrics {
+	runs := make(map[string]api.WorkloadMetrics, len(loads))
+	for _, load := range loads {
+		if run, ok := runs[load.Name]; !ok || run.ID < load.ID {
+			runs[load.Name] = load
+		}
+	}
+	return runs
+}
+
+func DeleteBench(cmd *cobra.Command, args []string) {
+	loads, err := getBench(cmd, args[0], args[1])
+	if err != nil {
+		cmd.Printf("get bench failed err:%v\n", err)
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	for _, load := range loads {
+		if err := cli.DeleteWorkload(load.ID); err != nil {
+			cmd.Printf("delete workload %d failed err:%v\n", load.ID, err)
+			return
+		}
+	}
+	cmd.Printf("%d workloads of bench %s deleted\n", len(loads), args[1])
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
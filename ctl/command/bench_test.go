@@ -0,0 +1,19 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastRuns(t *testing.T) {
+	as := assert.New(t)
+	load := func(id uint, name string) api.WorkloadMetrics {
+		return api.WorkloadMetrics{Workload: repository.Workload{ID: id, Name: name}}
+	}
+	runs := lastRuns([]api.WorkloadMetrics{load(3, "w1"), load(1, "w2"), load(5, "w1"), load(4, "w1"), load(2, "w2")})
+	as.Equal(map[string]api.WorkloadMetrics{"w1": load(5, "w1"), "w2": load(2, "w2")}, runs)
+	as.Empty(lastRuns(nil))
+}
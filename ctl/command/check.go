@@ -0,0 +1,220 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/spf13/cobra"
+)
+
+// exit codes of the check command
+const (
+	checkFailed = 1
+	checkError  = 2
+)
+
+// ExitError is returned by the command which has printed its result and exits with the code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// NewCheckCommand return a check subcommand of rootCmd
+func NewCheckCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "check <rules.yaml>",
+		Short: "check the workloads of the record log against the rules, exit 1 if any rule fails and 2 if any rule can not be evaluated or matches no workload",
+		Args:  cobra.ExactArgs(1),
+		RunE:  Check,
+		// the exit code is the result, not the misuse of the command
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringP("data", "d", "time.log", "record log path")
+	cmd.Flags().StringP("prometheus", "p", "localhost:9090", "prometheus address")
+	cmd.Flags().StringP("server", "s", "http://localhost:8080", "analyze server address the baseline bench is read from")
+	cmd.Flags().Uint32P("session_id", "i", 1, "session id of the baseline bench")
+	cmd.Flags().StringP("baseline", "b", "", "baseline bench name, override the baseline of the rules")
+	cmd.Flags().String("junit", "", "write the results as junit xml to the file")
+	return cmd
+}
+
+func Check(cmd *cobra.Command, args []string) error {
+	if code := check(cmd, args[0]); code != 0 {
+		return &ExitError{Code: code}
+	}
+	return nil
+}
+
+func check(cmd *cobra.Command, path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		cmd.Printf("read rules failed err:%v\n", err)
+		return checkError
+	}
+	baseline, err := cmd.Flags().GetString("baseline")
+	if err != nil {
+		cmd.Printf("get baseline failed err:%v\n", err)
+		return checkError
+	}
+	set, err := core.ParseRules(data)
+	if err != nil {
+		cmd.Println(err.Error())
+		return checkError
+	}
+	if baseline != "" {
+		set.Baseline = baseline
+	}
+	if set.UseBaseline() && set.Baseline == "" {
+		cmd.Println("the rules compare with baseline, but the baseline bench is not set")
+		return checkError
+	}
+	prometheus, err := cmd.Flags().GetString("prometheus")
+	if err != nil {
+		cmd.Printf("get prometheus failed err:%v\n", err)
+		return checkError
+	}
+	checker := core.NewChecker(core.NewPrometheus(prometheus))
+	windows, err := checkWindows(cmd, checker)
+	if err != nil {
+		cmd.Println(err.Error())
+		return checkError
+	}
+	if len(windows) == 0 {
+		cmd.Println("the record log has no workloads to check")
+		return checkError
+	}
+	var baselines map[string]core.Window
+	if set.UseBaseline() {
+		if baselines, err = baselineWindows(cmd, set.Baseline); err != nil {
+			cmd.Println(err.Error())
+			return checkError
+		}
+	}
+
+	results := checker.Check(set, windows, baselines)
+	code, passed, failed, errors := 0, 0, 0, 0
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "rule\tworkload\tvalue\tthreshold\tresult")
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			errors++
+			code = checkError
+			fmt.Fprintf(w, "%s\t%s\t\t\tERROR %v\n", r.Rule, r.Workload, r.Err)
+		case r.Passed:
+			passed++
+			fmt.Fprintf(w, "%s\t%s\t%.4f\t%.4f\tPASS\n", r.Rule, r.Workload, r.Value, r.Threshold)
+		default:
+			failed++
+			if code == 0 {
+				code = checkFailed
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.4f\t%.4f\tFAIL\n", r.Rule, r.Workload, r.Value, r.Threshold)
+		}
+	}
+	w.Flush()
+	cmd.Printf("%d passed, %d failed, %d errors\n", passed, failed, errors)
+
+	junit, err := cmd.Flags().GetString("junit")
+	if err != nil {
+		cmd.Printf("get junit failed err:%v\n", err)
+		return checkError
+	}
+	if junit != "" {
+		file, err := os.Create(junit)
+		if err != nil {
+			cmd.Printf("create junit file failed err:%v\n", err)
+			return checkError
+		}
+		defer file.Close()
+		if err := core.WriteJUnit(file, path, results); err != nil {
+			cmd.Printf("write junit failed err:%v\n", err)
+			return checkError
+		}
+	}
+	return code
+}
+
+// checkWindows summarizes the workloads of the record log, the metrics in the records are kept.
+func checkWindows(cmd *cobra.Command, checker *core.Checker) ([]core.Window, error) {
+	path, err := cmd.Flags().GetString("data")
+	if err != nil {
+		return nil, fmt.Errorf("get record log path failed err:%v", err)
+	}
+	records, err := ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file failed err:%v", err)
+	}
+	windows := make([]core.Window, 0, len(records))
+	for _, r := range records {
+		metrics, err := core.Summarize(checker, core.Catalog, r.Start, r.End)
+		if err != nil {
+			// the rules using the metrics key of the summary fail alone
+			cmd.Printf("summarize workload %s failed err:%v\n", r.Workload, err)
+			metrics = make(map[string]float64)
+		}
+		for k, v := range r.Metrics {
+			metrics[k] = v
+		}
+		windows = append(windows, core.Window{Workload: r.Workload, Start: r.Start, End: r.End, Metrics: metrics})
+	}
+	return windows, nil
+}
+
+// baselineWindows returns the last run of every workload in the baseline bench stored in the server.
+func baselineWindows(cmd *cobra.Command, bench string) (map[string]core.Window, error) {
+	sid, err := cmd.Flags().GetUint32("session_id")
+	if err != nil {
+		return nil, fmt.Errorf("get session id failed err:%v", err)
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("get analyze address failed err:%v", err)
+	}
+	loads, err := cli.GetBench(uint(sid), bench, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get baseline bench %s failed err:%v", bench, err)
+	}
+	if len(loads) == 0 {
+		return nil, fmt.Errorf("baseline bench %s has no workloads in session %d", bench, sid)
+	}
+	windows := make(map[string]core.Window, len(loads))
+	ids := make(map[string]uint, len(loads))
+	for _, load := range loads {
+		if load.ID < ids[load.Name] {
+			continue
+		}
+		ids[load.Name] = load.ID
+		metrics := make(map[string]float64, len(load.Metrics))
+		for _, m := range load.Metrics {
+			metrics[m.Key] = m.Value
+		}
+		windows[load.Name] = core.Window{
+			Workload: load.Name,
+			Start:    strconv.FormatInt(load.Start.Unix(), 10),
+			End:      strconv.FormatInt(load.End.Unix(), 10),
+			Metrics:  metrics,
+		}
+	}
+	return windows, nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/client"
+	"github.com/mattn/go-shellwords"
+	"github.com/spf13/cobra"
+)
+
+// completeTimeout bounds the requests of the completion, so the prompt is not blocked by a dead server.
+const completeTimeout = 2 * time.Second
+
+// completeTTL is how long the listed ids are reused, so a Tab does not list every project of the server again.
+const completeTTL = 30 * time.Second
+
+type completeEntry struct {
+	ids []string
+	at  time.Time
+}
+
+// completeCache keeps the listed ids of the prompt keyed by server, token and argument.
+var completeCache = struct {
+	sync.Mutex
+	entries map[string]completeEntry
+}{entries: make(map[string]completeEntry)}
+
+// IDCompleter returns the completion of the first argument of the command if it is <project_id> or <session_id>,
+// otherwise nil. The ids are listed from the --server of the line or the default server of the command.
+func IDCompleter(cmd *cobra.Command) func(line string) []string {
+	use := strings.Fields(cmd.Use)
+	if len(use) < 2 || (use[1] != "<project_id>" && use[1] != "<session_id>") {
+		return nil
+	}
+	sessions := use[1] == "<session_id>"
+	return func(line string) []string {
+		token := apiToken
+		if token == "" {
+			token = os.Getenv(TokenEnv)
+		}
+		server := completeServer(cmd, line)
+		key := strings.Join([]string{server, token, use[1]}, "\x00")
+		completeCache.Lock()
+		defer completeCache.Unlock()
+		if entry, ok := completeCache.entries[key]; ok && time.Since(entry.at) < completeTTL {
+			return entry.ids
+		}
+		cli := client.NewClient(server, client.WithToken(token),
+			client.WithHTTPClient(&http.Client{Timeout: completeTimeout}))
+		ids, err := listIDs(cli, sessions)
+		if err != nil {
+			return ids
+		}
+		completeCache.entries[key] = completeEntry{ids: ids, at: time.Now()}
+		return ids
+	}
+}
+
+// listIDs lists the ids of the projects, or of the sessions of every project.
+func listIDs(cli *client.Client, sessions bool) ([]string, error) {
+	projects, err := cli.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(projects))
+	for _, p := range projects {
+		if !sessions {
+			ids = append(ids, formatID(p.ID))
+			continue
+		}
+		list, err := cli.GetSessions(p.ID)
+		if err != nil {
+			return ids, err
+		}
+		for _, s := range list {
+			ids = append(ids, formatID(s.ID))
+		}
+	}
+	return ids, nil
+}
+
+// completeServer returns the --server of the line, or the default server of the command.
+func completeServer(cmd *cobra.Command, line string) string {
+	words, _ := shellwords.Parse(line)
+	for i, word := range words {
+		switch {
+		case (word == "-s" || word == "--server") && i+1 < len(words):
+			return words[i+1]
+		case strings.HasPrefix(word, "--server="):
+			return strings.TrimPrefix(word, "--server=")
+		}
+	}
+	if flag := cmd.Flag("server"); flag != nil {
+		return flag.Value.String()
+	}
+	return "http://localhost:8080"
+}
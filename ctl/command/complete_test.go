@@ -0,0 +1,70 @@
+package command
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompleteServer(t *testing.T) {
+	as := assert.New(t)
+	cmd := &cobra.Command{Use: "list <session_id>"}
+	as.Equal("http://localhost:8080", completeServer(cmd, "list "))
+
+	cmd.Flags().StringP("server", "s", "http://default:8080", "")
+	testCases := []struct {
+		line   string
+		server string
+	}{
+		{"list ", "http://default:8080"},
+		{"list -s http://a:8080 ", "http://a:8080"},
+		{"list --server http://b:8080 ", "http://b:8080"},
+		{"list --server=http://c:8080 ", "http://c:8080"},
+		{"list --server 'http://d:8080' ", "http://d:8080"},
+		// the flag without value is ignored
+		{"list --server", "http://default:8080"},
+	}
+	for _, testCase := range testCases {
+		as.Equal(testCase.server, completeServer(cmd, testCase.line), testCase.line)
+	}
+}
+
+func TestIDCompleter(t *testing.T) {
+	as := assert.New(t)
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		switch r.URL.Path {
+		case "/project/":
+			fmt.Fprint(w, `[{"ID":1},{"ID":2}]`)
+		case "/project/sessions/1":
+			fmt.Fprint(w, `[{"id":10},{"id":11}]`)
+		case "/project/sessions/2":
+			fmt.Fprint(w, `[{"id":20}]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	as.Nil(IDCompleter(&cobra.Command{Use: "list"}))
+	as.Nil(IDCompleter(&cobra.Command{Use: "show <workload_id>"}))
+
+	line := "show --server " + ts.URL + " "
+	projects := IDCompleter(&cobra.Command{Use: "show <project_id>"})
+	as.Equal([]string{"1", "2"}, projects(line))
+	as.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	sessions := IDCompleter(&cobra.Command{Use: "show <session_id>"})
+	as.Equal([]string{"10", "11", "20"}, sessions(line))
+	as.Equal(int32(4), atomic.LoadInt32(&calls))
+	// the next Tab of the prompt reuses the listed ids, even from another command.
+	as.Equal([]string{"10", "11", "20"}, IDCompleter(&cobra.Command{Use: "delete <session_id>"})(line))
+	as.Equal([]string{"1", "2"}, projects(line))
+	as.Equal(int32(4), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,144 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ConfigEnv is the environment variable of the config file if --config is not set.
+const ConfigEnv = config.EnvPrefix + "CONFIG"
+
+// ApplyConfig sets the flags of the command not set in the command line from the environment variables
+// and the config file of --config.
+func ApplyConfig(cmd *cobra.Command) error {
+	layers, err := loadLayers(cmd)
+	if err != nil {
+		return err
+	}
+	_, err = layers.Apply(cmd.Flags(), commandPath(cmd))
+	return err
+}
+
+func loadLayers(cmd *cobra.Command) (*config.Layers, error) {
+	path, err := cmd.Flags().GetString("config")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = os.Getenv(ConfigEnv)
+	}
+	return config.Load(path)
+}
+
+// commandPath returns the names of the command without the root.
+func commandPath(cmd *cobra.Command) []string {
+	return strings.Fields(cmd.CommandPath())[1:]
+}
+
+// NewConfigCommand return a config subcommand of rootCmd
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config <subcommand>",
+		Short: "config commands",
+	}
+	print := &cobra.Command{
+		Use:   "print [command]...",
+		Short: "print the effective flags of the command and their sources, all commands if it is not set",
+		Run:   PrintConfig,
+	}
+	outputFlag(print)
+	cmd.AddCommand(print)
+	return cmd
+}
+
+// ConfigValue is the effective value of a flag of the command.
+type ConfigValue struct {
+	Command string        `json:"command"`
+	Flag    string        `json:"flag"`
+	Value   string        `json:"value"`
+	Source  config.Source `json:"source"`
+	Env     string        `json:"env"`
+}
+
+func PrintConfig(cmd *cobra.Command, args []string) {
+	layers, err := loadLayers(cmd)
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	var targets []*cobra.Command
+	if len(args) > 0 {
+		target, rest, err := cmd.Root().Find(args)
+		if err != nil || len(rest) > 0 || target == cmd.Root() {
+			cmd.Printf("unknown command %s\n", strings.Join(args, " "))
+			return
+		}
+		targets = []*cobra.Command{target}
+	} else {
+		targets = runnableCommands(cmd.Root())
+	}
+
+	values := make([]ConfigValue, 0)
+	rows := make([][]string, 0)
+	for _, target := range targets {
+		// merges the persistent flags of the parents
+		if err := target.ParseFlags(nil); err != nil {
+			cmd.Printf("parse flags of %s failed err:%v\n", target.CommandPath(), err)
+			return
+		}
+		sources, err := layers.Apply(target.Flags(), commandPath(target))
+		if err != nil {
+			cmd.Printf("apply config of %s failed err:%v\n", target.CommandPath(), err)
+			return
+		}
+		name := strings.Join(commandPath(target), " ")
+		target.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Name == "help" {
+				return
+			}
+			value := f.Value.String()
+			if f.Name == "token" && value != "" {
+				value = "******"
+			}
+			v := ConfigValue{Command: name, Flag: f.Name, Value: value, Source: sources[f.Name], Env: config.EnvName(f.Name)}
+			values = append(values, v)
+			rows = append(rows, []string{v.Command, v.Flag, v.Value, string(v.Source), v.Env})
+		})
+	}
+	if err := printOutput(cmd, values, []string{"command", "flag", "value", "source", "env"}, rows); err != nil {
+		cmd.Printf("print config failed err:%v\n", err)
+	}
+}
+
+// runnableCommands returns the runnable commands under the root ordered by path.
+func runnableCommands(root *cobra.Command) []*cobra.Command {
+	var result []*cobra.Command
+	for _, c := range root.Commands() {
+		if c.Runnable() && c.Name() != "help" {
+			result = append(result, c)
+		}
+		result = append(result, runnableCommands(c)...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CommandPath() < result[j].CommandPath()
+	})
+	return result
+}
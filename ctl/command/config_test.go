@@ -0,0 +1,62 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintConfig(t *testing.T) {
+	as := assert.New(t)
+	path := filepath.Join(t.TempDir(), "analyze.toml")
+	as.NoError(ioutil.WriteFile(path, []byte(`
+label = ["a=b"]
+token = "secret"
+[bench.list]
+server = "http://bench"
+`), 0644))
+
+	root := &cobra.Command{Use: "pd-analyze"}
+	root.PersistentFlags().String("token", "", "")
+	root.PersistentFlags().String("config", "", "")
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return ApplyConfig(cmd)
+	}
+	root.AddCommand(NewBenchCommand(), NewWorkloadCommand(), NewConfigCommand())
+	var out bytes.Buffer
+	root.SetOut(&out)
+	root.SetArgs([]string{"config", "print", "-o", "json", "--config", path})
+	as.NoError(root.Execute())
+
+	var values []ConfigValue
+	as.NoError(json.Unmarshal(out.Bytes(), &values), out.String())
+	find := func(command, flag string) ConfigValue {
+		for _, v := range values {
+			if v.Command == command && v.Flag == flag {
+				return v
+			}
+		}
+		return ConfigValue{}
+	}
+	// the shared persistent slice flags are applied once per command, not appended
+	for _, command := range []string{"bench list", "bench get", "bench compare", "workload list"} {
+		as.Equal(ConfigValue{Command: command, Flag: "label", Value: "[a=b]", Source: config.SourceFile, Env: "ANALYZE_LABEL"},
+			find(command, "label"), command)
+	}
+	as.Equal("http://bench", find("bench list", "server").Value)
+	as.Equal(config.SourceDefault, find("bench get", "server").Source)
+	as.Equal("******", find("workload list", "token").Value)
+	as.Equal(config.SourceFlag, find("workload list", "config").Source)
+
+	out.Reset()
+	root.SetArgs([]string{"config", "print", "workload", "list", "-o", "table", "--config", path})
+	as.NoError(root.Execute())
+	as.Contains(out.String(), "workload list  label")
+	as.NotContains(out.String(), "bench list")
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/spf13/cobra"
+)
+
+// NewDiffConfigCommand return a diff-config subcommand of rootCmd
+func NewDiffConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff-config <workload_id> <other_id>",
+		Short: "diff pd config and metrics between two workloads",
+		Args:  cobra.ExactArgs(2),
+		Run:   DiffConfig,
+	}
+	cmd.Flags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	return cmd
+}
+
+func DiffConfig(cmd *cobra.Command, args []string) {
+	wIDs := make([]uint, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			cmd.Printf("workload id must be a number:%s\n", arg)
+			return
+		}
+		wIDs[i] = uint(id)
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	diff, err := cli.DiffWorkloads(wIDs[0], wIDs[1])
+	if err != nil {
+		cmd.Printf("diff workloads failed err:%v\n", err)
+		return
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "config\t%s(%d)\t%s(%d)\n", diff.Old.Name, diff.Old.ID, diff.New.Name, diff.New.ID)
+	if len(diff.Config) == 0 {
+		fmt.Fprintln(w, "(no change)\t\t")
+	}
+	for _, c := range diff.Config {
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", changeSign(c.Type), c.Path, toJSON(c.Old), toJSON(c.New))
+	}
+	fmt.Fprintln(w, "\t\t\t")
+	fmt.Fprintln(w, "metrics\told\tnew\tdelta\tratio")
+	for _, m := range diff.Metrics {
+		fmt.Fprintf(w, "%s\t%.4f\t%.4f\t%+.4f\t%+.2f%%\n", m.Key, m.Old, m.New, m.Delta, m.Ratio*100)
+	}
+	w.Flush()
+}
+
+func changeSign(t core.ChangeType) string {
+	switch t {
+	case core.Added:
+		return "+"
+	case core.Removed:
+		return "-"
+	default:
+		return "~"
+	}
+}
+
+func toJSON(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// NewExportCommand return a export subcommand of rootCmd
+func NewExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <session_id> <bench_name>",
+		Short: "export the bench as csv, markdown or html table with workloads as rows and metric keys as columns",
+		Args:  cobra.ExactArgs(2),
+		Run:   ExportBench,
+	}
+	cmd.Flags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	cmd.Flags().StringP("format", "f", "md", "csv, md or html")
+	cmd.Flags().StringP("baseline", "b", "", "bench name in the session to compare with")
+	cmd.Flags().StringSliceP("label", "l", nil, "label selectors like key=value")
+	cmd.Flags().StringP("out", "o", "", "output file, default is stdout")
+	return cmd
+}
+
+func ExportBench(cmd *cobra.Command, args []string) {
+	sid, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		cmd.Printf("session id must be a number:%s\n", args[0])
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		cmd.Printf("get format failed err:%v\n", err)
+		return
+	}
+	baseline, err := cmd.Flags().GetString("baseline")
+	if err != nil {
+		cmd.Printf("get baseline failed err:%v\n", err)
+		return
+	}
+	labels, err := cmd.Flags().GetStringSlice("label")
+	if err != nil {
+		cmd.Printf("get label failed err:%v\n", err)
+		return
+	}
+	out, err := cmd.Flags().GetString("out")
+	if err != nil {
+		cmd.Printf("get out failed err:%v\n", err)
+		return
+	}
+
+	table, err := cli.ExportBench(uint(sid), args[1], format, baseline, labels)
+	if err != nil {
+		cmd.Printf("export bench failed err:%v\n", err)
+		return
+	}
+	defer table.Close()
+	writer := cmd.OutOrStdout()
+	if out != "" {
+		file, err := os.Create(out)
+		if err != nil {
+			cmd.Printf("create file failed err:%v\n", err)
+			return
+		}
+		defer file.Close()
+		writer = file
+	}
+	if _, err := io.Copy(writer, table); err != nil {
+		cmd.Printf("write table failed err:%v\n", err)
+		return
+	}
+	if out != "" {
+		cmd.Printf("bench %s exported to %s\n", args[1], out)
+	}
+}
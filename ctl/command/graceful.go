@@ -0,0 +1,33 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import "sync/atomic"
+
+// graceful counts the running commands which stop on the cancellation of the command context, see Graceful.
+var graceful int32
+
+// Graceful returns true if a running command, e.g. start or run, stops on the cancellation of the command context
+// instead of exiting at once.
+func Graceful() bool {
+	return atomic.LoadInt32(&graceful) > 0
+}
+
+// runGraceful marks the command graceful until the returned function is called.
+func runGraceful() func() {
+	atomic.AddInt32(&graceful, 1)
+	return func() {
+		atomic.AddInt32(&graceful, -1)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// outputFlag adds the --output flag printOutput reads.
+func outputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "table", "output format: table, json, yaml or csv")
+}
+
+// printOutput prints v as json or yaml, or the rows under the header as table or csv.
+func printOutput(cmd *cobra.Command, v interface{}, header []string, rows [][]string) error {
+	format, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	out := cmd.OutOrStdout()
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+	case "yaml":
+		// through json so the keys are the json names
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	case "csv":
+		w := csv.NewWriter(out)
+		if err := w.Write(header); err != nil {
+			return err
+		}
+		if err := w.WriteAll(rows); err != nil {
+			return err
+		}
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("output must be table, json, yaml or csv, but got %s", format)
+	}
+}
+
+// argID parses the i-th argument as an id.
+func argID(args []string, i int, name string) (uint, error) {
+	id, err := strconv.ParseUint(args[i], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number:%s", name, args[i])
+	}
+	return uint(id), nil
+}
+
+func formatID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
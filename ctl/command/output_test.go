@@ -0,0 +1,44 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintOutput(t *testing.T) {
+	type row struct {
+		Name  string  `json:"name"`
+		Value float64 `json:"value"`
+	}
+	v := []row{{Name: "qps", Value: 1.5}, {Name: "p99, ms", Value: 20}}
+	header := []string{"name", "value"}
+	rows := [][]string{{"qps", "1.5000"}, {"p99, ms", "20.0000"}}
+	testCases := []struct {
+		format string
+		expect string
+	}{
+		{"table", "name     value\nqps      1.5000\np99, ms  20.0000\n"},
+		{"json", "[\n  {\n    \"name\": \"qps\",\n    \"value\": 1.5\n  },\n  {\n    \"name\": \"p99, ms\",\n    \"value\": 20\n  }\n]\n"},
+		{"yaml", "- name: qps\n  value: 1.5\n- name: p99, ms\n  value: 20\n"},
+		{"csv", "name,value\nqps,1.5000\n\"p99, ms\",20.0000\n"},
+	}
+	for _, testCase := range testCases {
+		as := assert.New(t)
+		cmd := &cobra.Command{}
+		outputFlag(cmd)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		as.NoError(cmd.Flags().Set("output", testCase.format))
+		as.NoError(printOutput(cmd, v, header, rows), testCase.format)
+		as.Equal(testCase.expect, out.String(), testCase.format)
+	}
+
+	cmd := &cobra.Command{}
+	outputFlag(cmd)
+	cmd.SetOut(&bytes.Buffer{})
+	assert.NoError(t, cmd.Flags().Set("output", "xml"))
+	assert.EqualError(t, printOutput(cmd, v, header, rows), "output must be table, json, yaml or csv, but got xml")
+}
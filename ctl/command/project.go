@@ -0,0 +1,236 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/spf13/cobra"
+)
+
+// NewProjectCommand return a project subcommand of rootCmd
+func NewProjectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "project <subcommand>",
+		Short: "project commands",
+	}
+	cmd.PersistentFlags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	cmd.AddCommand(newProjectListCommand(), newProjectGetCommand(), newProjectDeleteCommand(), newProjectExportCommand(), newProjectImportCommand())
+	return cmd
+}
+
+func newProjectListCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "list the projects",
+		Args:  cobra.NoArgs,
+		Run:   ListProjects,
+	}
+	outputFlag(cmd)
+	return cmd
+}
+
+func newProjectGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <project_id>",
+		Short: "get the project with its sessions",
+		Args:  cobra.ExactArgs(1),
+		Run:   GetProject,
+	}
+	outputFlag(cmd)
+	return cmd
+}
+
+func newProjectDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <project_id>",
+		Short: "delete the project with its sessions, workloads, retention and webhooks",
+		Args:  cobra.ExactArgs(1),
+		Run:   DeleteProject,
+	}
+}
+
+func newProjectExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export <project_id>",
+		Short: "export the project with all its sessions, workloads and metrics",
+		Args:  cobra.ExactArgs(1),
+		Run:   ExportProject,
+	}
+	cmd.Flags().StringP("out", "o", "", "archive path, default is project-<id>.json[.gz]")
+	cmd.Flags().BoolP("gzip", "z", false, "gzip the archive")
+	return cmd
+}
+
+func newProjectImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import <archive>",
+		Short: "import the project archive",
+		Args:  cobra.ExactArgs(1),
+		Run:   ImportProject,
+	}
+	cmd.Flags().StringP("conflict", "c", "", "what to do if the project exists: skip, overwrite or rename")
+	return cmd
+}
+
+func ListProjects(cmd *cobra.Command, args []string) {
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	projects, err := cli.GetProjects()
+	if err != nil {
+		cmd.Printf("list projects failed err:%v\n", err)
+		return
+	}
+	rows := make([][]string, 0, len(projects))
+	for _, p := range projects {
+		rows = append(rows, []string{formatID(p.ID), p.Name, p.Description})
+	}
+	if err := printOutput(cmd, projects, []string{"id", "name", "description"}, rows); err != nil {
+		cmd.Printf("print projects failed err:%v\n", err)
+	}
+}
+
+// ProjectDetail is the project with its sessions.
+type ProjectDetail struct {
+	repository.Project
+	Sessions []repository.Session
+}
+
+func GetProject(cmd *cobra.Command, args []string) {
+	pid, err := argID(args, 0, "project id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	var detail ProjectDetail
+	if detail.Project, err = cli.GetProject(pid); err != nil {
+		cmd.Printf("get project failed err:%v\n", err)
+		return
+	}
+	if detail.Sessions, err = cli.GetSessions(pid); err != nil {
+		cmd.Printf("get sessions failed err:%v\n", err)
+		return
+	}
+	rows := make([][]string, 0, len(detail.Sessions))
+	for _, s := range detail.Sessions {
+		rows = append(rows, []string{formatID(detail.ID), detail.Name, formatID(s.ID), s.Name, s.Description, formatTime(s.CreatedAt)})
+	}
+	header := []string{"project_id", "project", "session_id", "session", "description", "created"}
+	if err := printOutput(cmd, detail, header, rows); err != nil {
+		cmd.Printf("print project failed err:%v\n", err)
+	}
+}
+
+func DeleteProject(cmd *cobra.Command, args []string) {
+	pid, err := argID(args, 0, "project id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	if err := cli.DeleteProject(pid); err != nil {
+		cmd.Printf("delete project failed err:%v\n", err)
+		return
+	}
+	cmd.Printf("project %d deleted\n", pid)
+}
+
+func ExportProject(cmd *cobra.Command, args []string) {
+	pid, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		cmd.Printf("project id must be a number:%s\n", args[0])
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	gz, err := cmd.Flags().GetBool("gzip")
+	if err != nil {
+		cmd.Printf("get gzip failed err:%v\n", err)
+		return
+	}
+	out, err := cmd.Flags().GetString("out")
+	if err != nil {
+		cmd.Printf("get out failed err:%v\n", err)
+		return
+	}
+	if out == "" {
+		out = fmt.Sprintf("project-%d.json", pid)
+		if gz {
+			out += ".gz"
+		}
+	}
+
+	archive, err := cli.ExportProject(uint(pid), gz)
+	if err != nil {
+		cmd.Printf("export project failed err:%v\n", err)
+		return
+	}
+	defer archive.Close()
+	file, err := os.Create(out)
+	if err != nil {
+		cmd.Printf("create archive failed err:%v\n", err)
+		return
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, archive); err != nil {
+		cmd.Printf("write archive failed err:%v\n", err)
+		return
+	}
+	cmd.Printf("project %d exported to %s\n", pid, out)
+}
+
+func ImportProject(cmd *cobra.Command, args []string) {
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	conflict, err := cmd.Flags().GetString("conflict")
+	if err != nil {
+		cmd.Printf("get conflict failed err:%v\n", err)
+		return
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		cmd.Printf("open archive failed err:%v\n", err)
+		return
+	}
+	defer file.Close()
+
+	project, err := cli.ImportProject(file, conflict)
+	if err != nil {
+		cmd.Printf("import project failed err:%v\n", err)
+		return
+	}
+	cmd.Printf("project %s imported, id:%d\n", project.Name, project.ID)
+}
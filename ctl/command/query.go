@@ -0,0 +1,112 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"fmt"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/client"
+	"github.com/spf13/cobra"
+)
+
+// NewQueryCommand return a query subcommand of rootCmd
+func NewQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query",
+		Short: "query the metrics of the workload across sessions or projects",
+		Run:   QueryMetrics,
+	}
+	cmd.Flags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	cmd.Flags().UintSliceP("session_id", "i", nil, "session ids")
+	cmd.Flags().UintP("project_id", "P", 0, "project id, all its sessions are queried")
+	cmd.Flags().StringP("workload", "w", "", "workload name, required")
+	cmd.Flags().StringSliceP("metrics", "m", nil, "metrics keys, e.g. tikv_cpu_avg")
+	cmd.Flags().Int64("start", 0, "start unix timestamp")
+	cmd.Flags().Int64("end", 0, "end unix timestamp")
+	return cmd
+}
+
+func QueryMetrics(cmd *cobra.Command, args []string) {
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	sessionIDs, err := cmd.Flags().GetUintSlice("session_id")
+	if err != nil {
+		cmd.Printf("get session id failed err:%v\n", err)
+		return
+	}
+	projectID, err := cmd.Flags().GetUint("project_id")
+	if err != nil {
+		cmd.Printf("get project id failed err:%v\n", err)
+		return
+	}
+	if len(sessionIDs) == 0 && projectID == 0 {
+		cmd.Println("session id or project id is required")
+		return
+	}
+	workload, err := cmd.Flags().GetString("workload")
+	if err != nil || workload == "" {
+		cmd.Println("workload is required")
+		return
+	}
+	keys, err := cmd.Flags().GetStringSlice("metrics")
+	if err != nil || len(keys) == 0 {
+		cmd.Println("metrics is required")
+		return
+	}
+	start, err := cmd.Flags().GetInt64("start")
+	if err != nil {
+		cmd.Printf("get start failed err:%v\n", err)
+		return
+	}
+	end, err := cmd.Flags().GetInt64("end")
+	if err != nil {
+		cmd.Printf("get end failed err:%v\n", err)
+		return
+	}
+
+	q := client.MetricsQuery{SessionIDs: sessionIDs, ProjectID: projectID, Workload: workload, Metrics: keys}
+	if start > 0 {
+		q.Start = time.Unix(start, 0)
+	}
+	if end > 0 {
+		q.End = time.Unix(end, 0)
+	}
+	result, err := cli.QueryMetrics(q)
+	if err != nil {
+		cmd.Printf("query metrics failed err:%v\n", err)
+		return
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "session\tmetrics\tindex\tworkload_id\tstart\tvalue")
+	for _, s := range result {
+		names := make([]string, 0, len(s.Metrics))
+		for k := range s.Metrics {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			for _, p := range s.Metrics[k] {
+				fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%.4f\n", s.SessionID, k, p.Index, p.WID, p.Start.Format(time.RFC3339), p.Value)
+			}
+		}
+	}
+	w.Flush()
+}
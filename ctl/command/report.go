@@ -15,45 +15,24 @@ package command
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
-	"gonum.org/v1/gonum/stat"
-
+	"github.com/bufferflies/pd-analyze/bench"
+	"github.com/bufferflies/pd-analyze/client"
 	"github.com/bufferflies/pd-analyze/core"
 
 	"github.com/bufferflies/pd-analyze/repository"
 	"github.com/spf13/cobra"
 )
 
-var (
-	dialClient = &http.Client{}
-	metrics    = map[string]string{
-		// tikv metrics
-		"tikv_cpu": "sum(rate(tikv_thread_cpu_seconds_total{}[1m])) by (instance)",
-
-		// pd metrics
-		"store_write_rate_bytes": "pd_scheduler_store_status{ type=\"store_write_rate_bytes\"}",
-		"store_write_rate_keys":  "pd_scheduler_store_status{type=\"store_write_rate_keys\"}",
-		"store_write_query":      "pd_scheduler_store_status{type=\"store_write_query_rate\"}",
-
-		"store_read_rate_bytes": "pd_scheduler_store_status{ type=\"store_read_rate_bytes\"}",
-		"store_read_rate_keys":  "pd_scheduler_store_status{type=\"store_read_rate_keys\"}",
-		"store_read_query":      "pd_scheduler_store_status{type=\"store_read_query_rate\"}",
-
-		//tidb
-		"tidb_duration_P999": "histogram_quantile(0.999, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
-		"tidb_duration_P99":  "histogram_quantile(0.99, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
-		"tidb_duration_P95":  "histogram_quantile(0.95, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
-		"tidb_duration_P80":  "histogram_quantile(0.80, sum(rate(tidb_server_handle_query_duration_seconds_bucket{}[1m])) by (le))*1000",
-
-		"tidb_command_per_second": "sum(rate(tidb_server_query_total{}[1m])) by (result)",
-	}
-)
+var dialClient = &http.Client{}
 
 type ReportConfig struct {
 	prometheus string
@@ -80,30 +59,39 @@ func NewReportCommand() *cobra.Command {
 		Short: "report record to analyze",
 		Run:   Report,
 	}
+	reportFlags(cmd)
+	return cmd
+}
+
+// reportFlags adds the flags Report reads.
+func reportFlags(cmd *cobra.Command) {
 	cmd.Flags().StringP("server", "s", "http://localhost:8080", "analyze server address")
 	cmd.Flags().StringP("name", "n", "test", "bench name")
 	cmd.Flags().Uint32P("session_id", "i", 1, "session id")
 	cmd.Flags().StringP("data", "d", "time.log", "record log path")
 	cmd.Flags().StringP("prometheus", "p", "localhost:9090", "prometheus address ")
-	return cmd
+	cmd.Flags().StringArrayP("label", "l", nil, "bench run label in k=v, can be repeated")
+	cmd.Flags().StringP("out", "o", "", "save the records to the local directory instead of the server")
+	cmd.Flags().String("upload", "", "upload the records of the bench saved in the local directory")
+	cmd.Flags().Bool("raw", false, "also report the downsampled raw series of the metrics")
+	cmd.Flags().Int("raw_points", 120, "max samples of every raw series")
+	cmd.Flags().String("pd", "", "pd address to snapshot config from, e.g. http://127.0.0.1:2379")
+	cmd.Flags().String("bench_output", "", "directory of the <workload>.out stdout of the bench tools, parsed into the metrics")
+	cmd.Flags().String("bench_tool", "", "tool of the bench output, one of "+strings.Join(bench.Tools(), ", ")+", detected from the bench command if empty")
 }
 
 func Report(cmd *cobra.Command, args []string) {
+	report(cmd, nil)
+}
+
+// report applies the metrics of the records and saves them, nil records are read from the record log.
+func report(cmd *cobra.Command, records []repository.Record) {
 	prometheus, err := cmd.Flags().GetString("prometheus")
 	if err != nil {
 		cmd.Printf("get session id  err:%v", err)
 		return
 	}
 	config := newReportConfig(prometheus)
-	path, err := cmd.Flags().GetString("data")
-	if err != nil {
-		cmd.Printf("data can not nil:%v", err)
-		return
-	}
-	if config.records, err = ReadFile(path); err != nil {
-		cmd.Printf("read file failed err:%v", err)
-		return
-	}
 
 	if config.server, err = cmd.Flags().GetString("server"); err != nil {
 		cmd.Printf("get analyze address failed err:%v", err)
@@ -120,57 +108,257 @@ func Report(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	url := fmt.Sprintf("%s/tools/%d/%s", config.server, config.sessionId, config.name)
-	cmd.Println(url)
-	for i := range config.records {
-		config.records[i].Metrics = make(map[string]float64)
-		if err := config.check(&config.records[i]); err != nil {
-			cmd.Println(err.Error())
+	labels, err := cmd.Flags().GetStringArray("label")
+	if err != nil {
+		cmd.Printf("get labels failed err:%v", err)
+		return
+	}
+	benchLabels, err := repository.ParseLabels(labels)
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+
+	upload, err := cmd.Flags().GetString("upload")
+	if err != nil {
+		cmd.Printf("get upload directory failed err:%v", err)
+		return
+	}
+	if upload != "" {
+		local, err := repository.NewFileStorage(upload)
+		if err != nil {
+			cmd.Printf("open local storage failed err:%v", err)
 			return
 		}
+		if config.records, err = local.Get(config.name); err != nil {
+			cmd.Printf("read local records failed err:%v", err)
+			return
+		}
+	} else if err := config.collect(cmd, records); err != nil {
+		cmd.Println(err.Error())
+		return
 	}
-	body, err := json.Marshal(config.records)
+
+	out, err := cmd.Flags().GetString("out")
 	if err != nil {
-		cmd.Printf("json marshal failed err:%v", err)
+		cmd.Printf("get out directory failed err:%v", err)
 		return
 	}
-	rsp, err := dialClient.Post(url, "application/json", bytes.NewBuffer(body))
+	var storage recordSaver = &remoteStorage{client: client.NewClient(config.server, client.WithToken(apiToken)), sessionID: config.sessionId, labels: labels}
+	if out != "" {
+		if storage, err = repository.NewFileStorage(out); err != nil {
+			cmd.Printf("open local storage failed err:%v", err)
+			return
+		}
+		// the file has no bench run labels, so every record keeps them to be uploaded later
+		config.records = withLabels(config.records, benchLabels)
+	}
+	if err := storage.Save(config.name, config.records); err != nil {
+		cmd.Println(err.Error())
+	}
+}
+
+// collect applies the metrics of every workload of the records, nil records are read from the record log.
+func (config *ReportConfig) collect(cmd *cobra.Command, records []repository.Record) error {
+	config.records = records
+	if records == nil {
+		path, err := cmd.Flags().GetString("data")
+		if err != nil {
+			return fmt.Errorf("data can not nil:%v", err)
+		}
+		if config.records, err = ReadFile(path); err != nil {
+			return fmt.Errorf("read file failed err:%v", err)
+		}
+	}
+
+	pd, err := cmd.Flags().GetString("pd")
 	if err != nil {
-		cmd.Print("request send failed err:%v", err)
-		return
+		return fmt.Errorf("get pd address failed err:%v", err)
 	}
-	if rsp.StatusCode != http.StatusOK {
-		cmd.Printf("response is not ok code:%d", rsp.StatusCode)
+	if pd != "" {
+		pdConfig, err := getPDConfig(pd)
+		if err != nil {
+			return fmt.Errorf("get pd config failed err:%v", err)
+		}
+		for i := range config.records {
+			if config.records[i].Config == "" {
+				config.records[i].Config = pdConfig
+			}
+		}
 	}
-	return
 
+	if err := config.parseOutputs(cmd); err != nil {
+		return err
+	}
+	for i := range config.records {
+		if err := config.check(&config.records[i]); err != nil {
+			return err
+		}
+	}
+
+	raw, err := cmd.Flags().GetBool("raw")
+	if err != nil {
+		return fmt.Errorf("get raw failed err:%v", err)
+	}
+	if !raw {
+		return nil
+	}
+	points, err := cmd.Flags().GetInt("raw_points")
+	if err != nil {
+		return fmt.Errorf("get raw points failed err:%v", err)
+	}
+	for i := range config.records {
+		if err := config.collectSeries(&config.records[i], points); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (config *ReportConfig) check(records *repository.Record) error {
+// collectSeries queries the raw series of every metrics in the workload window.
+func (config *ReportConfig) collectSeries(record *repository.Record, points int) error {
 	source := core.NewPrometheus(config.prometheus)
-	checker := core.NewChecker(source)
-	records.Metrics = make(map[string]float64)
-	for name, metrics := range metrics {
-		d, err := checker.Apply(records.Start, records.End, name, metrics, fmt.Sprintf("mean(%s)", name))
+	record.Series = make([]repository.Series, 0)
+	for name, metrics := range core.Catalog {
+		data, err := source.Range(metrics, record.Start, record.End, points)
 		if err != nil {
 			return err
 		}
-		data := d.([]float64)
+		if data == nil {
+			return fmt.Errorf("query %s failed", name)
+		}
+		for _, r := range data.Result {
+			series := repository.Series{
+				Name:       name,
+				Labels:     r.Metric,
+				Timestamps: make([]int64, 0, len(r.Values)),
+				Values:     make([]float64, 0, len(r.Values)),
+			}
+			for _, v := range r.Values {
+				ts, ok := v[0].(float64)
+				if !ok {
+					continue
+				}
+				value, err := strconv.ParseFloat(fmt.Sprint(v[1]), 64)
+				if err != nil {
+					continue
+				}
+				series.Timestamps = append(series.Timestamps, int64(ts))
+				series.Values = append(series.Values, value)
+			}
+			record.Series = append(record.Series, series)
+		}
+	}
+	return nil
+}
 
-		mean, std := stat.MeanStdDev(data, nil)
-		if strings.HasPrefix(name, "tidb") {
-			records.Metrics[name] = mean
-		} else {
-			records.Metrics[strings.Join([]string{name, "avg"}, "_")] = mean
-			records.Metrics[strings.Join([]string{name, "std"}, "_")] = std
-			if mean != 0 {
-				records.Metrics[strings.Join([]string{name, "std/avg"}, "_")] = std / mean
+// recordSaver is the part of repository.Storage that report persists the records with.
+type recordSaver interface {
+	Save(id string, records []repository.Record) error
+}
+
+// remoteStorage saves the records to the analyze server.
+type remoteStorage struct {
+	client    *client.Client
+	sessionID uint32
+	labels    []string
+}
+
+func (r *remoteStorage) Save(id string, records []repository.Record) error {
+	return r.client.SaveRecords(uint(r.sessionID), id, records, r.labels)
+}
+
+// withLabels adds the labels of the bench run to every record, the own labels of the record win like the
+// server merges them.
+func withLabels(records []repository.Record, labels map[string]string) []repository.Record {
+	if len(labels) == 0 {
+		return records
+	}
+	for i := range records {
+		merged := make(map[string]string, len(labels)+len(records[i].Labels))
+		for k, v := range labels {
+			merged[k] = v
+		}
+		for k, v := range records[i].Labels {
+			merged[k] = v
+		}
+		records[i].Labels = merged
+	}
+	return records
+}
+
+// parseOutputs adds the metrics parsed from the stdout of the bench tool of every workload.
+func (config *ReportConfig) parseOutputs(cmd *cobra.Command) error {
+	dir, err := cmd.Flags().GetString("bench_output")
+	if err != nil {
+		return fmt.Errorf("get bench output failed err:%v", err)
+	}
+	if dir == "" {
+		return nil
+	}
+	tool, err := cmd.Flags().GetString("bench_tool")
+	if err != nil {
+		return fmt.Errorf("get bench tool failed err:%v", err)
+	}
+	for i := range config.records {
+		record := &config.records[i]
+		output, err := ioutil.ReadFile(filepath.Join(dir, record.Workload+".out"))
+		if os.IsNotExist(err) {
+			cmd.Printf("workload %s has no bench output\n", record.Workload)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		t := tool
+		if t == "" {
+			if t = bench.DetectTool(record.Cmd); t == "" {
+				return fmt.Errorf("tool of workload %s can not be detected from the command, set bench_tool", record.Workload)
 			}
 		}
+		metrics, err := bench.ParseOutput(t, output)
+		if err != nil {
+			return fmt.Errorf("parse bench output of workload %s failed err:%v", record.Workload, err)
+		}
+		if record.Metrics == nil {
+			record.Metrics = make(map[string]float64, len(metrics))
+		}
+		for k, v := range metrics {
+			record.Metrics[k] = v
+		}
 	}
 	return nil
 }
 
+// check adds the summary of the prometheus metrics, the metrics parsed from the bench output are kept.
+func (config *ReportConfig) check(records *repository.Record) error {
+	metrics, err := core.Summarize(config.checker, core.Catalog, records.Start, records.End)
+	if err != nil {
+		return err
+	}
+	for k, v := range records.Metrics {
+		metrics[k] = v
+	}
+	records.Metrics = metrics
+	return nil
+}
+
+func getPDConfig(pd string) (string, error) {
+	rsp, err := dialClient.Get(strings.TrimSuffix(pd, "/") + "/pd/api/v1/config")
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("response is not ok code:%d", rsp.StatusCode)
+	}
+	return string(body), nil
+}
+
 func ReadFile(path string) ([]repository.Record, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -189,3 +377,20 @@ func ReadFile(path string) ([]repository.Record, error) {
 	}
 	return result, nil
 }
+
+// AppendFile appends the record as a json line which ReadFile reads.
+func AppendFile(path string, record repository.Record) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(record); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
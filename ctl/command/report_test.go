@@ -0,0 +1,36 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportOutLabels(t *testing.T) {
+	as := assert.New(t)
+	in, out := t.TempDir(), t.TempDir()
+	local, err := repository.NewFileStorage(in)
+	as.NoError(err)
+	as.NoError(local.Save("tpcc", []repository.Record{
+		{Workload: "w1", Start: "1634479813", End: "1634479873"},
+		{Workload: "w2", Start: "1634479873", End: "1634479933", Labels: map[string]string{"pr": "2"}},
+	}))
+
+	// the records saved locally carry the labels of the bench run, so the later upload keeps them.
+	cmd := NewReportCommand()
+	var buf bytes.Buffer
+	cmd.SetOut(&buf)
+	cmd.SetArgs([]string{"-n", "tpcc", "--upload", in, "--out", out, "-l", "pr=1", "-l", "tables=16"})
+	as.NoError(cmd.Execute())
+	as.Empty(buf.String())
+
+	saved, err := repository.NewFileStorage(out)
+	as.NoError(err)
+	records, err := saved.Get("tpcc")
+	as.NoError(err)
+	as.Len(records, 2)
+	as.Equal(map[string]string{"pr": "1", "tables": "16"}, records[0].Labels)
+	as.Equal(map[string]string{"pr": "2", "tables": "16"}, records[1].Labels)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"context"
+
+	"github.com/bufferflies/pd-analyze/bench"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/spf13/cobra"
+)
+
+// NewRunCommand return a run subcommand of rootCmd
+func NewRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run <plan.yaml>",
+		Short: "run the workloads of the plan in order and append their records to the record log as they finish",
+		Args:  cobra.ExactArgs(1),
+		Run:   RunPlan,
+	}
+	reportFlags(cmd)
+	cmd.Flags().String("out_dir", "", "save the stdout of every workload as <workload>.out in the directory")
+	cmd.Flags().Bool("report", false, "report the records of the plan after all workloads finished, the bench name is the plan name by default")
+	return cmd
+}
+
+func RunPlan(cmd *cobra.Command, args []string) {
+	plan, err := bench.ReadPlan(args[0])
+	if err != nil {
+		cmd.Printf("read plan failed err:%v\n", err)
+		return
+	}
+	path, err := cmd.Flags().GetString("data")
+	if err != nil {
+		cmd.Printf("get record log path failed err:%v\n", err)
+		return
+	}
+	withReport, err := cmd.Flags().GetBool("report")
+	if err != nil {
+		cmd.Printf("get report failed err:%v\n", err)
+		return
+	}
+	runner := bench.NewRunner(plan)
+	runner.Log = cmd.OutOrStdout()
+	if runner.OutDir, err = cmd.Flags().GetString("out_dir"); err != nil {
+		cmd.Printf("get out dir failed err:%v\n", err)
+		return
+	}
+	runner.Record = func(record repository.Record) error {
+		return AppendFile(path, record)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// the finished workloads are recorded on the cancellation of the command context instead of exiting
+	defer runGraceful()()
+	records, err := runner.Run(ctx)
+	cmd.Printf("%d of %d workloads recorded in %s\n", len(records), len(plan.Workloads), path)
+	if err != nil {
+		cmd.Printf("run plan failed err:%v\n", err)
+		return
+	}
+	if !withReport {
+		return
+	}
+	if plan.Name != "" && !cmd.Flags().Changed("name") {
+		if err := cmd.Flags().Set("name", plan.Name); err != nil {
+			cmd.Printf("set bench name failed err:%v\n", err)
+			return
+		}
+	}
+	report(cmd, records)
+}
@@ -14,7 +14,9 @@
 package command
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	config2 "github.com/bufferflies/pd-analyze/config"
 	"github.com/bufferflies/pd-analyze/server"
@@ -31,6 +33,19 @@ func NewServerCommand() *cobra.Command {
 	cmd.PersistentFlags().StringP("listen_address", "a", "localhost:8080", "analyze listen address")
 	cmd.PersistentFlags().StringP("prometheus_address", "p", "http://172.16.4.3:22815/", "address of prometheus")
 	cmd.PersistentFlags().StringP("storage_address", "s", "172.16.4.4:3306", "storage address")
+	cmd.PersistentFlags().String("archive_directory", "archive", "directory of the runs archived by retention")
+	cmd.PersistentFlags().Duration("retention_interval", time.Hour, "interval of the retention janitor, 0 disables it")
+	cmd.PersistentFlags().String("token_file", "", "json file of the static api tokens, auth is enabled if it or token_db is set")
+	cmd.PersistentFlags().Bool("token_db", false, "enable the api tokens stored in the database")
+	cmd.PersistentFlags().StringSlice("cors_origins", nil, "allowed CORS origins, empty allows any origin")
+	cmd.PersistentFlags().Duration("read_timeout", 30*time.Second, "timeout of reading the request")
+	cmd.PersistentFlags().Duration("write_timeout", 5*time.Minute, "timeout of writing the response, the live streams are exempt")
+	cmd.PersistentFlags().Duration("shutdown_timeout", 30*time.Second, "timeout of draining the in-flight requests on shutdown")
+	cmd.PersistentFlags().Duration("drain_delay", 10*time.Second, "delay between failing the readiness probe and closing the listener on shutdown, drain_delay plus shutdown_timeout should be shorter than the grace period of the pod")
+	cmd.PersistentFlags().Int("webhook_retries", 3, "retries of the failed webhook deliveries")
+	cmd.PersistentFlags().Float64("regression_threshold", 0.1, "ratio of the metric delta versus baseline reported as regression, 0 disables it")
+	cmd.PersistentFlags().Duration("proxy_timeout", 30*time.Second, "timeout of the proxied requests")
+	cmd.PersistentFlags().Int64("proxy_max_body_size", 32<<20, "max bytes of the proxied request and response body")
 	return cmd
 }
 
@@ -38,10 +53,37 @@ func RunServer(cmd *cobra.Command, args []string) {
 	config := GetConfig(cmd)
 	server := server.NewServer(config)
 	router := server.CreateRoute()
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go server.RunJanitor(ctx)
+	go server.RunNotifier(ctx)
+
+	srv := &http.Server{
+		Addr:        config.ListenAddress,
+		Handler:     router,
+		ReadTimeout: config.ReadTimeout,
+		// the write timeout is set per request, so the live streams are not cut off
+		ConnContext: server.ConnContext,
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		if err := server.Shutdown(srv); err != nil {
+			cmd.Printf("server shutdown failed err:%v\n", err)
+		}
+	}()
+	// the server drains on the cancellation of the command context instead of exiting
+	defer runGraceful()()
 	cmd.Printf("server start %v", config)
-	if err := http.ListenAndServe(config.ListenAddress, router); err != nil {
-		cmd.Print("server run failed ")
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		cmd.Printf("server run failed err:%v\n", err)
+		return
 	}
+	<-drained
+	cmd.Println("server stopped")
 }
 
 func GetConfig(cmd *cobra.Command) *config2.Config {
@@ -57,5 +99,44 @@ func GetConfig(cmd *cobra.Command) *config2.Config {
 	if config.PrometheusAddress, err = cmd.Flags().GetString("prometheus_address"); err != nil {
 		cmd.Printf("address failed, err:%v", err)
 	}
+	if config.ArchiveDirectory, err = cmd.Flags().GetString("archive_directory"); err != nil {
+		cmd.Printf("archive directory failed, err:%v", err)
+	}
+	if config.RetentionInterval, err = cmd.Flags().GetDuration("retention_interval"); err != nil {
+		cmd.Printf("retention interval failed, err:%v", err)
+	}
+	if config.TokenFile, err = cmd.Flags().GetString("token_file"); err != nil {
+		cmd.Printf("token file failed, err:%v", err)
+	}
+	if config.TokenDB, err = cmd.Flags().GetBool("token_db"); err != nil {
+		cmd.Printf("token db failed, err:%v", err)
+	}
+	if config.AllowOrigins, err = cmd.Flags().GetStringSlice("cors_origins"); err != nil {
+		cmd.Printf("cors origins failed, err:%v", err)
+	}
+	if config.ReadTimeout, err = cmd.Flags().GetDuration("read_timeout"); err != nil {
+		cmd.Printf("read timeout failed, err:%v", err)
+	}
+	if config.WriteTimeout, err = cmd.Flags().GetDuration("write_timeout"); err != nil {
+		cmd.Printf("write timeout failed, err:%v", err)
+	}
+	if config.ShutdownTimeout, err = cmd.Flags().GetDuration("shutdown_timeout"); err != nil {
+		cmd.Printf("shutdown timeout failed, err:%v", err)
+	}
+	if config.DrainDelay, err = cmd.Flags().GetDuration("drain_delay"); err != nil {
+		cmd.Printf("drain delay failed, err:%v", err)
+	}
+	if config.WebhookRetries, err = cmd.Flags().GetInt("webhook_retries"); err != nil {
+		cmd.Printf("webhook retries failed, err:%v", err)
+	}
+	if config.RegressionThreshold, err = cmd.Flags().GetFloat64("regression_threshold"); err != nil {
+		cmd.Printf("regression threshold failed, err:%v", err)
+	}
+	if config.ProxyTimeout, err = cmd.Flags().GetDuration("proxy_timeout"); err != nil {
+		cmd.Printf("proxy timeout failed, err:%v", err)
+	}
+	if config.ProxyMaxBodySize, err = cmd.Flags().GetInt64("proxy_max_body_size"); err != nil {
+		cmd.Printf("proxy max body size failed, err:%v", err)
+	}
 	return &config
 }
@@ -0,0 +1,176 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/spf13/cobra"
+)
+
+// NewSessionCommand return a session subcommand of rootCmd
+func NewSessionCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session <subcommand>",
+		Short: "session commands",
+	}
+	cmd.PersistentFlags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	list := &cobra.Command{
+		Use:   "list <project_id>",
+		Short: "list the sessions of the project",
+		Args:  cobra.ExactArgs(1),
+		Run:   ListSessions,
+	}
+	get := &cobra.Command{
+		Use:   "get <session_id>",
+		Short: "get the session",
+		Args:  cobra.ExactArgs(1),
+		Run:   GetSession,
+	}
+	compare := &cobra.Command{
+		Use:   "compare <session_id> <other_id>",
+		Short: "compare the addresses, objectives and dashboards of two sessions",
+		Args:  cobra.ExactArgs(2),
+		Run:   CompareSessions,
+	}
+	for _, c := range []*cobra.Command{list, get, compare} {
+		outputFlag(c)
+	}
+	cmd.AddCommand(list, get, compare, &cobra.Command{
+		Use:   "delete <session_id>",
+		Short: "delete the session with its workloads",
+		Args:  cobra.ExactArgs(1),
+		Run:   DeleteSession,
+	})
+	return cmd
+}
+
+func sessionRows(sessions ...repository.Session) [][]string {
+	rows := make([][]string, 0, len(sessions))
+	for _, s := range sessions {
+		rows = append(rows, []string{formatID(s.ID), formatID(s.PID), s.Name, s.Description, s.PromAddress, formatTime(s.CreatedAt)})
+	}
+	return rows
+}
+
+var sessionHeader = []string{"id", "project_id", "name", "description", "prometheus", "created"}
+
+func ListSessions(cmd *cobra.Command, args []string) {
+	pid, err := argID(args, 0, "project id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	sessions, err := cli.GetSessions(pid)
+	if err != nil {
+		cmd.Printf("list sessions failed err:%v\n", err)
+		return
+	}
+	if err := printOutput(cmd, sessions, sessionHeader, sessionRows(sessions...)); err != nil {
+		cmd.Printf("print sessions failed err:%v\n", err)
+	}
+}
+
+func GetSession(cmd *cobra.Command, args []string) {
+	sid, err := argID(args, 0, "session id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	session, err := cli.GetSession(sid)
+	if err != nil {
+		cmd.Printf("get session failed err:%v\n", err)
+		return
+	}
+	if err := printOutput(cmd, session, sessionHeader, sessionRows(session)); err != nil {
+		cmd.Printf("print session failed err:%v\n", err)
+	}
+}
+
+func CompareSessions(cmd *cobra.Command, args []string) {
+	sessions := make([]repository.Session, 2)
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	snapshots := make([]string, 2)
+	for i := range sessions {
+		sid, err := argID(args, i, "session id")
+		if err != nil {
+			cmd.Println(err.Error())
+			return
+		}
+		if sessions[i], err = cli.GetSession(sid); err != nil {
+			cmd.Printf("get session failed err:%v\n", err)
+			return
+		}
+		// the identity of the sessions always differs
+		snapshot := sessions[i]
+		snapshot.ID, snapshot.CreatedAt, snapshot.UpdatedAt = 0, time.Time{}, time.Time{}
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			cmd.Printf("marshal session failed err:%v\n", err)
+			return
+		}
+		snapshots[i] = string(data)
+	}
+	changes, err := core.DiffConfig(snapshots[0], snapshots[1])
+	if err != nil {
+		cmd.Printf("compare sessions failed err:%v\n", err)
+		return
+	}
+	if err := printOutput(cmd, changes, []string{"field", "change", args[0], args[1]}, changeRows(changes)); err != nil {
+		cmd.Printf("print changes failed err:%v\n", err)
+	}
+}
+
+func changeRows(changes []core.ConfigChange) [][]string {
+	rows := make([][]string, 0, len(changes))
+	for _, c := range changes {
+		rows = append(rows, []string{c.Path, changeSign(c.Type), toJSON(c.Old), toJSON(c.New)})
+	}
+	return rows
+}
+
+func DeleteSession(cmd *cobra.Command, args []string) {
+	sid, err := argID(args, 0, "session id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	if err := cli.DeleteSession(sid); err != nil {
+		cmd.Printf("delete session failed err:%v\n", err)
+		return
+	}
+	cmd.Printf("session %d deleted\n", sid)
+}
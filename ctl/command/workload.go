@@ -0,0 +1,217 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package command
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/client"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/spf13/cobra"
+)
+
+// NewWorkloadCommand return a workload subcommand of rootCmd
+func NewWorkloadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workload <subcommand>",
+		Short: "workload commands",
+	}
+	cmd.PersistentFlags().StringP("server", "s", "http://localhost:8080", "analyze server address")
+	list := &cobra.Command{
+		Use:   "list <session_id>",
+		Short: "list the workloads of the session, the latest first",
+		Args:  cobra.ExactArgs(1),
+		Run:   ListWorkloads,
+	}
+	list.Flags().StringP("workload", "w", "", "workload name")
+	list.Flags().StringP("version", "v", "", "pd version")
+	list.Flags().StringSliceP("label", "l", nil, "label selectors like key=value")
+	list.Flags().Int("page", 1, "page number")
+	list.Flags().Int("size", 20, "page size")
+	get := &cobra.Command{
+		Use:   "get <workload_id>",
+		Short: "get the workload with its metrics and labels",
+		Args:  cobra.ExactArgs(1),
+		Run:   GetWorkload,
+	}
+	compare := &cobra.Command{
+		Use:   "compare <workload_id> <other_id>",
+		Short: "compare the config and metrics of two workloads",
+		Args:  cobra.ExactArgs(2),
+		Run:   CompareWorkloads,
+	}
+	for _, c := range []*cobra.Command{list, get, compare} {
+		outputFlag(c)
+	}
+	cmd.AddCommand(list, get, compare, &cobra.Command{
+		Use:   "delete <workload_id>",
+		Short: "delete the workload with its metrics",
+		Args:  cobra.ExactArgs(1),
+		Run:   DeleteWorkload,
+	})
+	return cmd
+}
+
+var workloadHeader = []string{"id", "session_id", "bench", "name", "version", "start", "end", "baseline"}
+
+func workloadRow(w repository.Workload) []string {
+	baseline := ""
+	if w.Baseline {
+		baseline = "yes"
+	}
+	return []string{formatID(w.ID), formatID(w.SessionID), w.BenchName, w.Name, w.Version, formatTime(w.Start), formatTime(w.End), baseline}
+}
+
+func ListWorkloads(cmd *cobra.Command, args []string) {
+	sid, err := argID(args, 0, "session id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	var q client.WorkloadQuery
+	if q.Workload, err = cmd.Flags().GetString("workload"); err != nil {
+		cmd.Printf("get workload failed err:%v\n", err)
+		return
+	}
+	if q.Version, err = cmd.Flags().GetString("version"); err != nil {
+		cmd.Printf("get version failed err:%v\n", err)
+		return
+	}
+	if q.Labels, err = cmd.Flags().GetStringSlice("label"); err != nil {
+		cmd.Printf("get label failed err:%v\n", err)
+		return
+	}
+	if q.Page, err = cmd.Flags().GetInt("page"); err != nil {
+		cmd.Printf("get page failed err:%v\n", err)
+		return
+	}
+	if q.Size, err = cmd.Flags().GetInt("size"); err != nil {
+		cmd.Printf("get size failed err:%v\n", err)
+		return
+	}
+	page, err := cli.GetWorkloads(sid, q)
+	if err != nil {
+		cmd.Printf("list workloads failed err:%v\n", err)
+		return
+	}
+	rows := make([][]string, 0, len(page.Workloads))
+	for _, w := range page.Workloads {
+		rows = append(rows, workloadRow(w))
+	}
+	if err := printOutput(cmd, page, workloadHeader, rows); err != nil {
+		cmd.Printf("print workloads failed err:%v\n", err)
+	}
+}
+
+func GetWorkload(cmd *cobra.Command, args []string) {
+	wid, err := argID(args, 0, "workload id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	load, err := cli.GetWorkload(wid)
+	if err != nil {
+		cmd.Printf("get workload failed err:%v\n", err)
+		return
+	}
+	if err := printOutput(cmd, load, []string{"key", "value"}, workloadDetailRows(load)); err != nil {
+		cmd.Printf("print workload failed err:%v\n", err)
+	}
+}
+
+// workloadDetailRows lists the fields, labels and metrics of the workload as key value rows.
+func workloadDetailRows(load api.WorkloadMetrics) [][]string {
+	rows := make([][]string, 0, len(workloadHeader)+len(load.Labels)+len(load.Metrics)+1)
+	for i, v := range workloadRow(load.Workload) {
+		rows = append(rows, []string{workloadHeader[i], v})
+	}
+	rows = append(rows, []string{"cmd", load.Cmd})
+	labels := make([]string, 0, len(load.Labels))
+	for k := range load.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		rows = append(rows, []string{"label." + k, load.Labels[k]})
+	}
+	metrics := load.MetricsMap()
+	for _, k := range sortedKeys(metrics) {
+		rows = append(rows, []string{"metrics." + k, formatFloat(metrics[k])})
+	}
+	return rows
+}
+
+func CompareWorkloads(cmd *cobra.Command, args []string) {
+	ids := make([]uint, 2)
+	for i := range ids {
+		id, err := argID(args, i, "workload id")
+		if err != nil {
+			cmd.Println(err.Error())
+			return
+		}
+		ids[i] = id
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	diff, err := cli.DiffWorkloads(ids[0], ids[1])
+	if err != nil {
+		cmd.Printf("compare workloads failed err:%v\n", err)
+		return
+	}
+	rows := changeRows(diff.Config)
+	for i := range rows {
+		rows[i] = append([]string{"config"}, rows[i]...)
+		rows[i] = append(rows[i], "")
+	}
+	for _, m := range diff.Metrics {
+		rows = append(rows, []string{"metrics", m.Key, "", formatFloat(m.Old), formatFloat(m.New), formatFloat(m.Ratio*100) + "%"})
+	}
+	header := []string{"kind", "key", "change", strings.Join([]string{diff.Old.Name, args[0]}, "#"), strings.Join([]string{diff.New.Name, args[1]}, "#"), "ratio"}
+	if err := printOutput(cmd, diff, header, rows); err != nil {
+		cmd.Printf("print diff failed err:%v\n", err)
+	}
+}
+
+func DeleteWorkload(cmd *cobra.Command, args []string) {
+	wid, err := argID(args, 0, "workload id")
+	if err != nil {
+		cmd.Println(err.Error())
+		return
+	}
+	cli, err := newClient(cmd)
+	if err != nil {
+		cmd.Printf("get analyze address failed err:%v\n", err)
+		return
+	}
+	if err := cli.DeleteWorkload(wid); err != nil {
+		cmd.Printf("delete workload failed err:%v\n", err)
+		return
+	}
+	cmd.Printf("workload %d deleted\n", wid)
+}
@@ -14,12 +14,15 @@
 package ctl
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 
 	"github.com/bufferflies/pd-analyze/ctl/command"
+	"github.com/bufferflies/pd-analyze/version"
 
 	"github.com/chzyer/readline"
 	"github.com/mattn/go-shellwords"
@@ -38,18 +41,37 @@ func GetRootCmd() *cobra.Command {
 		Short: "Placement Driver Analyze",
 	}
 
-	rootCmd.AddCommand(command.NewReportCommand(), command.NewServerCommand())
+	rootCmd.AddCommand(command.NewReportCommand(), command.NewServerCommand(), command.NewDiffConfigCommand(), command.NewProjectCommand(), command.NewQueryCommand(), command.NewExportCommand(), command.NewRunCommand(), command.NewCheckCommand(),
+		command.NewSessionCommand(), command.NewWorkloadCommand(), command.NewBenchCommand(), command.NewConfigCommand())
+	rootCmd.PersistentFlags().String("token", "", "api token of the analyze server, default is $"+command.TokenEnv)
+	rootCmd.PersistentFlags().String("config", "", "toml config file of the flags, default is $"+command.ConfigEnv)
+	// the flags not set in the command line are read from $ANALYZE_<COMMAND>_<FLAG>, $ANALYZE_<FLAG> and then the config file
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := command.ApplyConfig(cmd); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		token, _ := cmd.Flags().GetString("token")
+		command.SetToken(token)
+		return nil
+	}
 	rootCmd.Flags().ParseErrorsWhitelist.UnknownFlags = true
 	rootCmd.SilenceErrors = true
 	return rootCmd
 }
 
-// MainStart start main command
-func MainStart(args []string) {
+// MainStart start main command, long running commands stop on the cancellation of the context.
+func MainStart(ctx context.Context, args []string) {
 	rootCmd := GetRootCmd()
 	rootCmd.Flags().BoolP("version", "V", false, "Print version information and exit.")
+	rootCmd.Flags().BoolP("interact", "i", false, "Run in the interactive mode with completion.")
 
 	rootCmd.Run = func(cmd *cobra.Command, args []string) {
+		if v, err := cmd.Flags().GetBool("version"); err == nil && v {
+			info := version.GetInfo()
+			cmd.Printf("Version: %s\nGit Commit Hash: %s\nBuild Time: %s\nGo Version: %s\n", info.Version, info.GitHash, info.BuildTime, info.GoVersion)
+			return
+		}
 		if v, err := cmd.Flags().GetBool("interact"); err == nil && v {
 			readlineCompleter := readline.NewPrefixCompleter(genCompleter(cmd)...)
 			loop(cmd.PersistentFlags(), readlineCompleter)
@@ -60,7 +82,11 @@ func MainStart(args []string) {
 	rootCmd.ParseFlags(args)
 	rootCmd.SetOutput(os.Stdout)
 
-	if err := rootCmd.Execute(); err != nil {
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		var exit *command.ExitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.Code)
+		}
 		rootCmd.Println(err)
 		os.Exit(1)
 	}
@@ -117,7 +143,9 @@ func loop(persistentFlags *pflag.FlagSet, readlineCompleter readline.AutoComplet
 		rootCmd := getREPLCmd()
 		rootCmd.SetArgs(args)
 		rootCmd.ParseFlags(args)
-		if err := rootCmd.Execute(); err != nil {
+		// the result of the command exiting with the code is printed already
+		var exit *command.ExitError
+		if err := rootCmd.Execute(); err != nil && !errors.As(err, &exit) {
 			rootCmd.Println(err)
 		}
 	}
@@ -127,16 +155,20 @@ func genCompleter(cmd *cobra.Command) []readline.PrefixCompleterInterface {
 	pc := []readline.PrefixCompleterInterface{}
 
 	for _, v := range cmd.Commands() {
+		children := genCompleter(v)
+		if complete := command.IDCompleter(v); complete != nil {
+			children = append(children, readline.PcItemDynamic(complete))
+		}
 		if v.HasFlags() {
 			flagsPc := []readline.PrefixCompleterInterface{}
 			flagUsages := strings.Split(strings.Trim(v.Flags().FlagUsages(), " "), "\n")
 			for i := 0; i < len(flagUsages)-1; i++ {
 				flagsPc = append(flagsPc, readline.PcItem(strings.Split(strings.Trim(flagUsages[i], " "), " ")[0]))
 			}
-			flagsPc = append(flagsPc, genCompleter(v)...)
+			flagsPc = append(flagsPc, children...)
 			pc = append(pc, readline.PcItem(strings.Split(v.Use, " ")[0], flagsPc...))
 		} else {
-			pc = append(pc, readline.PcItem(strings.Split(v.Use, " ")[0], genCompleter(v)...))
+			pc = append(pc, readline.PcItem(strings.Split(v.Use, " ")[0], children...))
 		}
 	}
 	return pc
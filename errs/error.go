@@ -1,8 +1,111 @@
 package errs
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm"
+)
 
 var (
 	Argument_Not_Match = errors.New("argument not match")
 	Result_Not_Match   = errors.New("result not match")
 )
+
+type Code string
+
+const (
+	CodeInvalidArgument Code = "invalid_argument"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeUnauthenticated Code = "unauthenticated"
+	CodeForbidden       Code = "forbidden"
+	CodeBadGateway      Code = "bad_gateway"
+	CodeInternal        Code = "internal"
+)
+
+// Error is the typed error returned to the api clients.
+type Error struct {
+	Code    Code
+	Message string
+	Details interface{}
+	Cause   error
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithDetails attaches the details to the error.
+func (e *Error) WithDetails(details interface{}) *Error {
+	e.Details = details
+	return e
+}
+
+func InvalidArgument(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeInvalidArgument, Message: fmt.Sprintf(format, args...)}
+}
+
+func NotFound(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+func Conflict(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeConflict, Message: fmt.Sprintf(format, args...)}
+}
+
+func Unauthenticated(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeUnauthenticated, Message: fmt.Sprintf(format, args...)}
+}
+
+func Forbidden(format string, args ...interface{}) *Error {
+	return &Error{Code: CodeForbidden, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap wraps the cause with the code.
+func Wrap(code Code, cause error, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...), Cause: cause}
+}
+
+// Convert returns the typed error of err, unknown errors are internal.
+func Convert(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, Argument_Not_Match):
+		return &Error{Code: CodeInvalidArgument, Message: err.Error()}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &Error{Code: CodeNotFound, Message: err.Error()}
+	default:
+		return &Error{Code: CodeInternal, Message: err.Error()}
+	}
+}
+
+// StatusCode returns the http status of the code.
+func (c Code) StatusCode() int {
+	switch c {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeBadGateway:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -3,16 +3,20 @@ module github.com/bufferflies/pd-analyze
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/Knetic/govaluate v3.0.0+incompatible
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e
 	github.com/gorilla/mux v1.8.0
 	github.com/mattn/go-shellwords v1.0.12
 	github.com/pingcap/log v0.0.0-20210906054005-afc726e70354
+	github.com/prometheus/client_golang v1.11.1
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.7.0
 	go.uber.org/zap v1.19.0
 	gonum.org/v1/gonum v0.9.3
+	gopkg.in/yaml.v2 v2.4.0
 	gorm.io/driver/mysql v1.1.2
 	gorm.io/gorm v1.21.14
 )
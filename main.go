@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,14 +10,10 @@ import (
 	"syscall"
 
 	"github.com/bufferflies/pd-analyze/ctl"
+	"github.com/bufferflies/pd-analyze/ctl/command"
 )
 
 func main() {
-	pdAddr := os.Getenv("PD_ADDR")
-	if pdAddr != "" {
-		os.Args = append(os.Args, "-u", pdAddr)
-	}
-
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc,
 		syscall.SIGHUP,
@@ -24,9 +21,16 @@ func main() {
 		syscall.SIGTERM,
 		syscall.SIGQUIT)
 
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		sig := <-sc
 		fmt.Printf("\nGot signal [%v] to exit.\n", sig)
+		cancel()
+		if command.Graceful() && (sig == syscall.SIGTERM || sig == syscall.SIGINT) {
+			// the server drains the in-flight requests and run records the finished workloads before
+			// returning, a second signal forces the exit.
+			sig = <-sc
+		}
 		switch sig {
 		case syscall.SIGTERM:
 			os.Exit(0)
@@ -46,5 +50,5 @@ func main() {
 		input = strings.Split(strings.TrimSpace(string(b[:])), " ")
 	}
 
-	ctl.MainStart(append(os.Args[1:], input...))
+	ctl.MainStart(ctx, append(os.Args[1:], input...))
 }
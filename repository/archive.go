@@ -0,0 +1,250 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"fmt"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gorm.io/gorm"
+)
+
+// ArchiveVersion is the version of the project archive format.
+const ArchiveVersion = 1
+
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// ProjectArchive is a portable project with all its sessions, workloads and metrics.
+type ProjectArchive struct {
+	Version   int              `json:"version"`
+	Project   Project          `json:"project"`
+	Retention *Retention       `json:"retention,omitempty"`
+	Sessions  []SessionArchive `json:"sessions"`
+}
+
+type SessionArchive struct {
+	Session   Session           `json:"session"`
+	Workloads []WorkloadArchive `json:"workloads"`
+}
+
+type WorkloadArchive struct {
+	Workload Workload     `json:"workload"`
+	Metrics  []Metrics    `json:"metrics"`
+	Labels   []Label      `json:"labels,omitempty"`
+	Series   []SeriesBlob `json:"series,omitempty"`
+}
+
+type ArchiveStorage interface {
+	Export(projectID uint) (*ProjectArchive, error)
+	// Import imports the archive and returns the imported project, conflict decides what to do if the project name exists.
+	Import(archive *ProjectArchive, conflict string) (Project, error)
+}
+
+type ArchiveDao struct {
+	db *gorm.DB
+}
+
+func NewArchiveDao(db *gorm.DB) ArchiveStorage {
+	return &ArchiveDao{db: db}
+}
+
+func (a *ArchiveDao) Export(projectID uint) (*ProjectArchive, error) {
+	var project Project
+	if m := a.db.Where(&Project{ID: projectID}).Find(&project); m.Error != nil {
+		return nil, m.Error
+	}
+	if project.ID == 0 {
+		return nil, errs.NotFound("project %d not found", projectID)
+	}
+	archive := &ProjectArchive{Version: ArchiveVersion, Project: project}
+	var retentions []Retention
+	if m := a.db.Where(&Retention{PID: projectID}).Find(&retentions); m.Error != nil {
+		return nil, m.Error
+	}
+	if len(retentions) > 0 {
+		archive.Retention = &retentions[0]
+	}
+
+	var sessions []Session
+	if m := a.db.Where(&Session{PID: projectID}).Find(&sessions); m.Error != nil {
+		return nil, m.Error
+	}
+	for _, s := range sessions {
+		// the credential stays in the server, the imported session sets it again
+		s.GrafanaAuthorization = ""
+		var workloads []Workload
+		if m := a.db.Where(&Workload{SessionID: s.ID}).Order("id").Find(&workloads); m.Error != nil {
+			return nil, m.Error
+		}
+		var metrics []Metrics
+		if m := a.db.Where(&Metrics{SessionID: s.ID}).Find(&metrics); m.Error != nil {
+			return nil, m.Error
+		}
+		var labels []Label
+		if m := a.db.Where(&Label{SessionID: s.ID}).Find(&labels); m.Error != nil {
+			return nil, m.Error
+		}
+		labelsOf := make(map[uint][]Label)
+		for _, l := range labels {
+			labelsOf[l.WID] = append(labelsOf[l.WID], l)
+		}
+		var blobs []SeriesBlob
+		if m := a.db.Where(&SeriesBlob{SessionID: s.ID}).Find(&blobs); m.Error != nil {
+			return nil, m.Error
+		}
+		workloadSeries := make(map[uint][]SeriesBlob)
+		for _, b := range blobs {
+			workloadSeries[b.WID] = append(workloadSeries[b.WID], b)
+		}
+		workloadMetrics := make(map[uint][]Metrics)
+		for _, m := range metrics {
+			workloadMetrics[m.WID] = append(workloadMetrics[m.WID], m)
+		}
+		sa := SessionArchive{Session: s, Workloads: make([]WorkloadArchive, len(workloads))}
+		for i, w := range workloads {
+			sa.Workloads[i] = WorkloadArchive{Workload: w, Metrics: workloadMetrics[w.ID], Labels: labelsOf[w.ID], Series: workloadSeries[w.ID]}
+		}
+		archive.Sessions = append(archive.Sessions, sa)
+	}
+	return archive, nil
+}
+
+func (a *ArchiveDao) Import(archive *ProjectArchive, conflict string) (Project, error) {
+	if archive.Version != ArchiveVersion {
+		return Project{}, errs.InvalidArgument("archive version %d is not supported", archive.Version)
+	}
+	var project Project
+	err := a.db.Transaction(func(tx *gorm.DB) error {
+		var existed []Project
+		if m := tx.Where(&Project{Name: archive.Project.Name}).Find(&existed); m.Error != nil {
+			return m.Error
+		}
+		project = Project{Name: archive.Project.Name, Description: archive.Project.Description}
+		if len(existed) > 0 {
+			switch conflict {
+			case ConflictSkip:
+				project = existed[0]
+				return nil
+			case ConflictOverwrite:
+				project.ID = existed[0].ID
+				if err := deleteProjectData(tx, project.ID); err != nil {
+					return err
+				}
+			case ConflictRename:
+				name, err := freeProjectName(tx, project.Name)
+				if err != nil {
+					return err
+				}
+				project.Name = name
+			default:
+				return errs.Conflict("project %s already exists", project.Name)
+			}
+		}
+		if m := tx.Save(&project); m.Error != nil {
+			return m.Error
+		}
+		if archive.Retention != nil {
+			retention := *archive.Retention
+			retention.ID, retention.PID = 0, project.ID
+			if m := tx.Create(&retention); m.Error != nil {
+				return m.Error
+			}
+		}
+		for _, sa := range archive.Sessions {
+			if err := importSession(tx, project.ID, sa); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return project, err
+}
+
+// importSession saves the session with new IDs and remaps the references of its workloads, metrics and labels.
+func importSession(tx *gorm.DB, projectID uint, sa SessionArchive) error {
+	session := sa.Session
+	session.ID, session.PID = 0, projectID
+	if m := tx.Create(&session); m.Error != nil {
+		return m.Error
+	}
+	for _, wa := range sa.Workloads {
+		workload := wa.Workload
+		workload.ID, workload.SessionID = 0, session.ID
+		if m := tx.Create(&workload); m.Error != nil {
+			return m.Error
+		}
+		metrics := make([]Metrics, len(wa.Metrics))
+		for i, m := range wa.Metrics {
+			m.ID, m.WID, m.SessionID = 0, workload.ID, session.ID
+			metrics[i] = m
+		}
+		if len(metrics) > 0 {
+			if m := tx.CreateInBatches(metrics, 500); m.Error != nil {
+				return m.Error
+			}
+		}
+		labels := make([]Label, len(wa.Labels))
+		for i, l := range wa.Labels {
+			l.ID, l.WID, l.SessionID = 0, workload.ID, session.ID
+			labels[i] = l
+		}
+		if len(labels) > 0 {
+			if m := tx.Create(labels); m.Error != nil {
+				return m.Error
+			}
+		}
+		blobs := make([]SeriesBlob, len(wa.Series))
+		for i, b := range wa.Series {
+			b.ID, b.WID, b.SessionID = 0, workload.ID, session.ID
+			blobs[i] = b
+		}
+		if len(blobs) > 0 {
+			if m := tx.Create(blobs); m.Error != nil {
+				return m.Error
+			}
+		}
+	}
+	return nil
+}
+
+func deleteProjectData(tx *gorm.DB, projectID uint) error {
+	sessions := tx.Model(&Session{}).Select("id").Where(&Session{PID: projectID})
+	for _, model := range []interface{}{&SeriesBlob{}, &Label{}, &Metrics{}, &Workload{}} {
+		if m := tx.Where("session_id IN (?)", sessions).Delete(model); m.Error != nil {
+			return m.Error
+		}
+	}
+	if m := tx.Where(&Session{PID: projectID}).Delete(&Session{}); m.Error != nil {
+		return m.Error
+	}
+	m := tx.Where(&Retention{PID: projectID}).Delete(&Retention{})
+	return m.Error
+}
+
+func freeProjectName(tx *gorm.DB, name string) (string, error) {
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		var count int64
+		if m := tx.Model(&Project{}).Where(&Project{Name: candidate}).Count(&count); m.Error != nil {
+			return "", m.Error
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportRemapsIDs(t *testing.T) {
+	as := assert.New(t)
+	db, mock := mockDB(t)
+	archive := &ProjectArchive{
+		Version:   ArchiveVersion,
+		Project:   Project{ID: 7, Name: "pd"},
+		Retention: &Retention{ID: 3, PID: 7, KeepRuns: 5},
+		Sessions: []SessionArchive{{
+			Session: Session{ID: 40, PID: 7, Name: "s"},
+			Workloads: []WorkloadArchive{
+				{
+					Workload: Workload{ID: 100, SessionID: 40, Name: "w1", BenchName: "tpcc"},
+					Metrics:  []Metrics{{ID: 1000, WID: 100, SessionID: 40, Key: "qps", Value: 1}},
+					Labels: []Label{
+						{ID: 1, SessionID: 40, WID: 100, BenchName: "tpcc", Name: "pr", Value: "1"},
+						{ID: 2, SessionID: 40, WID: 100, BenchName: "tpcc", Name: "tables", Value: "16"},
+					},
+					Series: []SeriesBlob{{ID: 5, WID: 100, SessionID: 40, Name: "cpu"}},
+				},
+				{Workload: Workload{ID: 101, SessionID: 40, Name: "w2", BenchName: "tpcc"}},
+			},
+		}},
+	}
+
+	any := sqlmock.AnyArg()
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT \\* FROM `project`").WithArgs("pd").WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+	mock.ExpectExec("INSERT INTO `project`").WithArgs("pd", "").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `retention`").WithArgs(1, 5, 0, false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `session`").WithArgs(1, "s", "", "", "", "", "", "", "", "", "", any, any).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec("INSERT INTO `workload`").WithArgs(2, "w1", any, any, "", "", float64(0), "tpcc", "", false).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	// the metrics are inserted in batches under a savepoint.
+	mock.ExpectExec("SAVEPOINT").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO `metrics`").WithArgs(3, "", "qps", float64(1), any, 2).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `label`").WithArgs(2, 3, "tpcc", "pr", "1", 2, 3, "tpcc", "tables", "16").
+		WillReturnResult(sqlmock.NewResult(1, 2))
+	mock.ExpectExec("INSERT INTO `series`").WithArgs(3, 2, "cpu", "", any).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO `workload`").WithArgs(2, "w2", any, any, "", "", float64(0), "tpcc", "", false).
+		WillReturnResult(sqlmock.NewResult(4, 1))
+	mock.ExpectCommit()
+
+	project, err := NewArchiveDao(db).Import(archive, ConflictSkip)
+	as.NoError(err)
+	as.Equal(Project{ID: 1, Name: "pd"}, project)
+}
+
+func TestImportConflict(t *testing.T) {
+	archive := &ProjectArchive{Version: ArchiveVersion, Project: Project{ID: 7, Name: "pd", Description: "new"}}
+	existed := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name", "description"}).AddRow(9, "pd", "old")
+	}
+	testCases := []struct {
+		conflict string
+		expect   func(mock sqlmock.Sqlmock)
+		project  Project
+		code     errs.Code
+	}{
+		{
+			conflict: ConflictSkip,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectCommit()
+			},
+			project: Project{ID: 9, Name: "pd", Description: "old"},
+		},
+		{
+			conflict: ConflictOverwrite,
+			expect: func(mock sqlmock.Sqlmock) {
+				for _, table := range []string{"series", "label", "metrics", "workload"} {
+					mock.ExpectExec("DELETE FROM `" + table + "` WHERE session_id IN \\(SELECT `id` FROM `session` WHERE `session`.`p_id` = \\?\\)").
+						WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectExec("DELETE FROM `session`").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM `retention`").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE `project`").WithArgs("pd", "new", 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			project: Project{ID: 9, Name: "pd", Description: "new"},
+		},
+		{
+			conflict: ConflictRename,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `project`").WithArgs("pd (2)").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectQuery("SELECT count\\(\\*\\) FROM `project`").WithArgs("pd (3)").
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec("INSERT INTO `project`").WithArgs("pd (3)", "new").WillReturnResult(sqlmock.NewResult(10, 1))
+				mock.ExpectCommit()
+			},
+			project: Project{ID: 10, Name: "pd (3)", Description: "new"},
+		},
+		{
+			conflict: "",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectRollback()
+			},
+			code: errs.CodeConflict,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.conflict, func(t *testing.T) {
+			as := assert.New(t)
+			db, mock := mockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT \\* FROM `project`").WithArgs("pd").WillReturnRows(existed())
+			testCase.expect(mock)
+			project, err := NewArchiveDao(db).Import(archive, testCase.conflict)
+			if testCase.code != "" {
+				as.Equal(testCase.code, errs.Convert(err).Code)
+				return
+			}
+			as.NoError(err)
+			as.Equal(testCase.project, project)
+		})
+	}
+}
+
+func TestImportVersion(t *testing.T) {
+	as := assert.New(t)
+	db, _ := mockDB(t)
+	_, err := NewArchiveDao(db).Import(&ProjectArchive{Version: ArchiveVersion + 1}, ConflictSkip)
+	as.Equal(errs.CodeInvalidArgument, errs.Convert(err).Code)
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	benchSuffix    = ".jsonl"
+	benchConfigKey = "bench_config.json"
+)
+
+// FileStorage stores the records of every bench as jsonl file under the directory.
+type FileStorage struct {
+	sync.RWMutex
+	dir string
+}
+
+type benchConfig struct {
+	TargetMetrics string   `json:"target_metrics"`
+	Workloads     []string `json:"workloads"`
+	Metrics       []string `json:"metrics"`
+}
+
+func NewFileStorage(dir string) (Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStorage{dir: dir}, nil
+}
+
+// Save appends the records to the bench file.
+func (f *FileStorage) Save(id string, records []Record) error {
+	path, err := f.benchPath(id)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	encoder := json.NewEncoder(file)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return file.Sync()
+}
+
+// Get returns all records of the bench.
+func (f *FileStorage) Get(id string) ([]Record, error) {
+	path, err := f.benchPath(id)
+	if err != nil {
+		return nil, err
+	}
+	f.RLock()
+	defer f.RUnlock()
+	return readRecords(path)
+}
+
+// GetMetrics returns the latest metrics of the workload keyed by metrics name.
+func (f *FileStorage) GetMetrics(workload string, limit int, metrics []string) (map[string][]*Metrics, error) {
+	loads, err := f.workloads()
+	if err != nil {
+		return nil, err
+	}
+	rst := make(map[string][]*Metrics, len(metrics))
+	for _, key := range metrics {
+		ms := make([]*Metrics, 0)
+		for _, l := range loads {
+			if l.workload.Name != workload {
+				continue
+			}
+			if v, ok := l.metrics[key]; ok {
+				ms = append(ms, &Metrics{WID: l.workload.ID, Name: workload, Key: key, Value: v, Start: l.workload.Start})
+			}
+		}
+		sort.SliceStable(ms, func(i, j int) bool {
+			return ms[i].Start.After(ms[j].Start)
+		})
+		if limit > 0 && len(ms) > limit {
+			ms = ms[:limit]
+		}
+		rst[key] = ms
+	}
+	return rst, nil
+}
+
+// GetAll returns one page of the workloads and the total count, empty workload or version matches all.
+func (f *FileStorage) GetAll(workload string, version string, page int, size int) ([]*Workload, int64, error) {
+	loads, err := f.workloads()
+	if err != nil {
+		return nil, 0, err
+	}
+	result := make([]*Workload, 0)
+	for i := len(loads) - 1; i >= 0; i-- {
+		l := loads[i].workload
+		if (workload == "" || l.Name == workload) && (version == "" || l.Version == version) {
+			result = append(result, l)
+		}
+	}
+	total := int64(len(result))
+	start, end := (page-1)*size, page*size
+	if start < 0 || size <= 0 || start >= len(result) {
+		return []*Workload{}, total, nil
+	}
+	if end > len(result) {
+		end = len(result)
+	}
+	return result[start:end], total, nil
+}
+
+// GetConfig returns the workloads of the bench config.
+func (f *FileStorage) GetConfig() []string {
+	f.RLock()
+	defer f.RUnlock()
+	var config benchConfig
+	body, err := ioutil.ReadFile(filepath.Join(f.dir, benchConfigKey))
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, &config); err != nil {
+		return nil
+	}
+	return config.Workloads
+}
+
+// SaveBenchConfig saves the bench config, the error is ignored as the interface declares.
+func (f *FileStorage) SaveBenchConfig(targetMetrics string, workloads, metrics []string) {
+	f.Lock()
+	defer f.Unlock()
+	body, err := json.Marshal(benchConfig{TargetMetrics: targetMetrics, Workloads: workloads, Metrics: metrics})
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(filepath.Join(f.dir, benchConfigKey), body, 0644)
+}
+
+func (f *FileStorage) benches() ([]string, error) {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), benchSuffix) {
+			names = append(names, strings.TrimSuffix(file.Name(), benchSuffix))
+		}
+	}
+	return names, nil
+}
+
+type fileWorkload struct {
+	workload *Workload
+	metrics  map[string]float64
+}
+
+// workloads returns the workloads of all benches, ID is the sequence in the directory.
+func (f *FileStorage) workloads() ([]fileWorkload, error) {
+	f.RLock()
+	defer f.RUnlock()
+	benches, err := f.benches()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]fileWorkload, 0)
+	for _, bench := range benches {
+		records, err := readRecords(filepath.Join(f.dir, bench+benchSuffix))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			result = append(result, fileWorkload{
+				workload: &Workload{
+					ID:        uint(len(result) + 1),
+					Name:      r.Workload,
+					Start:     timeStampToTime(r.Start),
+					End:       timeStampToTime(r.End),
+					Config:    r.Config,
+					Cmd:       r.Cmd,
+					BenchName: bench,
+				},
+				metrics: r.Metrics,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (f *FileStorage) benchPath(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("bench name %q is invalid", id)
+	}
+	return filepath.Join(f.dir, id+benchSuffix), nil
+}
+
+func readRecords(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	result := make([]Record, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStorage(t *testing.T) {
+	as := assert.New(t)
+	storage, err := NewFileStorage(t.TempDir())
+	as.Nil(err)
+
+	first := []Record{
+		{Workload: "read", Start: "1634479813", End: "1634481013", Metrics: map[string]float64{"tikv_cpu_avg": 1}},
+		{Workload: "write", Start: "1634481013", End: "1634482213", Metrics: map[string]float64{"tikv_cpu_avg": 2}},
+	}
+	second := []Record{
+		{Workload: "read", Start: "1634482213", End: "1634483413", Metrics: map[string]float64{"tikv_cpu_avg": 3}},
+	}
+	as.Nil(storage.Save("bench-1", first))
+	as.Nil(storage.Save("bench-2", second))
+	as.NotNil(storage.Save("../bench", first))
+
+	records, err := storage.Get("bench-1")
+	as.Nil(err)
+	as.Equal(first, records)
+	_, err = storage.Get("bench-3")
+	as.NotNil(err)
+
+	metrics, err := storage.GetMetrics("read", 1, []string{"tikv_cpu_avg"})
+	as.Nil(err)
+	as.Len(metrics["tikv_cpu_avg"], 1)
+	as.Equal(float64(3), metrics["tikv_cpu_avg"][0].Value)
+
+	loads, total, err := storage.GetAll("read", "", 1, 10)
+	as.Nil(err)
+	as.Equal(int64(2), total)
+	as.Equal("bench-2", loads[0].BenchName)
+	loads, total, err = storage.GetAll("", "", 2, 2)
+	as.Nil(err)
+	as.Equal(int64(3), total)
+	as.Len(loads, 1)
+
+	as.Nil(storage.GetConfig())
+	storage.SaveBenchConfig("tikv_cpu_avg", []string{"read", "write"}, []string{"tikv_cpu"})
+	as.Equal([]string{"read", "write"}, storage.GetConfig())
+}
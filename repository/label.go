@@ -0,0 +1,124 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gorm.io/gorm"
+)
+
+const (
+	LabelEqual    = "="
+	LabelNotEqual = "!="
+	LabelRegexp   = "=~"
+)
+
+// LabelSelector selects workloads by their own labels or the labels of their bench run.
+type LabelSelector struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+func (s LabelSelector) String() string {
+	return s.Key + s.Op + s.Value
+}
+
+// ParseLabelSelectors parses selectors like `pr=1234`, `scheduler!=v1` or `table_size=~10M|1M`.
+func ParseLabelSelectors(selectors []string) ([]LabelSelector, error) {
+	result := make([]LabelSelector, 0, len(selectors))
+	for _, s := range selectors {
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return nil, errs.InvalidArgument("label selector %q is invalid", s)
+		}
+		selector := LabelSelector{Key: s[:i], Op: LabelEqual, Value: s[i+1:]}
+		switch {
+		case strings.HasSuffix(selector.Key, "!"):
+			selector.Key, selector.Op = selector.Key[:len(selector.Key)-1], LabelNotEqual
+		case strings.HasPrefix(selector.Value, "~"):
+			selector.Op, selector.Value = LabelRegexp, selector.Value[1:]
+			if _, err := regexp.Compile(selector.Value); err != nil {
+				return nil, errs.Wrap(errs.CodeInvalidArgument, err, "label selector %q is invalid", s)
+			}
+		}
+		if selector.Key == "" {
+			return nil, errs.InvalidArgument("label selector %q is invalid", s)
+		}
+		result = append(result, selector)
+	}
+	return result, nil
+}
+
+// ParseLabels parses labels like `pr=1234`.
+func ParseLabels(labels []string) (map[string]string, error) {
+	result := make(map[string]string, len(labels))
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errs.InvalidArgument("label %q is invalid", l)
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+// applySelectors filters the workload query by the workload labels, which include the labels of the bench run.
+// Empty sessionIDs matches the labels of all sessions.
+func applySelectors(m *gorm.DB, sessionIDs []uint, selectors []LabelSelector) *gorm.DB {
+	for _, s := range selectors {
+		cond := "value = ?"
+		if s.Op == LabelRegexp {
+			cond = "value REGEXP ?"
+		}
+		scope, args := "", []interface{}{}
+		if len(sessionIDs) > 0 {
+			scope, args = "session_id IN ? AND ", []interface{}{sessionIDs}
+		}
+		match := fmt.Sprintf("id IN (SELECT w_id FROM label WHERE %sname = ? AND %s)", scope, cond)
+		args = append(args, s.Key, s.Value)
+		if s.Op == LabelNotEqual {
+			m = m.Not(match, args...)
+		} else {
+			m = m.Where(match, args...)
+		}
+	}
+	return m
+}
+
+// workloadLabels returns the labels of the workload, the labels of the bench run are overridden by its own.
+func workloadLabels(sessionID, wID uint, benchName string, bench, own map[string]string) []*Label {
+	merged := make(map[string]string, len(bench)+len(own))
+	for k, v := range bench {
+		merged[k] = v
+	}
+	for k, v := range own {
+		merged[k] = v
+	}
+	names := make([]string, 0, len(merged))
+	for k := range merged {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	labels := make([]*Label, 0, len(names))
+	for _, k := range names {
+		labels = append(labels, &Label{SessionID: sessionID, WID: wID, BenchName: benchName, Name: k, Value: merged[k]})
+	}
+	return labels
+}
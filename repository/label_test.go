@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabelSelectors(t *testing.T) {
+	as := assert.New(t)
+	selectors, err := ParseLabelSelectors([]string{"pr=1234", "scheduler!=hot-region-v2", "table_size=~10M|1M", "empty="})
+	as.Nil(err)
+	as.Equal([]LabelSelector{
+		{Key: "pr", Op: LabelEqual, Value: "1234"},
+		{Key: "scheduler", Op: LabelNotEqual, Value: "hot-region-v2"},
+		{Key: "table_size", Op: LabelRegexp, Value: "10M|1M"},
+		{Key: "empty", Op: LabelEqual, Value: ""},
+	}, selectors)
+
+	for _, s := range []string{"pr", "=1", "!=1", "a=~("} {
+		_, err = ParseLabelSelectors([]string{s})
+		as.NotNil(err, s)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	as := assert.New(t)
+	labels, err := ParseLabels([]string{"pr=1234", "expr=a=b"})
+	as.Nil(err)
+	as.Equal(map[string]string{"pr": "1234", "expr": "a=b"}, labels)
+	_, err = ParseLabels([]string{"pr"})
+	as.NotNil(err)
+}
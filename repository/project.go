@@ -16,17 +16,25 @@ package repository
 import (
 	"strings"
 
+	"github.com/bufferflies/pd-analyze/errs"
 	"gorm.io/gorm"
 )
 
 type ProjectStorage interface {
-	Save(name, description string) error
-	SaveSession(session Session) error
+	// SaveProject creates the project if its id is zero or updates it, project names are unique.
+	SaveProject(project *Project) error
+	// SaveSession creates the session if its id is zero or updates all its fields.
+	SaveSession(session *Session) error
 	UpdateSession(sid uint, name, targetObject string, object []string) error
 
+	SaveRetention(retention Retention) error
+
 	GetAll() ([]Project, error)
+	GetProject(projectID uint) (Project, error)
 	GetSessions(projectID uint) ([]Session, error)
 	GetSession(sessionID uint) (Session, error)
+	GetRetention(projectID uint) (Retention, error)
+	GetRetentions() ([]Retention, error)
 
 	DeleteProject(projectID uint) error
 	DeleteSession(sessionID uint) error
@@ -37,31 +45,40 @@ type ProjectDao struct {
 }
 
 func NewProjectDao(db *gorm.DB) ProjectStorage {
-	db.AutoMigrate(&Project{}, &Session{})
+	db.AutoMigrate(&Project{}, &Session{}, &Retention{})
 	return &ProjectDao{db: db}
 }
 
-func (p ProjectDao) Save(name, description string) error {
-	m := p.db.Create(&Project{Name: name, Description: description})
+func (p ProjectDao) SaveProject(project *Project) error {
+	var count int64
+	if m := p.db.Model(&Project{}).Where("name = ? AND id <> ?", project.Name, project.ID).Count(&count); m.Error != nil {
+		return m.Error
+	}
+	if count > 0 {
+		return errs.Conflict("project %s already exists", project.Name)
+	}
+	m := p.db.Save(project)
 	return m.Error
 }
 
-func (p ProjectDao) SaveSession(session Session) error {
-	if session.ID > 0 {
-		if m := p.db.Model(&session).Updates(&session); m.Error != nil {
-			return m.Error
-		}
-	} else {
-		if m := p.db.Save(&session); m.Error != nil {
-			return m.Error
-		}
-	}
-	return nil
+func (p ProjectDao) SaveSession(session *Session) error {
+	m := p.db.Save(session)
+	return m.Error
 }
 
 func (p ProjectDao) UpdateSession(sid uint, name, targetObject string, object []string) error {
 	objects := strings.Join(object, ",")
-	m := p.db.Model(&Session{}).Updates(&Session{ID: sid, Name: name, Object: objects, TargetObject: targetObject})
+	m := p.db.Model(&Session{ID: sid}).Updates(&Session{Name: name, Object: objects, TargetObject: targetObject})
+	return m.Error
+}
+
+func (p ProjectDao) SaveRetention(retention Retention) error {
+	old, err := p.GetRetention(retention.PID)
+	if err != nil {
+		return err
+	}
+	retention.ID = old.ID
+	m := p.db.Save(&retention)
 	return m.Error
 }
 
@@ -71,6 +88,18 @@ func (p ProjectDao) GetAll() ([]Project, error) {
 	return projects, m.Error
 }
 
+func (p ProjectDao) GetProject(projectID uint) (Project, error) {
+	var project Project
+	m := p.db.Where("id = ?", projectID).Find(&project)
+	if m.Error != nil {
+		return project, m.Error
+	}
+	if project.ID == 0 {
+		return project, errs.NotFound("project %d not found", projectID)
+	}
+	return project, nil
+}
+
 func (p ProjectDao) GetSession(sessionID uint) (Session, error) {
 	var session Session
 	m := p.db.Where(&Session{ID: sessionID}).Find(&session)
@@ -83,12 +112,33 @@ func (p ProjectDao) GetSessions(projectID uint) ([]Session, error) {
 	return sessions, m.Error
 }
 
+func (p ProjectDao) GetRetention(projectID uint) (Retention, error) {
+	retention := Retention{PID: projectID}
+	m := p.db.Where(&Retention{PID: projectID}).Find(&retention)
+	return retention, m.Error
+}
+
+func (p ProjectDao) GetRetentions() ([]Retention, error) {
+	var retentions []Retention
+	m := p.db.Find(&retentions)
+	return retentions, m.Error
+}
+
+// DeleteProject deletes the project with its retention and sessions, the workloads of the sessions are deleted too.
 func (p ProjectDao) DeleteProject(projectID uint) error {
-	m := p.db.Delete(&Project{ID: projectID})
-	if m.Error != nil {
+	sessions, err := p.GetSessions(projectID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		if err := p.DeleteSession(s.ID); err != nil {
+			return err
+		}
+	}
+	if m := p.db.Where(&Retention{PID: projectID}).Delete(&Retention{}); m.Error != nil {
 		return m.Error
 	}
-	m = p.db.Delete(&Session{PID: projectID})
+	m := p.db.Where("id = ?", projectID).Delete(&Project{})
 	return m.Error
 }
 
@@ -102,5 +152,11 @@ func (p ProjectDao) DeleteSession(sessionID uint) error {
 	if m := p.db.Where(&Metrics{SessionID: sessionID}).Delete(&Metrics{}); m.Error != nil {
 		return m.Error
 	}
+	if m := p.db.Where(&Label{SessionID: sessionID}).Delete(&Label{}); m.Error != nil {
+		return m.Error
+	}
+	if m := p.db.Where(&SeriesBlob{SessionID: sessionID}).Delete(&SeriesBlob{}); m.Error != nil {
+		return m.Error
+	}
 	return nil
 }
@@ -0,0 +1,247 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SortID    = "id"
+	SortStart = "start"
+	SortEnd   = "end"
+
+	defaultSearchLimit = 20
+)
+
+// MetricPredicate filters the workloads by the value of the metric key.
+type MetricPredicate struct {
+	Key   string
+	Op    string
+	Value float64
+}
+
+func (p MetricPredicate) String() string {
+	return fmt.Sprintf("%s %s %v", p.Key, p.Op, p.Value)
+}
+
+// predicateOps is ordered so the two-char operators match first.
+var predicateOps = []string{">=", "<=", "!=", ">", "<", "="}
+
+// ParseMetricPredicate parses predicates like `tikv_cpu_std/avg > 0.3`.
+func ParseMetricPredicate(s string) (MetricPredicate, error) {
+	for _, op := range predicateOps {
+		i := strings.Index(s, op)
+		if i < 0 {
+			continue
+		}
+		p := MetricPredicate{Key: strings.TrimSpace(s[:i]), Op: op}
+		v, err := strconv.ParseFloat(strings.TrimSpace(s[i+len(op):]), 64)
+		if err != nil || p.Key == "" {
+			return p, errs.InvalidArgument("metric predicate %q is invalid", s)
+		}
+		p.Value = v
+		return p, nil
+	}
+	return MetricPredicate{}, errs.InvalidArgument("metric predicate %q needs one of %s", s, strings.Join(predicateOps, " "))
+}
+
+// WorkloadSearch filters, sorts and pages the workloads, zero fields are not filtered.
+type WorkloadSearch struct {
+	SessionIDs []uint
+	Name       string
+	BenchName  string
+	Version    string
+	Cmd        string // substring of the command
+	CmdRegexp  string
+	From       time.Time // the run starts at or after
+	To         time.Time // the run ends at or before
+	Labels     []LabelSelector
+	Metrics    []MetricPredicate
+	Sort       string // id, start, end or a metric key, the runs without the metric key are skipped
+	Asc        bool
+	Cursor     string // the next cursor of the last page
+	Limit      int
+}
+
+// searchCursor is the sort value and id of the last workload of the page.
+type searchCursor struct {
+	ID    uint       `json:"id"`
+	Value *float64   `json:"v,omitempty"`
+	Time  *time.Time `json:"t,omitempty"`
+}
+
+func (c searchCursor) encode() string {
+	body, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(body)
+}
+
+func decodeCursor(s string) (searchCursor, error) {
+	var c searchCursor
+	body, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(body, &c)
+	}
+	if err != nil {
+		return c, errs.InvalidArgument("cursor %q is invalid", s)
+	}
+	return c, nil
+}
+
+func (s WorkloadSearch) limit() int {
+	if s.Limit <= 0 {
+		return defaultSearchLimit
+	}
+	return s.Limit
+}
+
+// sortMetric returns the metric key of the sort, empty if it sorts by the workload column.
+func (s WorkloadSearch) sortMetric() string {
+	switch s.Sort {
+	case "", SortID, SortStart, SortEnd:
+		return ""
+	default:
+		return s.Sort
+	}
+}
+
+// sortExpr returns the sql expression of the sort value.
+func (s WorkloadSearch) sortExpr() (string, []interface{}) {
+	switch s.Sort {
+	case "", SortID:
+		return "workload.id", nil
+	case SortStart:
+		return "workload.`start`", nil
+	case SortEnd:
+		return "workload.`end`", nil
+	default:
+		return "(SELECT MAX(value) FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?)", []interface{}{s.Sort}
+	}
+}
+
+// apply adds the filters, the cursor and the order to the workload query, one more row than the limit is queried
+// to know if there is a next page.
+func (s WorkloadSearch) apply(m *gorm.DB) (*gorm.DB, error) {
+	if len(s.SessionIDs) > 0 {
+		m = m.Where("workload.session_id IN ?", s.SessionIDs)
+	}
+	m = m.Where(&Workload{Name: s.Name, BenchName: s.BenchName, Version: s.Version})
+	if s.Cmd != "" {
+		m = m.Where("workload.cmd LIKE ?", "%"+escapeLike(s.Cmd)+"%")
+	}
+	if s.CmdRegexp != "" {
+		if _, err := regexp.Compile(s.CmdRegexp); err != nil {
+			return nil, errs.Wrap(errs.CodeInvalidArgument, err, "cmd regexp %q is invalid", s.CmdRegexp)
+		}
+		m = m.Where("workload.cmd REGEXP ?", s.CmdRegexp)
+	}
+	if !s.From.IsZero() {
+		m = m.Where("workload.`start` >= ?", s.From)
+	}
+	if !s.To.IsZero() {
+		m = m.Where("workload.`end` <= ?", s.To)
+	}
+	m = applySelectors(m, s.SessionIDs, s.Labels)
+	for _, p := range s.Metrics {
+		op := p.Op
+		if op == "!=" {
+			op = "<>"
+		}
+		m = m.Where(fmt.Sprintf("EXISTS (SELECT 1 FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ? AND metrics.value %s ?)", op), p.Key, p.Value)
+	}
+	if key := s.sortMetric(); key != "" {
+		m = m.Where("EXISTS (SELECT 1 FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?)", key)
+	}
+
+	expr, vars := s.sortExpr()
+	dir, cmp := "DESC", "<"
+	if s.Asc {
+		dir, cmp = "ASC", ">"
+	}
+	if s.Cursor != "" {
+		c, err := decodeCursor(s.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		switch {
+		case s.Sort == "" || s.Sort == SortID:
+		case s.sortMetric() != "" && c.Value != nil:
+			value = *c.Value
+		case s.sortMetric() == "" && c.Time != nil:
+			value = *c.Time
+		default:
+			return nil, errs.InvalidArgument("cursor does not match the sort %s", s.Sort)
+		}
+		if value == nil {
+			m = m.Where("workload.id "+cmp+" ?", c.ID)
+		} else {
+			args := append(append(append([]interface{}{}, vars...), value), vars...)
+			args = append(args, value, c.ID)
+			m = m.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND workload.id %s ?))", expr, cmp, expr, cmp), args...)
+		}
+	}
+	order := expr + " " + dir
+	if expr != "workload.id" {
+		order += ", workload.id " + dir
+	}
+	m = m.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: order, Vars: vars, WithoutParentheses: true}})
+	return m.Limit(s.limit() + 1), nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// SearchWorkloads returns one page of the matched workloads and the cursor of the next page, empty if it is the last page.
+func (p *WorkloadDao) SearchWorkloads(search WorkloadSearch) ([]Workload, string, error) {
+	m, err := search.apply(p.db.Model(&Workload{}))
+	if err != nil {
+		return nil, "", err
+	}
+	var workloads []Workload
+	if m = m.Find(&workloads); m.Error != nil {
+		return nil, "", m.Error
+	}
+	if len(workloads) <= search.limit() {
+		return workloads, "", nil
+	}
+	workloads = workloads[:search.limit()]
+	last := workloads[len(workloads)-1]
+	c := searchCursor{ID: last.ID}
+	switch search.Sort {
+	case "", SortID:
+	case SortStart:
+		c.Time = &last.Start
+	case SortEnd:
+		c.Time = &last.End
+	default:
+		var v float64
+		if m := p.db.Model(&Metrics{}).Select("MAX(value)").Where(&Metrics{WID: last.ID, Key: search.Sort}).Scan(&v); m.Error != nil {
+			return nil, "", m.Error
+		}
+		c.Value = &v
+	}
+	return workloads, c.encode(), nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// dryRunDB renders the sql without a mysql server.
+func dryRunDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:1)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.New(t).NoError(err)
+	return db
+}
+
+func TestParseMetricPredicate(t *testing.T) {
+	as := assert.New(t)
+	p, err := ParseMetricPredicate("tikv_cpu_std/avg > 0.3")
+	as.NoError(err)
+	as.Equal(MetricPredicate{Key: "tikv_cpu_std/avg", Op: ">", Value: 0.3}, p)
+	p, err = ParseMetricPredicate("qps>=100")
+	as.NoError(err)
+	as.Equal(MetricPredicate{Key: "qps", Op: ">=", Value: 100}, p)
+	p, err = ParseMetricPredicate("qps != 0")
+	as.NoError(err)
+	as.Equal("!=", p.Op)
+
+	for _, s := range []string{"qps", "> 1", "qps > x"} {
+		_, err = ParseMetricPredicate(s)
+		as.Error(err, s)
+	}
+}
+
+func TestSearchSQL(t *testing.T) {
+	as := assert.New(t)
+	db := dryRunDB(t)
+	search := WorkloadSearch{
+		SessionIDs: []uint{1, 2},
+		BenchName:  "tpcc",
+		Version:    "v5.2",
+		Cmd:        "50%_x",
+		From:       time.Unix(100, 0),
+		Labels:     []LabelSelector{{Key: "pr", Op: LabelEqual, Value: "1"}},
+		Metrics:    []MetricPredicate{{Key: "tikv_cpu_std/avg", Op: ">", Value: 0.3}},
+		Sort:       "tikv_cpu_std/avg",
+		Limit:      10,
+	}
+	m, err := search.apply(db.Model(&Workload{}))
+	as.NoError(err)
+	var workloads []Workload
+	stmt := m.Find(&workloads).Statement
+	as.Equal("SELECT * FROM `workload` WHERE (workload.session_id IN (?,?)) AND "+
+		"`workload`.`bench_name` = ? AND `workload`.`version` = ? AND (workload.cmd LIKE ?) AND (workload.`start` >= ?) AND "+
+		"(id IN (SELECT w_id FROM label WHERE session_id IN (?,?) AND name = ? AND value = ?)) AND "+
+		"(EXISTS (SELECT 1 FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ? AND metrics.value > ?)) AND "+
+		"(EXISTS (SELECT 1 FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?)) "+
+		"ORDER BY (SELECT MAX(value) FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?) DESC, workload.id DESC LIMIT 11",
+		stmt.SQL.String())
+	as.Equal(`%50\%\_x%`, stmt.Vars[4])
+
+	// the cursor of the metric sort compares the value then the id.
+	v := 0.5
+	search.Cursor = searchCursor{ID: 7, Value: &v}.encode()
+	search.Asc = true
+	m, err = search.apply(db.Model(&Workload{}))
+	as.NoError(err)
+	stmt = m.Find(&workloads).Statement
+	as.Contains(stmt.SQL.String(), "AND (((SELECT MAX(value) FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?) > ? OR "+
+		"((SELECT MAX(value) FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?) = ? AND workload.id > ?))) ORDER BY (SELECT MAX(value) FROM metrics WHERE metrics.w_id = workload.id AND metrics.`key` = ?) ASC, workload.id ASC LIMIT 11")
+	as.Equal([]interface{}{"tikv_cpu_std/avg", 0.5, "tikv_cpu_std/avg", 0.5, uint(7), "tikv_cpu_std/avg"}, stmt.Vars[len(stmt.Vars)-6:])
+
+	search = WorkloadSearch{Cursor: searchCursor{ID: 7}.encode(), Sort: SortStart}
+	_, err = search.apply(db.Model(&Workload{}))
+	as.Error(err)
+	search = WorkloadSearch{Cursor: "bad"}
+	_, err = search.apply(db.Model(&Workload{}))
+	as.Error(err)
+	search = WorkloadSearch{Cursor: searchCursor{ID: 7}.encode()}
+	m, err = search.apply(db.Model(&Workload{}))
+	as.NoError(err)
+	as.Equal("SELECT * FROM `workload` WHERE workload.id < ? ORDER BY workload.id DESC LIMIT 21", m.Find(&workloads).Statement.SQL.String())
+}
+
+func TestBenchesSQL(t *testing.T) {
+	as := assert.New(t)
+	dao := &WorkloadDao{db: dryRunDB(t)}
+	var benches []BenchSummary
+	stmt := dao.benchesQuery(3).Scan(&benches).Statement
+	as.Equal("SELECT bench_name AS name, COUNT(*) AS workloads, MIN(start) AS start, MAX(`end`) AS `end`, MAX(baseline) AS baseline "+
+		"FROM `workload` WHERE session_id = ? GROUP BY `bench_name` ORDER BY start", stmt.SQL.String())
+	as.Equal([]interface{}{uint(3)}, stmt.Vars)
+}
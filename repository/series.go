@@ -0,0 +1,159 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// Series is the downsampled raw samples of one series of the metrics, timestamps are unix seconds.
+type Series struct {
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Timestamps []int64           `json:"timestamps"`
+	Values     []float64         `json:"values"`
+}
+
+// SeriesBlob is the stored form of the series.
+type SeriesBlob struct {
+	ID        uint `gorm:"AUTO_INCREMENT"`
+	WID       uint
+	SessionID uint
+	Name      string
+	Labels    string
+	Data      []byte `gorm:"type:mediumblob"`
+}
+
+func (SeriesBlob) TableName() string {
+	return "series"
+}
+
+// NewSeriesBlob encodes the series of the workload.
+func NewSeriesBlob(sessionID, wID uint, series Series) (*SeriesBlob, error) {
+	labels, err := json.Marshal(series.Labels)
+	if err != nil {
+		return nil, err
+	}
+	data, err := EncodeSamples(series.Timestamps, series.Values)
+	if err != nil {
+		return nil, err
+	}
+	return &SeriesBlob{WID: wID, SessionID: sessionID, Name: series.Name, Labels: string(labels), Data: data}, nil
+}
+
+// Series decodes the blob.
+func (b SeriesBlob) Series() (Series, error) {
+	series := Series{Name: b.Name}
+	if b.Labels != "" {
+		if err := json.Unmarshal([]byte(b.Labels), &series.Labels); err != nil {
+			return series, err
+		}
+	}
+	var err error
+	series.Timestamps, series.Values, err = DecodeSamples(b.Data)
+	return series, err
+}
+
+// EncodeSamples encodes the timestamps as delta-of-delta varints and the values as xor with the previous one,
+// both columns are gzip'd together.
+func EncodeSamples(timestamps []int64, values []float64) ([]byte, error) {
+	if len(timestamps) != len(values) {
+		return nil, fmt.Errorf("timestamps and values length not match, %d != %d", len(timestamps), len(values))
+	}
+	var raw bytes.Buffer
+	buf := make([]byte, binary.MaxVarintLen64)
+	raw.Write(buf[:binary.PutUvarint(buf, uint64(len(timestamps)))])
+	var prev, delta int64
+	for i, ts := range timestamps {
+		if i == 0 {
+			raw.Write(buf[:binary.PutVarint(buf, ts)])
+		} else {
+			d := ts - prev
+			raw.Write(buf[:binary.PutVarint(buf, d-delta)])
+			delta = d
+		}
+		prev = ts
+	}
+	var prevBits uint64
+	for _, v := range values {
+		bits := math.Float64bits(v)
+		binary.BigEndian.PutUint64(buf, bits^prevBits)
+		raw.Write(buf[:8])
+		prevBits = bits
+	}
+
+	var out bytes.Buffer
+	w := gzip.NewWriter(&out)
+	if _, err := w.Write(raw.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// DecodeSamples decodes the data encoded by EncodeSamples.
+func DecodeSamples(data []byte) ([]int64, []float64, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := bytes.NewReader(raw)
+	n, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > uint64(len(raw)) {
+		return nil, nil, fmt.Errorf("samples length %d is invalid", n)
+	}
+	timestamps := make([]int64, n)
+	var prev, delta int64
+	for i := range timestamps {
+		v, err := binary.ReadVarint(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			timestamps[i] = v
+		} else {
+			delta += v
+			timestamps[i] = prev + delta
+		}
+		prev = timestamps[i]
+	}
+	values := make([]float64, n)
+	buf := make([]byte, 8)
+	var prevBits uint64
+	for i := range values {
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, nil, err
+		}
+		prevBits ^= binary.BigEndian.Uint64(buf)
+		values[i] = math.Float64frombits(prevBits)
+	}
+	return timestamps, values, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeSamples(t *testing.T) {
+	as := assert.New(t)
+	timestamps := []int64{1634479813, 1634479843, 1634479873, 1634479903, 1634479950}
+	values := []float64{1.5, 1.5, 2.25, -3, math.Inf(1)}
+	data, err := EncodeSamples(timestamps, values)
+	as.Nil(err)
+	ts, vs, err := DecodeSamples(data)
+	as.Nil(err)
+	as.Equal(timestamps, ts)
+	as.Equal(values, vs)
+
+	data, err = EncodeSamples(nil, nil)
+	as.Nil(err)
+	ts, vs, err = DecodeSamples(data)
+	as.Nil(err)
+	as.Empty(ts)
+	as.Empty(vs)
+
+	_, err = EncodeSamples([]int64{1}, nil)
+	as.NotNil(err)
+	_, _, err = DecodeSamples([]byte("raw"))
+	as.NotNil(err)
+}
+
+func TestSeriesBlob(t *testing.T) {
+	as := assert.New(t)
+	series := Series{Name: "tikv_cpu", Labels: map[string]string{"instance": "tikv-0"}, Timestamps: []int64{1, 2}, Values: []float64{0.5, 0.7}}
+	blob, err := NewSeriesBlob(1, 2, series)
+	as.Nil(err)
+	rst, err := blob.Series()
+	as.Nil(err)
+	as.Equal(series, rst)
+}
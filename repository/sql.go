@@ -14,19 +14,9 @@
 package repository
 
 import (
-	"fmt"
 	"time"
-
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
 )
 
-func NewMysqlManager(address string, database string) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("root@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", address, database)
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	return db, err
-}
-
 type Workload struct {
 	ID           uint `gorm:"AUTO_INCREMENT"`
 	SessionID    uint
@@ -38,6 +28,14 @@ type Workload struct {
 	TargetObject float64
 	BenchName    string
 	Version      string
+	Baseline     bool            // baseline runs are never expired by retention
+	Links        []DashboardLink `gorm:"-" json:",omitempty"` // grafana deep links of the run window, not stored
+}
+
+// DashboardLink is the grafana dashboard url with the time range of the workload.
+type DashboardLink struct {
+	Dashboard string `json:"dashboard"`
+	URL       string `json:"url"`
 }
 
 func (Workload) TableName() string {
@@ -58,6 +56,19 @@ func (Metrics) TableName() string {
 	return "metrics"
 }
 
+type Label struct {
+	ID        uint `gorm:"AUTO_INCREMENT"`
+	SessionID uint
+	WID       uint `gorm:"index"` // the labels of the bench run are copied to every workload of the run
+	BenchName string
+	Name      string
+	Value     string
+}
+
+func (Label) TableName() string {
+	return "label"
+}
+
 type Project struct {
 	ID          uint `gorm:"AUTO_INCREMENT"`
 	Name        string
@@ -68,6 +79,19 @@ func (Project) TableName() string {
 	return "project"
 }
 
+// Retention is the per project rule of metrics history, a run is kept if any rule keeps it, zero disables the rule.
+type Retention struct {
+	ID       uint `json:"id" gorm:"AUTO_INCREMENT"`
+	PID      uint `json:"pid" gorm:"uniqueIndex"`
+	KeepRuns int  `json:"keep_runs"` // keep the last N runs per workload name
+	KeepDays int  `json:"keep_days"` // keep the runs newer than N days
+	Archive  bool `json:"archive"`   // export the expired runs before deletion
+}
+
+func (Retention) TableName() string {
+	return "retention"
+}
+
 type Session struct {
 	ID                   uint   `json:"id" gorm:"AUTO_INCREMENT"`
 	PID                  uint   `json:"pid"`
@@ -79,7 +103,8 @@ type Session struct {
 	TidbAddress          string `json:"tidb_address"`
 	PromAddress          string `json:"prom_address"`
 	GrafanaAddress       string `json:"grafana_address"`
-	GrafanaAuthorization string `json:"grafana_authorization"`
+	GrafanaAuthorization string `json:"grafana_authorization,omitempty"` // write only, injected into the grafana requests by the server
+	GrafanaDashboards    string `json:"grafana_dashboards"`              // comma separated dashboard uids linked from the workloads
 	CreatedAt            time.Time
 	UpdatedAt            time.Time
 }
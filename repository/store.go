@@ -28,5 +28,8 @@ type Record struct {
 	Start    string             `json:"start_ts"`
 	End      string             `json:"end_ts"`
 	Cmd      string             `json:"bench_cmd"`
-	Metrics  map[string]float64 `json:"metrics"` //key metrics_max_avg
+	Config   string             `json:"config"` // pd config snapshot in json
+	Labels   map[string]string  `json:"labels,omitempty"`
+	Series   []Series           `json:"series,omitempty"` // optional raw samples of the metrics
+	Metrics  map[string]float64 `json:"metrics"`          //key metrics_max_avg
 }
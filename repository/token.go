@@ -0,0 +1,123 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gorm.io/gorm"
+)
+
+// Token is the api token, only the hash of the secret is stored.
+type Token struct {
+	ID   uint   `gorm:"AUTO_INCREMENT"`
+	Name string `gorm:"uniqueIndex;size:128"`
+	Hash string `gorm:"uniqueIndex;size:64"`
+}
+
+func (Token) TableName() string {
+	return "token"
+}
+
+// TokenRole is the role of the token in the project, zero PID means all projects.
+type TokenRole struct {
+	ID      uint `gorm:"AUTO_INCREMENT"`
+	TokenID uint
+	PID     uint
+	Role    string
+}
+
+func (TokenRole) TableName() string {
+	return "token_role"
+}
+
+type TokenStorage interface {
+	SaveToken(name, secret string, roles map[uint]string) error
+	// GetTokenRoles returns the name and roles keyed by project of the secret, not found error if it does not exist.
+	GetTokenRoles(secret string) (string, map[uint]string, error)
+	DeleteToken(name string) error
+}
+
+type TokenDao struct {
+	db *gorm.DB
+}
+
+func NewTokenDao(db *gorm.DB) TokenStorage {
+	db.AutoMigrate(&Token{}, &TokenRole{})
+	return &TokenDao{db: db}
+}
+
+// HashToken returns the stored form of the secret.
+func HashToken(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+func (t *TokenDao) SaveToken(name, secret string, roles map[uint]string) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if m := tx.Model(&Token{}).Where(&Token{Name: name}).Count(&count); m.Error != nil {
+			return m.Error
+		}
+		if count > 0 {
+			return errs.Conflict("token %s already exists", name)
+		}
+		token := Token{Name: name, Hash: HashToken(secret)}
+		if m := tx.Create(&token); m.Error != nil {
+			return m.Error
+		}
+		for pid, role := range roles {
+			if m := tx.Create(&TokenRole{TokenID: token.ID, PID: pid, Role: role}); m.Error != nil {
+				return m.Error
+			}
+		}
+		return nil
+	})
+}
+
+func (t *TokenDao) GetTokenRoles(secret string) (string, map[uint]string, error) {
+	var tokens []Token
+	if m := t.db.Where(&Token{Hash: HashToken(secret)}).Find(&tokens); m.Error != nil {
+		return "", nil, m.Error
+	}
+	if len(tokens) == 0 {
+		return "", nil, errs.NotFound("token not found")
+	}
+	var roles []TokenRole
+	if m := t.db.Where(&TokenRole{TokenID: tokens[0].ID}).Find(&roles); m.Error != nil {
+		return "", nil, m.Error
+	}
+	result := make(map[uint]string, len(roles))
+	for _, r := range roles {
+		result[r.PID] = r.Role
+	}
+	return tokens[0].Name, result, nil
+}
+
+func (t *TokenDao) DeleteToken(name string) error {
+	var tokens []Token
+	if m := t.db.Where(&Token{Name: name}).Find(&tokens); m.Error != nil {
+		return m.Error
+	}
+	if len(tokens) == 0 {
+		return errs.NotFound("token %s not found", name)
+	}
+	if m := t.db.Where(&TokenRole{TokenID: tokens[0].ID}).Delete(&TokenRole{}); m.Error != nil {
+		return m.Error
+	}
+	m := t.db.Delete(&tokens[0])
+	return m.Error
+}
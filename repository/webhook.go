@@ -0,0 +1,128 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"gorm.io/gorm"
+)
+
+// Webhook is the per project subscription, empty Events subscribes all events.
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"AUTO_INCREMENT"`
+	PID       uint      `json:"pid" gorm:"index"`
+	URL       string    `json:"url"`
+	Events    string    `json:"events"`           // comma separated event names
+	Secret    string    `json:"secret,omitempty"` // hmac key of the payload signature
+	Format    string    `json:"format"`           // json, slack or lark
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhook"
+}
+
+// Subscribes returns true if the webhook subscribes the event.
+func (w Webhook) Subscribes(event string) bool {
+	if strings.TrimSpace(w.Events) == "" {
+		return true
+	}
+	for _, e := range strings.Split(w.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one delivery attempt of the event, zero Status means the request failed before the response.
+type WebhookDelivery struct {
+	ID        uint      `json:"id" gorm:"AUTO_INCREMENT"`
+	WebhookID uint      `json:"webhook_id" gorm:"index"`
+	Event     string    `json:"event"`
+	Payload   string    `json:"payload" gorm:"type:text"`
+	Attempt   int       `json:"attempt"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+type WebhookStorage interface {
+	SaveWebhook(webhook *Webhook) error
+	GetWebhooks(projectID uint) ([]Webhook, error)
+	// GetWebhook returns the webhook, not found error if it does not exist.
+	GetWebhook(id uint) (Webhook, error)
+	DeleteWebhook(id uint) error
+
+	SaveDelivery(delivery *WebhookDelivery) error
+	// GetDeliveries returns the last deliveries of the webhook, the newest first.
+	GetDeliveries(webhookID uint, limit int) ([]WebhookDelivery, error)
+}
+
+type WebhookDao struct {
+	db *gorm.DB
+}
+
+func NewWebhookDao(db *gorm.DB) WebhookStorage {
+	db.AutoMigrate(&Webhook{}, &WebhookDelivery{})
+	return &WebhookDao{db: db}
+}
+
+func (w *WebhookDao) SaveWebhook(webhook *Webhook) error {
+	m := w.db.Save(webhook)
+	return m.Error
+}
+
+func (w *WebhookDao) GetWebhooks(projectID uint) ([]Webhook, error) {
+	var webhooks []Webhook
+	m := w.db.Where(&Webhook{PID: projectID}).Order("id").Find(&webhooks)
+	return webhooks, m.Error
+}
+
+func (w *WebhookDao) GetWebhook(id uint) (Webhook, error) {
+	var webhooks []Webhook
+	if m := w.db.Where(&Webhook{ID: id}).Find(&webhooks); m.Error != nil {
+		return Webhook{}, m.Error
+	}
+	if len(webhooks) == 0 {
+		return Webhook{}, errs.NotFound("webhook %d not found", id)
+	}
+	return webhooks[0], nil
+}
+
+func (w *WebhookDao) DeleteWebhook(id uint) error {
+	if m := w.db.Where(&WebhookDelivery{WebhookID: id}).Delete(&WebhookDelivery{}); m.Error != nil {
+		return m.Error
+	}
+	m := w.db.Where(&Webhook{ID: id}).Delete(&Webhook{})
+	return m.Error
+}
+
+func (w *WebhookDao) SaveDelivery(delivery *WebhookDelivery) error {
+	m := w.db.Create(delivery)
+	return m.Error
+}
+
+func (w *WebhookDao) GetDeliveries(webhookID uint, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	m := w.db.Where(&WebhookDelivery{WebhookID: webhookID}).Order("id desc").Limit(limit).Find(&deliveries)
+	return deliveries, m.Error
+}
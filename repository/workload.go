@@ -17,24 +17,35 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/bufferflies/pd-analyze/errs"
 	"gorm.io/gorm"
 )
 
 type WorkloadStorage interface {
-	SaveRecords(sessionID uint, benchName string, record []Record) error
+	SaveRecords(sessionID uint, benchName string, record []Record, labels map[string]string) error
 
-	GetWorkloadsByName(sessionID uint, benchName string) ([]Workload, error)
+	GetWorkloadsByName(sessionID uint, benchName string, selectors ...LabelSelector) ([]Workload, error)
 	GetWorkloadsBySessionID(sessionID uint) ([]Workload, error)
 	GetWorkloadNameAndVersion(sessionID uint) ([]Workload, error)
 
-	GetWorkload(workload, version string, sessionID uint, page, size int) (int64, []Workload, error)
+	GetWorkload(workload, version string, sessionID uint, page, size int, selectors ...LabelSelector) (int64, []Workload, error)
 	GetWorkloadByID(id uint) (Workload, error)
+	// SearchWorkloads returns one page of the matched workloads and the cursor of the next page, empty if it is the last page.
+	SearchWorkloads(search WorkloadSearch) ([]Workload, string, error)
+	GetLabels(wID uint) (map[string]string, error)
 	DeleteWorkload(wID uint) error
 	DeleteWorkloadByName(sID uint, name string) error
+	SetBaseline(sessionID uint, benchName string, baseline bool) error
+	// GetBenches returns the benches of the session ordered by start time.
+	GetBenches(sessionID uint) ([]BenchSummary, error)
 
 	GetMetrics(workload uint, limit int, metrics []string) (map[string][]Metrics, error)
 	GetMetricsBySid(sid uint, workload string, limit int, metrics []string) (map[string][]Metrics, error)
 	GetMetricsByLoads(wIDs uint) ([]Metrics, error)
+	// QueryMetrics returns the metrics of the workload across the sessions, zero time is unbounded.
+	QueryMetrics(sessionIDs []uint, workload string, keys []string, start, end time.Time) ([]Metrics, error)
+	// GetSeries returns the raw series of the workload, empty names returns all.
+	GetSeries(wID uint, names []string) ([]Series, error)
 }
 
 type WorkloadDao struct {
@@ -43,12 +54,13 @@ type WorkloadDao struct {
 }
 
 func NewWorkload(db *gorm.DB, project ProjectStorage) WorkloadStorage {
-	db.AutoMigrate(&Workload{}, &Metrics{})
+	db.AutoMigrate(&Workload{}, &Metrics{}, &Label{}, &SeriesBlob{})
 	return &WorkloadDao{db: db, project: project}
 }
 
-func (p *WorkloadDao) GetWorkload(workload string, version string, sessionID uint, page, size int) (int64, []Workload, error) {
-	m := p.db.Model(&Workload{}).Where(&Workload{SessionID: sessionID, Name: workload})
+func (p *WorkloadDao) GetWorkload(workload string, version string, sessionID uint, page, size int, selectors ...LabelSelector) (int64, []Workload, error) {
+	m := p.db.Model(&Workload{}).Where(&Workload{SessionID: sessionID, Name: workload, Version: version})
+	m = applySelectors(m, []uint{sessionID}, selectors)
 	var total int64
 	if me := m.Count(&total); me.Error != nil {
 		return 0, nil, me.Error
@@ -61,7 +73,7 @@ func (p *WorkloadDao) GetWorkload(workload string, version string, sessionID uin
 	return total, workloads, nil
 }
 
-func (p *WorkloadDao) SaveRecords(sessionID uint, benchName string, records []Record) error {
+func (p *WorkloadDao) SaveRecords(sessionID uint, benchName string, records []Record, labels map[string]string) error {
 	workloads := make([]*Workload, len(records))
 	metrics := make([]*Metrics, 0)
 	session, err := p.project.GetSession(sessionID)
@@ -75,6 +87,7 @@ func (p *WorkloadDao) SaveRecords(sessionID uint, benchName string, records []Re
 			Start:        timeStampToTime(v.Start),
 			End:          timeStampToTime(v.End),
 			Cmd:          v.Cmd,
+			Config:       v.Config,
 			TargetObject: getTarget(session.TargetObject, v),
 			BenchName:    benchName,
 		}
@@ -96,16 +109,57 @@ func (p *WorkloadDao) SaveRecords(sessionID uint, benchName string, records []Re
 			metrics = append(metrics, m)
 		}
 	}
-	m = p.db.Save(metrics)
+	if len(metrics) > 0 {
+		if m = p.db.Save(metrics); m.Error != nil {
+			return m.Error
+		}
+	}
+	blobs := make([]*SeriesBlob, 0)
+	for i, r := range records {
+		for _, series := range r.Series {
+			blob, err := NewSeriesBlob(sessionID, workloads[i].ID, series)
+			if err != nil {
+				return err
+			}
+			blobs = append(blobs, blob)
+		}
+	}
+	if len(blobs) > 0 {
+		if m = p.db.Save(blobs); m.Error != nil {
+			return m.Error
+		}
+	}
+	ls := make([]*Label, 0)
+	for i, r := range records {
+		ls = append(ls, workloadLabels(sessionID, workloads[i].ID, benchName, labels, r.Labels)...)
+	}
+	if len(ls) == 0 {
+		return nil
+	}
+	m = p.db.Save(ls)
 	return m.Error
 }
 
-func (p *WorkloadDao) GetWorkloadsByName(sessionID uint, benchName string) ([]Workload, error) {
+func (p *WorkloadDao) GetWorkloadsByName(sessionID uint, benchName string, selectors ...LabelSelector) ([]Workload, error) {
 	var workloads []Workload
-	m := p.db.Where(&Workload{SessionID: sessionID, BenchName: benchName}).Find(&workloads)
+	m := p.db.Where(&Workload{SessionID: sessionID, BenchName: benchName})
+	m = applySelectors(m, []uint{sessionID}, selectors).Find(&workloads)
 	return workloads, m.Error
 }
 
+// GetLabels returns the labels of the workload, which include the labels of its bench run.
+func (p *WorkloadDao) GetLabels(wID uint) (map[string]string, error) {
+	var ls []Label
+	if m := p.db.Where("w_id = ?", wID).Find(&ls); m.Error != nil {
+		return nil, m.Error
+	}
+	labels := make(map[string]string, len(ls))
+	for _, l := range ls {
+		labels[l.Name] = l.Value
+	}
+	return labels, nil
+}
+
 func (p *WorkloadDao) GetWorkloadsBySessionID(sessionID uint) ([]Workload, error) {
 	var workloads []Workload
 	m := p.db.Where(&Workload{SessionID: sessionID}).Find(&workloads)
@@ -125,10 +179,23 @@ func (p *WorkloadDao) DeleteWorkload(wID uint) error {
 	if m := p.db.Where(&Metrics{WID: wID}).Delete(&Metrics{}); m.Error != nil {
 		return m.Error
 	}
+	if m := p.db.Where(&Label{WID: wID}).Delete(&Label{}); m.Error != nil {
+		return m.Error
+	}
+	if m := p.db.Where(&SeriesBlob{WID: wID}).Delete(&SeriesBlob{}); m.Error != nil {
+		return m.Error
+	}
 	return nil
 }
 
 func (p *WorkloadDao) DeleteWorkloadByName(sID uint, name string) error {
+	wIDs := p.db.Model(&Workload{}).Select("id").Where(&Workload{SessionID: sID, Name: name})
+	if m := p.db.Where("w_id IN (?)", wIDs).Delete(&Label{}); m.Error != nil {
+		return m.Error
+	}
+	if m := p.db.Where("w_id IN (?)", wIDs).Delete(&SeriesBlob{}); m.Error != nil {
+		return m.Error
+	}
 	if m := p.db.Where(&Workload{SessionID: sID, Name: name}).Delete(&Workload{}); m.Error != nil {
 		return m.Error
 	}
@@ -138,6 +205,32 @@ func (p *WorkloadDao) DeleteWorkloadByName(sID uint, name string) error {
 	return nil
 }
 
+func (p *WorkloadDao) SetBaseline(sessionID uint, benchName string, baseline bool) error {
+	m := p.db.Model(&Workload{}).Where(&Workload{SessionID: sessionID, BenchName: benchName}).Update("baseline", baseline)
+	return m.Error
+}
+
+// BenchSummary is the runs of a bench in the session.
+type BenchSummary struct {
+	Name      string    `json:"name"`
+	Workloads int64     `json:"workloads"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Baseline  bool      `json:"baseline"`
+}
+
+func (p *WorkloadDao) GetBenches(sessionID uint) ([]BenchSummary, error) {
+	var benches []BenchSummary
+	m := p.benchesQuery(sessionID).Scan(&benches)
+	return benches, m.Error
+}
+
+func (p *WorkloadDao) benchesQuery(sessionID uint) *gorm.DB {
+	return p.db.Model(&Workload{}).
+		Select("bench_name AS name, COUNT(*) AS workloads, MIN(start) AS start, MAX(`end`) AS `end`, MAX(baseline) AS baseline").
+		Where("session_id = ?", sessionID).Group("bench_name").Order("start")
+}
+
 func (p *WorkloadDao) DeleteSession(sID uint) error {
 	if m := p.db.Delete(&Session{ID: sID}); m.Error != nil {
 		return m.Error
@@ -148,6 +241,12 @@ func (p *WorkloadDao) DeleteSession(sID uint) error {
 	if m := p.db.Delete(&Metrics{SessionID: sID}); m.Error != nil {
 		return m.Error
 	}
+	if m := p.db.Delete(&Label{SessionID: sID}); m.Error != nil {
+		return m.Error
+	}
+	if m := p.db.Delete(&SeriesBlob{SessionID: sID}); m.Error != nil {
+		return m.Error
+	}
 	return nil
 }
 
@@ -175,6 +274,25 @@ func (p *WorkloadDao) GetMetricsBySid(sid uint, name string, limit int, metrics
 	return rst, nil
 }
 
+func (p *WorkloadDao) QueryMetrics(sessionIDs []uint, workload string, keys []string, start, end time.Time) ([]Metrics, error) {
+	var metrics []Metrics
+	if len(sessionIDs) == 0 || len(keys) == 0 {
+		return metrics, nil
+	}
+	if workload == "" {
+		return nil, errs.InvalidArgument("workload is required")
+	}
+	m := p.db.Where("session_id IN ? AND `key` IN ? AND name = ?", sessionIDs, keys, workload)
+	if !start.IsZero() {
+		m = m.Where("start >= ?", start)
+	}
+	if !end.IsZero() {
+		m = m.Where("start <= ?", end)
+	}
+	m = m.Order("start").Find(&metrics)
+	return metrics, m.Error
+}
+
 func (p *WorkloadDao) GetWorkloadNameAndVersion(sessionID uint) ([]Workload, error) {
 	var workloads []Workload
 	m := p.db.Distinct("name").Where(&Workload{SessionID: sessionID}).Find(&workloads)
@@ -187,6 +305,26 @@ func (p *WorkloadDao) GetMetricsByLoads(wID uint) ([]Metrics, error) {
 	return metrics, m.Error
 }
 
+func (p *WorkloadDao) GetSeries(wID uint, names []string) ([]Series, error) {
+	var blobs []SeriesBlob
+	m := p.db.Where(&SeriesBlob{WID: wID})
+	if len(names) > 0 {
+		m = m.Where("name IN ?", names)
+	}
+	if m = m.Order("id").Find(&blobs); m.Error != nil {
+		return nil, m.Error
+	}
+	result := make([]Series, len(blobs))
+	for i, b := range blobs {
+		series, err := b.Series()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = series
+	}
+	return result, nil
+}
+
 func getTarget(target string, record Record) float64 {
 	for k, v := range record.Metrics {
 		if k == target {
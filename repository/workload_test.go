@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// mockDB returns the db whose statements are checked by the mock.
+func mockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	as := assert.New(t)
+	conn, mock, err := sqlmock.New()
+	as.NoError(err)
+	t.Cleanup(func() {
+		as.NoError(mock.ExpectationsWereMet())
+		conn.Close()
+	})
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	as.NoError(err)
+	return db, mock
+}
+
+type stubProjectStorage struct {
+	ProjectStorage
+}
+
+func (stubProjectStorage) GetSession(id uint) (Session, error) {
+	return Session{ID: id}, nil
+}
+
+func TestSaveRecordsLabels(t *testing.T) {
+	db, mock := mockDB(t)
+	dao := &WorkloadDao{db: db, project: stubProjectStorage{}}
+	records := []Record{
+		{Workload: "w1", Start: "1634479813", End: "1634479873"},
+		{Workload: "w2", Start: "1634479873", End: "1634479933", Labels: map[string]string{"pr": "2", "tables": "16"}},
+	}
+
+	// every workload gets the labels of the bench run, its own labels win.
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `workload`").WillReturnResult(sqlmock.NewResult(10, 2))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO `label` \\(`session_id`,`w_id`,`bench_name`,`name`,`value`\\)").
+		WithArgs(1, 10, "tpcc", "pr", "1", 1, 11, "tpcc", "pr", "2", 1, 11, "tpcc", "tables", "16").
+		WillReturnResult(sqlmock.NewResult(1, 3))
+	mock.ExpectCommit()
+	assert.New(t).NoError(dao.SaveRecords(1, "tpcc", records, map[string]string{"pr": "1"}))
+}
+
+func TestGetLabels(t *testing.T) {
+	as := assert.New(t)
+	db, mock := mockDB(t)
+	dao := &WorkloadDao{db: db}
+	mock.ExpectQuery("SELECT \\* FROM `label` WHERE w_id = \\?").WithArgs(11).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "session_id", "w_id", "bench_name", "name", "value"}).
+			AddRow(1, 1, 11, "tpcc", "pr", "2").AddRow(2, 1, 11, "tpcc", "tables", "16"))
+	labels, err := dao.GetLabels(11)
+	as.NoError(err)
+	as.Equal(map[string]string{"pr": "2", "tables": "16"}, labels)
+}
+
+func TestDeleteWorkload(t *testing.T) {
+	db, mock := mockDB(t)
+	dao := &WorkloadDao{db: db}
+	for _, table := range []string{"workload", "metrics"} {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `" + table + "`").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}
+	// the labels of the workload include the bench labels, so none is left behind.
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `label` WHERE `label`.`w_id` = \\?").WithArgs(11).WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM `series`").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	assert.New(t).NoError(dao.DeleteWorkload(11))
+}
@@ -14,11 +14,12 @@
 package server
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/core"
 	"github.com/bufferflies/pd-analyze/repository"
 
 	"github.com/bufferflies/pd-analyze/errs"
@@ -35,223 +36,399 @@ func NewPromAnalyze(server *Server) *PromAnalyze {
 	}
 }
 
-// @Tags analyze
-// @Summary analyze hot scheduler
-// @Produce json
-// @Success 200 {object}
-// @Failure 500 {string} string "PD server failed to proceed the request."
-// @Router /analyze/{session_id}/{bench_name} [get]
 func (analyze *PromAnalyze) GetWorkloadsByBenchName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	id, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, err)
+		writeError(w, err)
 		return
 	}
-	benchName := vars["bench_name"]
-	records, err := analyze.server.workloadStorage.GetWorkloadsByName(uint(id), benchName)
+	benchName := mux.Vars(r)["bench_name"]
+	records, err := analyze.server.workloadStorage.GetWorkloadsByName(id, benchName)
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
-	rsp, err := json.Marshal(records)
-	if err != nil {
-		fmt.Fprint(w, err.Error())
-		return
-	}
-	fmt.Fprint(w, string(rsp))
+	writeJSON(w, http.StatusOK, records)
 }
 
-// @Tags analyze
-// @Summary get analyze workload names and type
-// @Produce json
-// @Success 200 {object}
-// @Failure 500 {string} string "PD server failed to proceed the request."
-// @Router /analyze/config/{session_id} [get]
 func (analyze *PromAnalyze) GetWorkloadNames(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
 
-	result, err := analyze.server.workloadStorage.GetWorkloadNameAndVersion(uint(sid))
-	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
-		return
-	}
-	rsp, err := json.Marshal(result)
+	result, err := analyze.server.workloadStorage.GetWorkloadNameAndVersion(sid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(rsp))
+	writeJSON(w, http.StatusOK, result)
 }
 
-// @Tags analyze
-// @Summary get analyze
-// @Produce json
-// @Success 200 {object}
-// @Failure 500 {string} string "PD server failed to proceed the request."
-// @Router /analyze//workload{session_id} [get]
 func (analyze *PromAnalyze) GetWorkloads(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
 
 	query := r.URL.Query()
 	version := query.Get("version")
-	page, err := strconv.Atoi(query.Get("page"))
+	page, err := queryInt(query, "page", 1, 1)
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
-	size, err := strconv.Atoi(query.Get("size"))
+	size, err := queryInt(query, "size", 20, 1)
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
 
-	workload := query.Get("workload")
-	count, loads, err := analyze.server.workloadStorage.GetWorkload(workload, version, uint(sid), page, size)
+	selectors, err := repository.ParseLabelSelectors(query["label"])
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
-	result := make(map[string]interface{})
-	result["workloads"] = loads
-	result["count"] = count
-	rsp, err := json.Marshal(result)
+
+	workload := query.Get("workload")
+	count, loads, err := analyze.server.workloadStorage.GetWorkload(workload, version, sid, page, size, selectors...)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
+		return
+	}
+	if err = analyze.server.withLinks(loads); err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(rsp))
+	writeJSON(w, http.StatusOK, api.WorkloadPage{Count: count, Workloads: loads})
 }
 
-// @Tags analyze
-// @Summary delete workloads
-// @Produce json
-// @Success 200 {object}
-// @Router /analyze/workload/{workload_id} [get]
 func (analyze *PromAnalyze) DeleteWorkloads(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	wID, err := strconv.ParseUint(vars["workload_id"], 10, 32)
+	wID, err := pathUint(r, "workload_id")
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
+		return
+	}
+	if _, err = analyze.getWorkload(wID); err != nil {
+		writeError(w, err)
 		return
 	}
-	if err = analyze.server.workloadStorage.DeleteWorkload(uint(wID)); err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+	if err = analyze.server.workloadStorage.DeleteWorkload(wID); err != nil {
+		writeError(w, err)
 		return
 	}
 
-	fmt.Fprint(w, "ok")
+	writeOK(w)
 }
 
-// @Tags analyze
-// @Summary delete workloads
-// @Produce json
-// @Success 200 {object}
-// @Router /analyze/workload/{session_id}/{workload_name} [get]
 func (analyze *PromAnalyze) DeleteWorkloadByName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sID, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sID, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
 
 	name := r.URL.Query().Get("workload_name")
-	if err = analyze.server.workloadStorage.DeleteWorkloadByName(uint(sID), name); err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+	if name == "" {
+		writeError(w, errs.InvalidArgument("query parameter workload_name is required"))
+		return
+	}
+	if err = analyze.server.workloadStorage.DeleteWorkloadByName(sID, name); err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	writeOK(w)
 }
 
-// @Tags analyze
-// @Summary get analyze
-// @Produce json
-// @Success 200 {object}
-// @Router /analyze/bench/{session_id}/{name}/ [get]
 func (analyze *PromAnalyze) GetBench(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	name := mux.Vars(r)["name"]
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	selectors, err := repository.ParseLabelSelectors(r.URL.Query()["label"])
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
-	loads, err := analyze.server.workloadStorage.GetWorkloadsByName(uint(sid), name)
+	result, err := analyze.benchMetrics(sid, name, selectors)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	result := make([]WorkloadMetrics, len(loads))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// benchMetrics returns the workloads of the bench with their metrics, labels and dashboard links.
+func (analyze *PromAnalyze) benchMetrics(sid uint, name string, selectors []repository.LabelSelector) ([]api.WorkloadMetrics, error) {
+	loads, err := analyze.server.workloadStorage.GetWorkloadsByName(sid, name, selectors...)
+	if err != nil {
+		return nil, err
+	}
+	if err = analyze.server.withLinks(loads); err != nil {
+		return nil, err
+	}
+	result := make([]api.WorkloadMetrics, len(loads))
 	for i, l := range loads {
 		metrics, err := analyze.server.workloadStorage.GetMetricsByLoads(l.ID)
 		if err != nil {
-			fmt.Fprint(w, err.Error())
-			return
+			return nil, err
+		}
+		labels, err := analyze.server.workloadStorage.GetLabels(l.ID)
+		if err != nil {
+			return nil, err
 		}
-		result[i] = WorkloadMetrics{Workload: l, Metrics: metrics}
+		result[i] = api.WorkloadMetrics{Workload: l, Metrics: metrics, Labels: labels}
+	}
+	return result, nil
+}
+
+func (analyze *PromAnalyze) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	name := query.Get("workload")
+	limit, err := queryInt(query, "limit", 10, 1)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
-	rsp, err := json.Marshal(result)
+	metrics := query["metrics"]
+	rst, err := analyze.server.workloadStorage.GetMetricsBySid(sid, name, limit, metrics)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(rsp))
+	writeJSON(w, http.StatusOK, rst)
 }
 
-// @Tags analyze
-// @Summary analyze hot scheduler
-// @Produce json
-// @Success 200 {object}
-// @Failure 500 {string} string "PD server failed to proceed the request."
-// @Router /analyze/getMetrics [get]
-func (analyze *PromAnalyze) GetMetrics(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+func (analyze *PromAnalyze) SetBaseline(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	baseline := r.Method != http.MethodDelete
+	if err = analyze.server.workloadStorage.SetBaseline(sid, name, baseline); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (analyze *PromAnalyze) GetSeries(w http.ResponseWriter, r *http.Request) {
+	wID, err := pathUint(r, "workload_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	series, err := analyze.server.workloadStorage.GetSeries(wID, r.URL.Query()["name"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, series)
+}
+
+func (analyze *PromAnalyze) GetWorkloadDetail(w http.ResponseWriter, r *http.Request) {
+	wID, err := pathUint(r, "workload_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	load, err := analyze.getWorkloadMetrics(wID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if load.Labels, err = analyze.server.workloadStorage.GetLabels(wID); err != nil {
+		writeError(w, err)
+		return
+	}
+	loads := []repository.Workload{load.Workload}
+	if err = analyze.server.withLinks(loads); err != nil {
+		writeError(w, err)
+		return
+	}
+	load.Workload = loads[0]
+	writeJSON(w, http.StatusOK, load)
+}
+
+func (analyze *PromAnalyze) GetBenches(w http.ResponseWriter, r *http.Request) {
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	benches, err := analyze.server.workloadStorage.GetBenches(sid)
 	if err != nil {
-		fmt.Fprint(w, errs.Argument_Not_Match.Error())
+		writeError(w, err)
 		return
 	}
-	err = r.ParseForm()
+	writeJSON(w, http.StatusOK, benches)
+}
+
+func (analyze *PromAnalyze) Evaluate(w http.ResponseWriter, r *http.Request) {
+	wID, err := pathUint(r, "workload_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
 	query := r.URL.Query()
-	name := query.Get("workload")
-	limit, err := strconv.Atoi(query.Get("limit"))
+	name, expr := query.Get("name"), query.Get("expr")
+	if name == "" || expr == "" {
+		writeError(w, errs.InvalidArgument("query parameters name and expr are required"))
+		return
+	}
+	load, err := analyze.getWorkload(wID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	start, end := strconv.FormatInt(load.Start.Unix(), 10), strconv.FormatInt(load.End.Unix(), 10)
+	checker := core.NewChecker(newSeriesSource(analyze.server.workloadStorage, wID))
+	result, err := checker.Apply(start, end, name, name, expr)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, errs.Wrap(errs.CodeInvalidArgument, err, "evaluate %s failed", expr))
 		return
 	}
+	writeJSON(w, http.StatusOK, result)
+}
 
-	metrics := query["metrics"]
-	rst, err := analyze.server.workloadStorage.GetMetricsBySid(uint(sid), name, limit, metrics)
+func (analyze *PromAnalyze) QueryMetrics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	// the series of different workloads can not be aligned by index
+	workload := query.Get("workload")
+	if workload == "" {
+		writeError(w, errs.InvalidArgument("query parameter workload is required"))
+		return
+	}
+	sessionIDs, _, err := analyze.querySessions(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	start, err := parseUnix(query.Get("start"))
+	if err != nil {
+		writeError(w, errs.InvalidArgument("query parameter start must be an unix timestamp"))
+		return
+	}
+	end, err := parseUnix(query.Get("end"))
+	if err != nil {
+		writeError(w, errs.InvalidArgument("query parameter end must be an unix timestamp"))
+		return
+	}
+	keys := query["metrics"]
+	metrics, err := analyze.server.workloadStorage.QueryMetrics(sessionIDs, workload, keys, start, end)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, groupBySession(sessionIDs, metrics))
+}
+
+func (analyze *PromAnalyze) DiffWorkloads(w http.ResponseWriter, r *http.Request) {
+	oldID, err := pathUint(r, "workload_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	body, err := json.Marshal(rst)
+	newID, err := pathUint(r, "other_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(body))
-	return
+	old, err := analyze.getWorkloadMetrics(oldID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	new, err := analyze.getWorkloadMetrics(newID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	changes, err := core.DiffConfig(old.Config, new.Config)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.CodeInvalidArgument, err, "workload config is not json"))
+		return
+	}
+	loads := []repository.Workload{old.Workload, new.Workload}
+	if err = analyze.server.withLinks(loads); err != nil {
+		writeError(w, err)
+		return
+	}
+	result := api.WorkloadDiff{
+		Old:     loads[0],
+		New:     loads[1],
+		Config:  changes,
+		Metrics: core.DiffMetrics(old.MetricsMap(), new.MetricsMap()),
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getWorkload returns the workload, it is not found error if the workload does not exist.
+func (analyze *PromAnalyze) getWorkload(wID uint) (repository.Workload, error) {
+	load, err := analyze.server.workloadStorage.GetWorkloadByID(wID)
+	if err != nil {
+		return load, err
+	}
+	if load.ID == 0 {
+		return load, errs.NotFound("workload %d not found", wID)
+	}
+	return load, nil
+}
+
+func (analyze *PromAnalyze) getWorkloadMetrics(wID uint) (api.WorkloadMetrics, error) {
+	load, err := analyze.getWorkload(wID)
+	if err != nil {
+		return api.WorkloadMetrics{}, err
+	}
+	metrics, err := analyze.server.workloadStorage.GetMetricsByLoads(wID)
+	if err != nil {
+		return api.WorkloadMetrics{}, err
+	}
+	return api.WorkloadMetrics{Workload: load, Metrics: metrics}, nil
+}
+
+// groupBySession groups the metrics ordered by start, every requested session has a result in order.
+func groupBySession(sessionIDs []uint, metrics []repository.Metrics) []api.SessionSeries {
+	result := make([]api.SessionSeries, 0, len(sessionIDs))
+	index := make(map[uint]int, len(sessionIDs))
+	for _, sid := range sessionIDs {
+		if _, ok := index[sid]; ok {
+			continue
+		}
+		index[sid] = len(result)
+		result = append(result, api.SessionSeries{SessionID: sid, Metrics: make(map[string][]api.MetricPoint)})
+	}
+	for _, m := range metrics {
+		i, ok := index[m.SessionID]
+		if !ok {
+			continue
+		}
+		points := result[i].Metrics[m.Key]
+		result[i].Metrics[m.Key] = append(points, api.MetricPoint{WID: m.WID, Index: len(points), Start: m.Start, Value: m.Value})
+	}
+	return result
 }
 
-type WorkloadMetrics struct {
-	repository.Workload
-	Metrics []repository.Metrics
+// parseUnix parses the unix timestamp in seconds, empty is zero time.
+func parseUnix(ts string) (time.Time, error) {
+	if ts == "" {
+		return time.Time{}, nil
+	}
+	v, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(v, 0), nil
 }
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *stubWorkloadStorage) QueryMetrics(sessionIDs []uint, workload string, keys []string, start, end time.Time) ([]repository.Metrics, error) {
+	return s.metrics[sessionIDs[0]], nil
+}
+
+func TestQueryMetrics(t *testing.T) {
+	as := assert.New(t)
+	server := &Server{
+		config:          &config.Config{},
+		workloadStorage: &stubWorkloadStorage{metrics: map[uint][]repository.Metrics{1: {{WID: 1, SessionID: 1, Key: "qps", Value: 1}}}},
+		projectStorage:  &stubProjectStorage{sessions: map[uint]repository.Session{1: {ID: 1}}},
+	}
+	router := server.CreateRoute()
+	query := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/analyze/query?"+query, nil))
+		return w
+	}
+	w := query("session_id=1&metrics=qps")
+	as.Equal(http.StatusBadRequest, w.Code)
+	as.Contains(w.Body.String(), "workload is required")
+	w = query("session_id=1&metrics=qps&workload=w1")
+	as.Equal(http.StatusOK, w.Code, w.Body.String())
+	as.Contains(w.Body.String(), `"qps"`)
+}
+
+func TestGroupBySession(t *testing.T) {
+	as := assert.New(t)
+	now := time.Unix(1634479813, 0)
+	metrics := []repository.Metrics{
+		{WID: 1, SessionID: 1, Key: "tikv_cpu_avg", Value: 1, Start: now},
+		{WID: 2, SessionID: 2, Key: "tikv_cpu_avg", Value: 2, Start: now.Add(time.Minute)},
+		{WID: 3, SessionID: 1, Key: "tikv_cpu_avg", Value: 3, Start: now.Add(2 * time.Minute)},
+		{WID: 3, SessionID: 1, Key: "tidb_duration_P99", Value: 4, Start: now.Add(2 * time.Minute)},
+		{WID: 4, SessionID: 5, Key: "tikv_cpu_avg", Value: 5, Start: now.Add(3 * time.Minute)},
+	}
+	result := groupBySession([]uint{2, 1, 3, 2}, metrics)
+	as.Len(result, 3)
+	as.Equal(uint(2), result[0].SessionID)
+	as.Equal([]api.MetricPoint{{WID: 2, Index: 0, Start: now.Add(time.Minute), Value: 2}}, result[0].Metrics["tikv_cpu_avg"])
+	as.Equal(uint(1), result[1].SessionID)
+	as.Equal([]api.MetricPoint{
+		{WID: 1, Index: 0, Start: now, Value: 1},
+		{WID: 3, Index: 1, Start: now.Add(2 * time.Minute), Value: 3},
+	}, result[1].Metrics["tikv_cpu_avg"])
+	as.Len(result[1].Metrics["tidb_duration_P99"], 1)
+	as.Empty(result[2].Metrics)
+}
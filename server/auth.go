@@ -0,0 +1,395 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
+)
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReader
+	RoleWriter
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{RoleNone: "none", RoleReader: "reader", RoleWriter: "writer", RoleAdmin: "admin"}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func ParseRole(s string) (Role, error) {
+	for r, name := range roleNames {
+		if name == s && r != RoleNone {
+			return r, nil
+		}
+	}
+	return RoleNone, errs.InvalidArgument("role %q must be reader, writer or admin", s)
+}
+
+// allProjects is the key of the role granted on all projects.
+const allProjects = "*"
+
+// publicRoutes need no token, the ui only serves static files and calls the api with the token.
+var publicRoutes = map[string]bool{
+	"GET /ui":           true,
+	"GET /ui/":          true,
+	"GET /openapi.json": true,
+	"GET /healthz":      true,
+	"GET /readyz":       true,
+	"GET /version":      true,
+	"GET /metrics":      true,
+}
+
+// adminRoutes need the admin role, other routes need reader for GET and writer for the rest.
+var adminRoutes = map[string]bool{
+	"POST /project/new":                                 true,
+	"DELETE /project/{project_id}":                      true,
+	"POST /project/import":                              true,
+	"POST /project/retention/{project_id}":              true,
+	"DELETE /project/session/{session_id}":              true,
+	"POST /auth/token":                                  true,
+	"DELETE /auth/token/{name}":                         true,
+	"POST /project/webhook/{project_id}":                true,
+	"DELETE /project/webhook/{project_id}/{webhook_id}": true,
+}
+
+// Grant is the roles of a token keyed by project id, zero means all projects.
+type Grant struct {
+	Name  string
+	Roles map[uint]Role
+}
+
+// Role returns the role of the token in the project, zero project means the role on all projects.
+func (g *Grant) Role(pid uint) Role {
+	role := g.Roles[0]
+	if r := g.Roles[pid]; r > role {
+		role = r
+	}
+	return role
+}
+
+// TokenStore looks up the grant of the token, nil is returned if the token is unknown.
+type TokenStore interface {
+	Lookup(token string) (*Grant, error)
+}
+
+// parseRoles parses the roles keyed by project id or `*`.
+func parseRoles(roles map[string]string) (map[uint]Role, error) {
+	result := make(map[uint]Role, len(roles))
+	for k, v := range roles {
+		var pid uint64
+		if k != allProjects {
+			var err error
+			if pid, err = strconv.ParseUint(k, 10, 32); err != nil || pid == 0 {
+				return nil, errs.InvalidArgument("project %q must be a project id or %s", k, allProjects)
+			}
+		}
+		role, err := ParseRole(v)
+		if err != nil {
+			return nil, err
+		}
+		result[uint(pid)] = role
+	}
+	return result, nil
+}
+
+type fileToken struct {
+	Name  string            `json:"name"`
+	Token string            `json:"token"`
+	Roles map[string]string `json:"roles"`
+}
+
+type fileTokenStore struct {
+	grants map[string]*Grant
+}
+
+// NewFileTokenStore loads the static tokens from a json file like
+// `[{"name":"ci","token":"secret","roles":{"*":"reader","3":"writer"}}]`.
+func NewFileTokenStore(path string) (TokenStore, error) {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []fileToken
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	store := &fileTokenStore{grants: make(map[string]*Grant, len(tokens))}
+	for _, t := range tokens {
+		if t.Token == "" {
+			return nil, errs.InvalidArgument("token %s is empty", t.Name)
+		}
+		roles, err := parseRoles(t.Roles)
+		if err != nil {
+			return nil, err
+		}
+		store.grants[t.Token] = &Grant{Name: t.Name, Roles: roles}
+	}
+	return store, nil
+}
+
+func (s *fileTokenStore) Lookup(token string) (*Grant, error) {
+	return s.grants[token], nil
+}
+
+type dbTokenStore struct {
+	storage repository.TokenStorage
+}
+
+func NewDBTokenStore(storage repository.TokenStorage) TokenStore {
+	return &dbTokenStore{storage: storage}
+}
+
+func (s *dbTokenStore) Lookup(token string) (*Grant, error) {
+	name, roles, err := s.storage.GetTokenRoles(token)
+	if err != nil {
+		if errs.Convert(err).Code == errs.CodeNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	grant := &Grant{Name: name, Roles: make(map[uint]Role, len(roles))}
+	for pid, r := range roles {
+		if role, err := ParseRole(r); err == nil {
+			grant.Roles[pid] = role
+		}
+	}
+	return grant, nil
+}
+
+type Auth struct {
+	server *Server
+	stores []TokenStore
+}
+
+func NewAuth(server *Server, stores ...TokenStore) *Auth {
+	return &Auth{server: server, stores: stores}
+}
+
+// Middleware checks the token of the request has the role the route needs in the projects it touches.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || publicRoutes[routeKey(r)] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := requestToken(r)
+		if token == "" {
+			writeError(w, errs.Unauthenticated("token is required"))
+			return
+		}
+		grant, err := a.lookup(token)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if grant == nil {
+			writeError(w, errs.Unauthenticated("token is invalid"))
+			return
+		}
+		required := requiredRole(r)
+		pids, err := a.projects(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(pids) == 0 {
+			pids = []uint{0}
+		}
+		for _, pid := range pids {
+			if grant.Role(pid) < required {
+				writeError(w, errs.Forbidden("token %s needs %s role", grant.Name, required))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Auth) lookup(token string) (*Grant, error) {
+	for _, s := range a.stores {
+		grant, err := s.Lookup(token)
+		if err != nil || grant != nil {
+			return grant, err
+		}
+	}
+	return nil, nil
+}
+
+// requestToken returns the bearer token or the X-Auth-Token header.
+func requestToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-Auth-Token")
+}
+
+// routeKey returns the method and path template of the matched route.
+func routeKey(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+	return ""
+}
+
+func requiredRole(r *http.Request) Role {
+	if adminRoutes[routeKey(r)] {
+		return RoleAdmin
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return RoleReader
+	}
+	return RoleWriter
+}
+
+// projects returns the projects the request touches, empty means the request is not scoped by project.
+func (a *Auth) projects(r *http.Request) ([]uint, error) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	pids := make([]uint, 0, 1)
+	if v, ok := vars["project_id"]; ok {
+		pid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errs.InvalidArgument("path parameter project_id must be an unsigned integer")
+		}
+		pids = append(pids, uint(pid))
+	}
+	sessionIDs := append([]string{vars["session_id"]}, query["session_id"]...)
+	if pid := query.Get("project_id"); pid != "" {
+		v, err := strconv.ParseUint(pid, 10, 32)
+		if err != nil {
+			return nil, errs.InvalidArgument("query parameter project_id must be an unsigned integer")
+		}
+		pids = append(pids, uint(v))
+	}
+	for _, name := range []string{"workload_id", "other_id"} {
+		if v, ok := vars[name]; ok {
+			wID, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return nil, errs.InvalidArgument("path parameter %s must be an unsigned integer", name)
+			}
+			load, err := a.server.workloadStorage.GetWorkloadByID(uint(wID))
+			if err != nil {
+				return nil, err
+			}
+			if load.ID != 0 {
+				sessionIDs = append(sessionIDs, strconv.FormatUint(uint64(load.SessionID), 10))
+			}
+		}
+	}
+	if r.Method == http.MethodPost && r.URL.Path == "/project/session/new" {
+		pid, err := peekSessionProject(r)
+		if err != nil {
+			return nil, err
+		}
+		pids = append(pids, pid)
+	}
+	for _, v := range sessionIDs {
+		if v == "" {
+			continue
+		}
+		sid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, errs.InvalidArgument("session_id must be an unsigned integer")
+		}
+		session, err := a.server.projectStorage.GetSession(uint(sid))
+		if err != nil {
+			return nil, err
+		}
+		if session.ID != 0 {
+			pids = append(pids, session.PID)
+		}
+	}
+	return pids, nil
+}
+
+// peekSessionProject reads the project of the new session and restores the body for the handler.
+func peekSessionProject(r *http.Request) (uint, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	var session repository.Session
+	if err := json.Unmarshal(body, &session); err != nil {
+		return 0, errs.Wrap(errs.CodeInvalidArgument, err, "request body is invalid")
+	}
+	return session.PID, nil
+}
+
+func (server *Server) CreateToken(w http.ResponseWriter, r *http.Request) {
+	if server.tokenStorage == nil {
+		writeError(w, errs.NotFound("db tokens are not enabled"))
+		return
+	}
+	var req api.TokenRequest
+	if err := decodeBody(r.Body, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Name == "" {
+		writeError(w, errs.InvalidArgument("name is required"))
+		return
+	}
+	roles, err := parseRoles(req.Roles)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		writeError(w, err)
+		return
+	}
+	secret := hex.EncodeToString(buf)
+	stored := make(map[uint]string, len(roles))
+	for pid, role := range roles {
+		stored[pid] = role.String()
+	}
+	if err := server.tokenStorage.SaveToken(req.Name, secret, stored); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.TokenResponse{Name: req.Name, Token: secret})
+}
+
+func (server *Server) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	if server.tokenStorage == nil {
+		writeError(w, errs.NotFound("db tokens are not enabled"))
+		return
+	}
+	if err := server.tokenStorage.DeleteToken(mux.Vars(r)["name"]); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
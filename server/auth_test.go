@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	as := assert.New(t)
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	tokens := `[{"name":"ci","token":"ci-secret","roles":{"*":"reader","3":"writer"}},
+		{"name":"ops","token":"ops-secret","roles":{"*":"admin"}}]`
+	as.Nil(ioutil.WriteFile(path, []byte(tokens), 0644))
+	store, err := NewFileTokenStore(path)
+	as.Nil(err)
+
+	ok := func(w http.ResponseWriter, r *http.Request) { writeOK(w) }
+	router := mux.NewRouter()
+	router.HandleFunc("/project/", ok).Methods(http.MethodGet)
+	router.HandleFunc("/project/new", ok).Methods(http.MethodPost)
+	router.HandleFunc("/project/retention/{project_id}", ok).Methods(http.MethodGet, http.MethodPost)
+	router.Use(NewAuth(&Server{}, store).Middleware)
+
+	cases := []struct {
+		method, url, token string
+		status             int
+	}{
+		{http.MethodGet, "/project/", "", http.StatusUnauthorized},
+		{http.MethodGet, "/project/", "unknown", http.StatusUnauthorized},
+		{http.MethodGet, "/project/", "ci-secret", http.StatusOK},
+		{http.MethodPost, "/project/new", "ci-secret", http.StatusForbidden},
+		{http.MethodPost, "/project/new", "ops-secret", http.StatusOK},
+		{http.MethodGet, "/project/retention/1", "ci-secret", http.StatusOK},
+		{http.MethodPost, "/project/retention/3", "ci-secret", http.StatusForbidden},
+		{http.MethodPost, "/project/retention/3", "ops-secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.url, nil)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		as.Equal(c.status, rec.Code, "%s %s %s", c.method, c.url, c.token)
+	}
+}
+
+func TestParseRoles(t *testing.T) {
+	as := assert.New(t)
+	roles, err := parseRoles(map[string]string{"*": "reader", "2": "admin"})
+	as.Nil(err)
+	grant := &Grant{Roles: roles}
+	as.Equal(RoleReader, grant.Role(1))
+	as.Equal(RoleAdmin, grant.Role(2))
+
+	_, err = parseRoles(map[string]string{"x": "reader"})
+	as.NotNil(err)
+	_, err = parseRoles(map[string]string{"*": "owner"})
+	as.NotNil(err)
+}
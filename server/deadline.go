@@ -0,0 +1,51 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type connKey struct{}
+
+// ConnContext keeps the connection in the request context, it is the ConnContext of the http server so the
+// write deadline is set per request by WriteDeadlineMiddleware instead of the WriteTimeout of the server.
+func (server *Server) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// WriteDeadlineMiddleware bounds the writing of every response by the timeout, the streams lift it by
+// clearWriteDeadline.
+func WriteDeadlineMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+				c.SetWriteDeadline(time.Now().Add(timeout))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clearWriteDeadline lifts the write deadline of the request, so the stream lasts until the client leaves.
+func clearWriteDeadline(r *http.Request) {
+	if c, ok := r.Context().Value(connKey{}).(net.Conn); ok {
+		c.SetWriteDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDeadline(t *testing.T) {
+	as := assert.New(t)
+	slow := func(stream bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if stream {
+				clearWriteDeadline(r)
+			}
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("ok"))
+		}
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/slow", slow(false))
+	router.HandleFunc("/stream", slow(true))
+	router.Use(WriteDeadlineMiddleware(50 * time.Millisecond))
+	ts := httptest.NewUnstartedServer(router)
+	ts.Config.ConnContext = (&Server{}).ConnContext
+	ts.Start()
+	defer ts.Close()
+
+	// the write after the deadline fails, so the client gets no response.
+	_, err := http.Get(ts.URL + "/slow")
+	as.Error(err)
+	rsp, err := http.Get(ts.URL + "/stream")
+	as.NoError(err)
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	as.NoError(err)
+	as.Equal("ok", string(body))
+}
@@ -0,0 +1,360 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
+)
+
+var exportContentTypes = map[string]string{
+	"csv":  "text/csv; charset=utf-8",
+	"md":   "text/markdown; charset=utf-8",
+	"html": "text/html; charset=utf-8",
+}
+
+// BenchTable is the pivot of the bench, workloads as rows and metric keys as columns.
+type BenchTable struct {
+	SessionID uint
+	Bench     string
+	Baseline  string
+	Keys      []string
+	Rows      []BenchRow
+}
+
+// BenchRow is one workload run, Deltas are versus the latest baseline run of the same workload name.
+type BenchRow struct {
+	WID      uint
+	Workload string
+	Start    time.Time
+	Values   map[string]float64
+	Deltas   map[string]core.MetricDelta
+}
+
+// newBenchTable pivots the bench, the baseline may be empty.
+func newBenchTable(sessionID uint, bench string, loads []api.WorkloadMetrics, baselineName string, baseline []api.WorkloadMetrics) BenchTable {
+	table := BenchTable{SessionID: sessionID, Bench: bench, Baseline: baselineName}
+	latest := make(map[string]api.WorkloadMetrics, len(baseline))
+	for _, b := range baseline {
+		if b.ID > latest[b.Name].ID {
+			latest[b.Name] = b
+		}
+	}
+	keys := make(map[string]bool)
+	for _, l := range loads {
+		row := BenchRow{WID: l.ID, Workload: l.Name, Start: l.Start, Values: l.MetricsMap()}
+		for k := range row.Values {
+			keys[k] = true
+		}
+		if b, ok := latest[l.Name]; ok {
+			row.Deltas = make(map[string]core.MetricDelta)
+			for _, d := range core.DiffMetrics(b.MetricsMap(), row.Values) {
+				row.Deltas[d.Key] = d
+			}
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	for k := range keys {
+		table.Keys = append(table.Keys, k)
+	}
+	sort.Strings(table.Keys)
+	sort.SliceStable(table.Rows, func(i, j int) bool {
+		if table.Rows[i].Workload != table.Rows[j].Workload {
+			return table.Rows[i].Workload < table.Rows[j].Workload
+		}
+		return table.Rows[i].WID < table.Rows[j].WID
+	})
+	return table
+}
+
+// Write renders the table in csv, md or html.
+func (t BenchTable) Write(w io.Writer, format string) error {
+	switch format {
+	case "csv":
+		return t.WriteCSV(w)
+	case "md":
+		return t.WriteMarkdown(w)
+	case "html":
+		return t.WriteHTML(w)
+	default:
+		return errs.InvalidArgument("format %s must be csv, md or html", format)
+	}
+}
+
+// WriteCSV writes the raw values, the ratio versus baseline follows every key as `<key>_delta` if there is a baseline.
+func (t BenchTable) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"wid", "workload"}
+	for _, k := range t.Keys {
+		header = append(header, k)
+		if t.Baseline != "" {
+			header = append(header, k+"_delta")
+		}
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		record := []string{strconv.FormatUint(uint64(row.WID), 10), row.Workload}
+		for _, k := range t.Keys {
+			v, ok := row.Values[k]
+			record = append(record, formatCell(v, ok, strconv.FormatFloat(v, 'f', -1, 64)))
+			if t.Baseline != "" {
+				d, ok := row.Deltas[k]
+				record = append(record, formatCell(d.Ratio, ok, strconv.FormatFloat(d.Ratio, 'f', 6, 64)))
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteMarkdown writes the table for the pull requests and reports.
+func (t BenchTable) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "### %s\n\n", t.title())
+	b.WriteString("| workload |")
+	for _, k := range t.Keys {
+		fmt.Fprintf(&b, " %s |", escapeMarkdown(k))
+	}
+	b.WriteString("\n| --- |")
+	for range t.Keys {
+		b.WriteString(" ---: |")
+	}
+	b.WriteString("\n")
+	for _, row := range t.Rows {
+		fmt.Fprintf(&b, "| %s (%d) |", escapeMarkdown(row.Workload), row.WID)
+		for _, k := range t.Keys {
+			fmt.Fprintf(&b, " %s |", row.Cell(k))
+		}
+		b.WriteString("\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (t BenchTable) title() string {
+	title := fmt.Sprintf("bench %s of session %d", t.Bench, t.SessionID)
+	if t.Baseline != "" {
+		title += " versus " + t.Baseline
+	}
+	return title
+}
+
+// Cell formats the value with the ratio versus baseline, empty if the workload has no such key or the value is NaN.
+func (r BenchRow) Cell(key string) string {
+	v, ok := r.Values[key]
+	s := formatCell(v, ok, strconv.FormatFloat(v, 'f', 4, 64))
+	if s == "" {
+		return ""
+	}
+	if d, ok := r.Deltas[key]; ok && !math.IsNaN(d.Ratio) {
+		s += fmt.Sprintf(" (%+.2f%%)", d.Ratio*100)
+	}
+	return s
+}
+
+// Trend returns up if the delta versus baseline is an improvement, down if it is a regression, otherwise empty.
+func (r BenchRow) Trend(key string) string {
+	d, ok := r.Deltas[key]
+	if !ok || math.IsNaN(d.Ratio) || d.Ratio == 0 {
+		return ""
+	}
+	if (d.Ratio > 0) == core.HigherIsBetter(key) {
+		return "up"
+	}
+	return "down"
+}
+
+func formatCell(v float64, ok bool, s string) string {
+	if !ok || math.IsNaN(v) {
+		return ""
+	}
+	return s
+}
+
+func escapeMarkdown(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+const (
+	chartWidth     = 640
+	chartLabel     = 200
+	chartBarHeight = 18
+	chartMargin    = 4
+)
+
+type chartBar struct {
+	Label    string
+	Y        int
+	Width    float64
+	Value    string
+	Baseline bool
+}
+
+type chart struct {
+	Key    string
+	Height int
+	Bars   []chartBar
+}
+
+// charts returns one horizontal bar chart per metric key, the baseline value is drawn below the workload and
+// the NaN values are skipped.
+func (t BenchTable) charts() []chart {
+	charts := make([]chart, 0, len(t.Keys))
+	for _, k := range t.Keys {
+		c := chart{Key: k}
+		max := 0.0
+		for _, row := range t.Rows {
+			if v, ok := row.Values[k]; ok && !math.IsNaN(v) {
+				max = math.Max(max, math.Abs(v))
+			}
+			if d, ok := row.Deltas[k]; ok && !math.IsNaN(d.Old) {
+				max = math.Max(max, math.Abs(d.Old))
+			}
+		}
+		add := func(label string, v float64, baseline bool) {
+			width := 0.0
+			if max > 0 {
+				width = math.Abs(v) / max * (chartWidth - chartLabel - 80)
+			}
+			y := len(c.Bars) * (chartBarHeight + chartMargin)
+			c.Bars = append(c.Bars, chartBar{Label: label, Y: y, Width: width, Value: strconv.FormatFloat(v, 'g', 6, 64), Baseline: baseline})
+		}
+		for _, row := range t.Rows {
+			v, ok := row.Values[k]
+			if !ok || math.IsNaN(v) {
+				continue
+			}
+			add(fmt.Sprintf("%s (%d)", row.Workload, row.WID), v, false)
+			if d, ok := row.Deltas[k]; ok && !math.IsNaN(d.Old) {
+				add(t.Baseline, d.Old, true)
+			}
+		}
+		c.Height = len(c.Bars) * (chartBarHeight + chartMargin)
+		charts = append(charts, c)
+	}
+	return charts
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.num { text-align: right; font-family: monospace; }
+.up { color: #2a7d2a; } .down { color: #c0392b; }
+svg text { font-size: 12px; dominant-baseline: middle; }
+</style>
+</head>
+<body>
+<h2>{{.Title}}</h2>
+<table>
+<tr><th>workload</th>{{range .Table.Keys}}<th>{{.}}</th>{{end}}</tr>
+{{range $row := .Table.Rows}}<tr><td>{{$row.Workload}} ({{$row.WID}})</td>{{range $.Table.Keys}}<td class="num{{with $row.Trend .}} {{.}}{{end}}">{{$row.Cell .}}</td>{{end}}</tr>
+{{end}}</table>
+{{range .Charts}}<h3>{{.Key}}</h3>
+<svg xmlns="http://www.w3.org/2000/svg" width="{{$.Width}}" height="{{.Height}}">
+{{range .Bars}}<text x="0" y="{{.Y}}" dy="9">{{.Label}}</text>
+<rect x="{{$.Label}}" y="{{.Y}}" width="{{printf "%.1f" .Width}}" height="{{$.Bar}}" fill="{{if .Baseline}}#bbb{{else}}#4a7ebb{{end}}"></rect>
+<text x="{{$.Label}}" y="{{.Y}}" dx="{{printf "%.1f" .Width}}" dy="9">&nbsp;{{.Value}}</text>
+{{end}}</svg>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes the self-contained report with the table and inline svg charts.
+func (t BenchTable) WriteHTML(w io.Writer) error {
+	return reportTemplate.Execute(w, map[string]interface{}{
+		"Title":  t.title(),
+		"Table":  t,
+		"Charts": t.charts(),
+		"Width":  chartWidth,
+		"Label":  chartLabel,
+		"Bar":    chartBarHeight,
+	})
+}
+
+func (analyze *PromAnalyze) ExportBench(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		writeError(w, errs.InvalidArgument("query parameter format must be csv, md or html"))
+		return
+	}
+	selectors, err := repository.ParseLabelSelectors(query["label"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	loads, err := analyze.benchMetrics(sid, name, selectors)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(loads) == 0 {
+		writeError(w, errs.NotFound("bench %s not found in session %d", name, sid))
+		return
+	}
+	baselineName := query.Get("baseline")
+	var baseline []api.WorkloadMetrics
+	if baselineName != "" {
+		if baseline, err = analyze.benchMetrics(sid, baselineName, nil); err != nil {
+			writeError(w, err)
+			return
+		}
+		if len(baseline) == 0 {
+			writeError(w, errs.NotFound("baseline bench %s not found in session %d", baselineName, sid))
+			return
+		}
+	}
+	table := newBenchTable(sid, name, loads, baselineName, baseline)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", fmt.Sprintf("%s.%s", name, format)))
+	if err := table.Write(w, format); err != nil {
+		log.Printf("export bench %s of session %d failed, err:%v", name, sid, err)
+	}
+}
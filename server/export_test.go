@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func benchLoad(id uint, name string, metrics map[string]float64) api.WorkloadMetrics {
+	load := api.WorkloadMetrics{Workload: repository.Workload{ID: id, Name: name}}
+	for k, v := range metrics {
+		load.Metrics = append(load.Metrics, repository.Metrics{WID: id, Key: k, Value: v})
+	}
+	return load
+}
+
+func TestBenchTable(t *testing.T) {
+	as := assert.New(t)
+	loads := []api.WorkloadMetrics{
+		benchLoad(5, "write", map[string]float64{"qps": 110, "p99": 12}),
+		benchLoad(4, "read", map[string]float64{"qps": 200}),
+	}
+	baseline := []api.WorkloadMetrics{
+		benchLoad(1, "write", map[string]float64{"qps": 90, "p99": 10}),
+		benchLoad(2, "write", map[string]float64{"qps": 100, "p99": 10}),
+	}
+	table := newBenchTable(1, "b2", loads, "b1", baseline)
+	as.Equal([]string{"p99", "qps"}, table.Keys)
+	as.Equal("read", table.Rows[0].Workload)
+	as.Empty(table.Rows[0].Deltas)
+	as.InDelta(0.1, table.Rows[1].Deltas["qps"].Ratio, 1e-9)
+
+	var csv bytes.Buffer
+	as.NoError(table.Write(&csv, "csv"))
+	as.Equal("wid,workload,p99,p99_delta,qps,qps_delta\n"+
+		"4,read,,,200,\n"+
+		"5,write,12,0.200000,110,0.100000\n", csv.String())
+
+	var md bytes.Buffer
+	as.NoError(table.Write(&md, "md"))
+	as.Contains(md.String(), "| workload | p99 | qps |\n| --- | ---: | ---: |\n")
+	as.Contains(md.String(), "| write (5) | 12.0000 (+20.00%) | 110.0000 (+10.00%) |\n")
+
+	var html bytes.Buffer
+	as.NoError(table.Write(&html, "html"))
+	as.Equal(2, strings.Count(html.String(), "<svg"))
+	as.Contains(html.String(), "<td class=\"num down\">110.0000 (&#43;10.00%)</td>")
+
+	as.Error(table.Write(&html, "pdf"))
+}
+
+func TestBenchTableTrend(t *testing.T) {
+	as := assert.New(t)
+	loads := []api.WorkloadMetrics{
+		benchLoad(3, "write", map[string]float64{"sysbench_qps": 110, "p99": 12, "p95": math.NaN()}),
+	}
+	baseline := []api.WorkloadMetrics{
+		benchLoad(1, "write", map[string]float64{"sysbench_qps": 100, "p99": 10, "p95": 8}),
+	}
+	table := newBenchTable(1, "b2", loads, "b1", baseline)
+	row := table.Rows[0]
+	as.Equal("up", row.Trend("sysbench_qps"))
+	as.Equal("down", row.Trend("p99"))
+	as.Equal("", row.Trend("p95"))
+	as.Equal("", row.Cell("p95"))
+
+	var csv bytes.Buffer
+	as.NoError(table.Write(&csv, "csv"))
+	as.Equal("wid,workload,p95,p95_delta,p99,p99_delta,sysbench_qps,sysbench_qps_delta\n"+
+		"3,write,,,12,0.200000,110,0.100000\n", csv.String())
+
+	var md bytes.Buffer
+	as.NoError(table.Write(&md, "md"))
+	as.Contains(md.String(), "| write (3) |  | 12.0000 (+20.00%) | 110.0000 (+10.00%) |\n")
+
+	var html bytes.Buffer
+	as.NoError(table.Write(&html, "html"))
+	as.Contains(html.String(), "<td class=\"num\"></td>")
+	as.Contains(html.String(), "<td class=\"num down\">12.0000 (&#43;20.00%)</td>")
+	as.Contains(html.String(), "<td class=\"num up\">110.0000 (&#43;10.00%)</td>")
+	as.NotContains(html.String(), "NaN")
+}
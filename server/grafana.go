@@ -0,0 +1,150 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	url2 "net/url"
+	"strings"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+// grafanaTimeout bounds every grafana api call, the annotations must not hold the saving of the records.
+const grafanaTimeout = 5 * time.Second
+
+// GrafanaAnnotation is the region annotation of the grafana http api, the times are in milliseconds.
+type GrafanaAnnotation struct {
+	Time    int64    `json:"time"`
+	TimeEnd int64    `json:"timeEnd"`
+	Tags    []string `json:"tags"`
+	Text    string   `json:"text"`
+}
+
+type Grafana struct {
+	client *http.Client
+}
+
+func NewGrafana() *Grafana {
+	return &Grafana{client: &http.Client{Timeout: grafanaTimeout}}
+}
+
+// Annotate pushes the annotation to the grafana of the session.
+func (g *Grafana) Annotate(session repository.Session, annotation GrafanaAnnotation) error {
+	target, err := proxyTarget(session.GrafanaAddress)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(annotation)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(target.String(), "/")+"/api/annotations", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session.GrafanaAuthorization != "" {
+		req.Header.Set("Authorization", session.GrafanaAuthorization)
+	}
+	rsp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(rsp.Body)
+		return fmt.Errorf("grafana response is not ok code:%d body:%s", rsp.StatusCode, body)
+	}
+	return nil
+}
+
+// AnnotateRecords pushes one region annotation per record tagged with the bench and workload name,
+// the failures are logged only so grafana never fails the saving.
+func (g *Grafana) AnnotateRecords(session repository.Session, benchName string, records []repository.Record) {
+	if session.GrafanaAddress == "" {
+		return
+	}
+	for _, r := range records {
+		start, err1 := parseUnix(r.Start)
+		end, err2 := parseUnix(r.End)
+		if err1 != nil || err2 != nil {
+			log.Printf("annotate workload %s failed, the window %s-%s is invalid", r.Workload, r.Start, r.End)
+			continue
+		}
+		annotation := GrafanaAnnotation{
+			Time:    toMillis(start),
+			TimeEnd: toMillis(end),
+			Tags:    []string{"pd-analyze", benchName, r.Workload},
+			Text:    fmt.Sprintf("bench %s workload %s", benchName, r.Workload),
+		}
+		if err := g.Annotate(session, annotation); err != nil {
+			log.Printf("annotate workload %s of session %d failed, err:%v", r.Workload, session.ID, err)
+		}
+	}
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// dashboardLinks returns the links of the dashboards of the session with the time range of the workload.
+func dashboardLinks(session repository.Session, load repository.Workload) []repository.DashboardLink {
+	if session.GrafanaAddress == "" || session.GrafanaDashboards == "" {
+		return nil
+	}
+	target, err := proxyTarget(session.GrafanaAddress)
+	if err != nil {
+		return nil
+	}
+	base := strings.TrimSuffix(target.String(), "/")
+	query := url2.Values{
+		"from": {fmt.Sprint(toMillis(load.Start))},
+		"to":   {fmt.Sprint(toMillis(load.End))},
+	}.Encode()
+	links := make([]repository.DashboardLink, 0)
+	for _, uid := range strings.Split(session.GrafanaDashboards, ",") {
+		if uid = strings.TrimSpace(uid); uid == "" {
+			continue
+		}
+		links = append(links, repository.DashboardLink{
+			Dashboard: uid,
+			URL:       fmt.Sprintf("%s/d/%s?%s", base, url2.PathEscape(uid), query),
+		})
+	}
+	return links
+}
+
+// withLinks fills the dashboard links of the workloads, the sessions are loaded once.
+func (server *Server) withLinks(loads []repository.Workload) error {
+	sessions := make(map[uint]repository.Session)
+	for i := range loads {
+		session, ok := sessions[loads[i].SessionID]
+		if !ok {
+			var err error
+			if session, err = server.projectStorage.GetSession(loads[i].SessionID); err != nil {
+				return err
+			}
+			sessions[loads[i].SessionID] = session
+		}
+		loads[i].Links = dashboardLinks(session, loads[i])
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotateRecords(t *testing.T) {
+	as := assert.New(t)
+	var mu sync.Mutex
+	var annotations []GrafanaAnnotation
+	grafana := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal(http.MethodPost, r.Method)
+		as.Equal("/grafana/api/annotations", r.URL.Path)
+		as.Equal("Bearer grafana", r.Header.Get("Authorization"))
+		var a GrafanaAnnotation
+		as.Nil(json.NewDecoder(r.Body).Decode(&a))
+		if a.Tags[2] == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		annotations = append(annotations, a)
+		mu.Unlock()
+		w.Write([]byte(`{"id":1,"message":"Annotation added"}`))
+	}))
+	defer grafana.Close()
+
+	session := repository.Session{ID: 1, GrafanaAddress: grafana.URL + "/grafana/", GrafanaAuthorization: "Bearer grafana"}
+	records := []repository.Record{
+		{Workload: "read", Start: "1634479813", End: "1634479873"},
+		{Workload: "fail", Start: "1634479873", End: "1634479933"},
+		{Workload: "bad", Start: "x", End: "1634479933"},
+		{Workload: "write", Start: "1634479933", End: "1634479993"},
+	}
+	NewGrafana().AnnotateRecords(session, "hot-read", records)
+	as.Len(annotations, 2)
+	as.Equal(GrafanaAnnotation{
+		Time:    1634479813000,
+		TimeEnd: 1634479873000,
+		Tags:    []string{"pd-analyze", "hot-read", "read"},
+		Text:    "bench hot-read workload read",
+	}, annotations[0])
+	as.Equal("write", annotations[1].Tags[2])
+
+	// no grafana no request.
+	NewGrafana().AnnotateRecords(repository.Session{}, "hot-read", records)
+	as.Len(annotations, 2)
+}
+
+func TestDashboardLinks(t *testing.T) {
+	as := assert.New(t)
+	load := repository.Workload{Start: time.Unix(1634479813, 0), End: time.Unix(1634479873, 0)}
+	session := repository.Session{GrafanaAddress: "grafana:3000/", GrafanaDashboards: "pd-overview, tikv details,"}
+	as.Equal([]repository.DashboardLink{
+		{Dashboard: "pd-overview", URL: "http://grafana:3000/d/pd-overview?from=1634479813000&to=1634479873000"},
+		{Dashboard: "tikv details", URL: "http://grafana:3000/d/tikv%20details?from=1634479813000&to=1634479873000"},
+	}, dashboardLinks(session, load))
+	as.Nil(dashboardLinks(repository.Session{GrafanaDashboards: "pd"}, load))
+}
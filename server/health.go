@@ -0,0 +1,105 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/version"
+)
+
+// readyTimeout bounds every dependency check of the readiness probe.
+const readyTimeout = 3 * time.Second
+
+// ReadyStatus is the result of the readiness probe keyed by dependency, the value is ok or the error.
+type ReadyStatus struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Drain marks the server as not ready, so the load balancer stops sending requests before the shutdown.
+func (server *Server) Drain() {
+	atomic.StoreInt32(&server.draining, 1)
+}
+
+// Shutdown drains the server, the readiness probe fails for the drain delay so the load balancer stops routing to it,
+// then the listener closes and the in-flight requests finish within the shutdown timeout.
+func (server *Server) Shutdown(srv *http.Server) error {
+	server.Drain()
+	time.Sleep(server.config.DrainDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), server.config.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
+
+func (server *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeOK(w)
+}
+
+func (server *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+	status := ReadyStatus{Ready: true, Checks: make(map[string]string)}
+	check := func(name string, err error) {
+		if err != nil {
+			status.Ready = false
+			status.Checks[name] = err.Error()
+			return
+		}
+		status.Checks[name] = "ok"
+	}
+	if atomic.LoadInt32(&server.draining) == 1 {
+		check("server", fmt.Errorf("server is draining"))
+	}
+	check("storage", server.pingStorage(ctx))
+	check("prometheus", server.pingPrometheus(ctx))
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, status)
+}
+
+func (server *Server) Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, version.GetInfo())
+}
+
+func (server *Server) pingStorage(ctx context.Context) error {
+	db, err := server.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
+func (server *Server) pingPrometheus(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server.config.PrometheusAddress, "/")+"/-/ready", nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("prometheus is not ready code:%d", rsp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestPingPrometheus(t *testing.T) {
+	as := assert.New(t)
+	ready := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal("/-/ready", r.URL.Path)
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	server := &Server{config: &config.Config{PrometheusAddress: ts.URL + "/"}}
+	as.Nil(server.pingPrometheus(context.Background()))
+	ready = false
+	as.NotNil(server.pingPrometheus(context.Background()))
+	ts.Close()
+	as.NotNil(server.pingPrometheus(context.Background()))
+}
+
+func TestShutdownDrain(t *testing.T) {
+	as := assert.New(t)
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer prometheus.Close()
+	conn, _, err := sqlmock.New()
+	as.NoError(err)
+	defer conn.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+	as.NoError(err)
+
+	server := &Server{db: db, config: &config.Config{
+		PrometheusAddress: prometheus.URL,
+		DrainDelay:        300 * time.Millisecond,
+		ShutdownTimeout:   time.Second,
+	}}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	as.NoError(err)
+	srv := &http.Server{Handler: http.HandlerFunc(server.Readyz)}
+	go srv.Serve(listener)
+	url := "http://" + listener.Addr().String() + "/readyz"
+	readyz := func() int {
+		rsp, err := http.Get(url)
+		if err != nil {
+			return 0
+		}
+		rsp.Body.Close()
+		return rsp.StatusCode
+	}
+	as.Equal(http.StatusOK, readyz())
+
+	done := make(chan error, 1)
+	go func() { done <- server.Shutdown(srv) }()
+	// the listener stays open for the drain delay, so the probe sees 503 before the connection is refused
+	as.Eventually(func() bool { return readyz() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond)
+	as.NoError(<-done)
+	as.Equal(0, readyz())
+}
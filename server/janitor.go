@@ -0,0 +1,171 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RunNotifier delivers the webhook events until the context is done.
+func (server *Server) RunNotifier(ctx context.Context) {
+	server.notifier.Run(ctx)
+}
+
+// RunJanitor enforces the retention of every project once at startup and then every interval until the context is done.
+func (server *Server) RunJanitor(ctx context.Context) {
+	if server.config.RetentionInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(server.config.RetentionInterval)
+	defer ticker.Stop()
+	for {
+		if err := server.enforceRetentions(time.Now()); err != nil {
+			log.Printf("enforce retention failed, err:%v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceRetentions enforces the retention of every project, a failed project is logged and skipped.
+func (server *Server) enforceRetentions(now time.Time) error {
+	retentions, err := server.projectStorage.GetRetentions()
+	if err != nil {
+		return err
+	}
+	depth := retentionQueueDepth()
+	defer depth.Set(0)
+	for i, r := range retentions {
+		depth.Set(float64(len(retentions) - i))
+		if err := server.enforceRetention(r, now); err != nil {
+			log.Printf("enforce retention of project %d failed, err:%v", r.PID, err)
+			server.notifyJobFailed(r.PID, 0, "", fmt.Errorf("enforce retention failed: %v", err))
+		}
+	}
+	return nil
+}
+
+func retentionQueueDepth() prometheus.Gauge {
+	return JobQueueDepth.WithLabelValues("retention")
+}
+
+func (server *Server) enforceRetention(retention repository.Retention, now time.Time) error {
+	sessions, err := server.projectStorage.GetSessions(retention.PID)
+	if err != nil {
+		return err
+	}
+	for _, s := range sessions {
+		loads, err := server.workloadStorage.GetWorkloadsBySessionID(s.ID)
+		if err != nil {
+			return err
+		}
+		expired := expiredWorkloads(loads, retention, now)
+		if len(expired) == 0 {
+			continue
+		}
+		if retention.Archive {
+			if err := server.archive(s, expired, now); err != nil {
+				return err
+			}
+		}
+		for _, l := range expired {
+			if err := server.workloadStorage.DeleteWorkload(l.ID); err != nil {
+				return err
+			}
+		}
+		log.Printf("retention expired %d workloads, project:%d session:%d", len(expired), retention.PID, s.ID)
+	}
+	return nil
+}
+
+// archive exports the workloads with their metrics and labels to a gzip'd jsonl file.
+func (server *Server) archive(session repository.Session, loads []repository.Workload, now time.Time) error {
+	if err := os.MkdirAll(server.config.ArchiveDirectory, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("project-%d-session-%d-%d.jsonl.gz", session.PID, session.ID, now.Unix())
+	file, err := os.Create(filepath.Join(server.config.ArchiveDirectory, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, l := range loads {
+		metrics, err := server.workloadStorage.GetMetricsByLoads(l.ID)
+		if err != nil {
+			return err
+		}
+		labels, err := server.workloadStorage.GetLabels(l.ID)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(api.WorkloadMetrics{Workload: l, Metrics: metrics, Labels: labels}); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// expiredWorkloads returns the workloads that no retention rule keeps, baselines are always kept.
+func expiredWorkloads(loads []repository.Workload, retention repository.Retention, now time.Time) []repository.Workload {
+	if retention.KeepRuns <= 0 && retention.KeepDays <= 0 {
+		return nil
+	}
+	byName := make(map[string][]repository.Workload)
+	for _, l := range loads {
+		byName[l.Name] = append(byName[l.Name], l)
+	}
+	deadline := now.AddDate(0, 0, -retention.KeepDays)
+	expired := make([]repository.Workload, 0)
+	for _, ls := range byName {
+		sort.Slice(ls, func(i, j int) bool {
+			return ls[i].Start.After(ls[j].Start)
+		})
+		for i, l := range ls {
+			if l.Baseline {
+				continue
+			}
+			if retention.KeepRuns > 0 && i < retention.KeepRuns {
+				continue
+			}
+			if retention.KeepDays > 0 && l.Start.After(deadline) {
+				continue
+			}
+			expired = append(expired, l)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].ID < expired[j].ID
+	})
+	return expired
+}
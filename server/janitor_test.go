@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiredWorkloads(t *testing.T) {
+	as := assert.New(t)
+	now := time.Unix(1634479813, 0)
+	day := 24 * time.Hour
+	loads := []repository.Workload{
+		{ID: 1, Name: "read", Start: now.Add(-10 * day), Baseline: true},
+		{ID: 2, Name: "read", Start: now.Add(-9 * day)},
+		{ID: 3, Name: "read", Start: now.Add(-5 * day)},
+		{ID: 4, Name: "read", Start: now.Add(-1 * day)},
+		{ID: 5, Name: "write", Start: now.Add(-8 * day)},
+	}
+	ids := func(loads []repository.Workload) []uint {
+		result := make([]uint, 0, len(loads))
+		for _, l := range loads {
+			result = append(result, l.ID)
+		}
+		return result
+	}
+
+	as.Empty(expiredWorkloads(loads, repository.Retention{}, now))
+	as.Equal([]uint{2, 3}, ids(expiredWorkloads(loads, repository.Retention{KeepRuns: 1}, now)))
+	as.Equal([]uint{2, 5}, ids(expiredWorkloads(loads, repository.Retention{KeepDays: 7}, now)))
+	as.Equal([]uint{2}, ids(expiredWorkloads(loads, repository.Retention{KeepRuns: 1, KeepDays: 7}, now)))
+}
+
+func (s *stubProjectStorage) GetRetentions() ([]repository.Retention, error) {
+	return s.retentions, nil
+}
+
+func (s *stubProjectStorage) GetSessions(projectID uint) ([]repository.Session, error) {
+	if _, ok := s.projects[projectID]; !ok {
+		return nil, errs.NotFound("project %d not found", projectID)
+	}
+	result := make([]repository.Session, 0)
+	for _, session := range s.sessions {
+		if session.PID == projectID {
+			result = append(result, session)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubWorkloadStorage) GetWorkloadsBySessionID(sessionID uint) ([]repository.Workload, error) {
+	result := make([]repository.Workload, 0)
+	for _, l := range s.loads {
+		if l.SessionID == sessionID {
+			result = append(result, l)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubWorkloadStorage) DeleteWorkload(wID uint) error {
+	s.deleted = append(s.deleted, wID)
+	return nil
+}
+
+func TestRunJanitor(t *testing.T) {
+	as := assert.New(t)
+	now := time.Now()
+	workloads := &stubWorkloadStorage{loads: []repository.Workload{
+		{ID: 1, SessionID: 1, Name: "read", Start: now.Add(-2 * time.Hour)},
+		{ID: 2, SessionID: 1, Name: "read", Start: now.Add(-time.Hour)},
+	}}
+	server := &Server{
+		config: &config.Config{RetentionInterval: time.Hour},
+		projectStorage: &stubProjectStorage{
+			// the project 1 is missing, its failure must not skip the project 2.
+			projects:   map[uint]repository.Project{2: {ID: 2}},
+			sessions:   map[uint]repository.Session{1: {ID: 1, PID: 2}},
+			retentions: []repository.Retention{{PID: 1, KeepRuns: 1}, {PID: 2, KeepRuns: 1}},
+		},
+		workloadStorage: workloads,
+		notifier:        NewNotifier(&stubWebhookStorage{}, 0),
+	}
+
+	// the first enforcement runs at startup without waiting for the interval.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	server.RunJanitor(ctx)
+	as.Equal([]uint{1}, workloads.deleted)
+}
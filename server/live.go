@@ -0,0 +1,136 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/errs"
+)
+
+const (
+	defaultLiveInterval = 15 * time.Second
+	minLiveInterval     = 5 * time.Second
+	// livePoints bounds the samples of every series, the window grows from the connection.
+	livePoints = 120
+)
+
+// LiveMetrics is one event of the live stream, the metrics are summarized like the stored records.
+type LiveMetrics struct {
+	SessionID uint               `json:"session_id"`
+	Start     time.Time          `json:"start"`
+	Time      time.Time          `json:"time"`
+	Metrics   map[string]float64 `json:"metrics"`
+}
+
+func (analyze *PromAnalyze) Live(w http.ResponseWriter, r *http.Request) {
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	interval := defaultLiveInterval
+	if v := query.Get("interval"); v != "" {
+		if interval, err = time.ParseDuration(v); err != nil || interval < minLiveInterval {
+			writeError(w, errs.InvalidArgument("query parameter interval must be a duration not less than %s", minLiveInterval))
+			return
+		}
+	}
+	catalog := core.Catalog
+	if names := query["metrics"]; len(names) > 0 {
+		catalog = make(map[string]string, len(names))
+		for _, name := range names {
+			metrics, ok := core.Catalog[name]
+			if !ok {
+				writeError(w, errs.InvalidArgument("metrics %s is not in the catalog", name))
+				return
+			}
+			catalog[name] = metrics
+		}
+	}
+	session, err := analyze.server.projectStorage.GetSession(sid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if session.ID == 0 {
+		writeError(w, errs.NotFound("session %d not found", sid))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	address := session.PromAddress
+	if address == "" {
+		address = analyze.server.config.PrometheusAddress
+	}
+	source := core.NewPrometheus(address)
+	source.SetHook(observePrometheusQuery)
+	// the window starts at the connection, so the whole window is queried instead of its last minutes
+	checker := core.NewChecker(core.RangeSource{Prometheus: source, Points: livePoints})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	clearWriteDeadline(r)
+	w.WriteHeader(http.StatusOK)
+	// the client reconnects after the retry if the stream breaks.
+	fmt.Fprintf(w, "retry: %d\n\n", interval/time.Millisecond)
+	flusher.Flush()
+
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		event, data := "metrics", interface{}(nil)
+		metrics, err := core.Summarize(checker, catalog, strconv.FormatInt(start.Unix(), 10), strconv.FormatInt(now.Unix(), 10))
+		if err != nil {
+			event, data = "error", api.ErrorBody{Code: errs.Convert(err).Code, Message: err.Error()}
+		} else {
+			data = LiveMetrics{SessionID: sid, Start: start, Time: now, Metrics: metrics}
+		}
+		if err := writeEvent(w, event, data); err != nil {
+			log.Printf("live stream of session %d closed, err:%v", sid, err)
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeEvent writes one server-sent event with the json data.
+func writeEvent(w http.ResponseWriter, event string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, body)
+	return err
+}
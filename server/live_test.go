@@ -0,0 +1,83 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLive(t *testing.T) {
+	as := assert.New(t)
+	var lock sync.Mutex
+	starts := make(map[string]bool)
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Equal("/api/v1/query_range", r.URL.Path)
+		lock.Lock()
+		starts[r.FormValue("start")] = true
+		lock.Unlock()
+		if strings.Contains(r.FormValue("query"), "pd_scheduler_store_status") {
+			// no series
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[` +
+			`{"metric":{"instance":"a"},"values":[[1,"1"],[2,"3"]]},{"metric":{"instance":"b"},"values":[[1,"4"]]}]}}`))
+	}))
+	defer prom.Close()
+
+	server := &Server{
+		config:         &config.Config{},
+		projectStorage: &stubProjectStorage{sessions: map[uint]repository.Session{1: {ID: 1, PromAddress: prom.URL}}},
+	}
+	ts := httptest.NewServer(server.CreateRoute())
+	defer ts.Close()
+
+	rsp, err := http.Get(ts.URL + "/analyze/live/1?interval=1s")
+	as.NoError(err)
+	as.Equal(http.StatusBadRequest, rsp.StatusCode)
+	rsp.Body.Close()
+	rsp, err = http.Get(ts.URL + "/analyze/live/1?metrics=unknown")
+	as.NoError(err)
+	as.Equal(http.StatusBadRequest, rsp.StatusCode)
+	rsp.Body.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/analyze/live/1?metrics=tikv_cpu&metrics=tidb_duration_P99&metrics=store_write_query", nil)
+	rsp, err = http.DefaultClient.Do(req)
+	as.NoError(err)
+	defer rsp.Body.Close()
+	as.Equal(http.StatusOK, rsp.StatusCode)
+	as.Equal("text/event-stream", rsp.Header.Get("Content-Type"))
+
+	scanner := bufio.NewScanner(rsp.Body)
+	as.True(scanner.Scan())
+	as.Equal("retry: 15000", scanner.Text())
+	as.True(scanner.Scan())
+	as.True(scanner.Scan())
+	as.Equal("event: metrics", scanner.Text())
+	as.True(scanner.Scan())
+	var event LiveMetrics
+	as.NoError(json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data: ")), &event))
+	as.Equal(uint(1), event.SessionID)
+	as.Equal(3.0, event.Metrics["tikv_cpu_avg"])
+	as.InDelta(1.4142, event.Metrics["tikv_cpu_std"], 1e-4)
+	as.Equal(3.0, event.Metrics["tidb_duration_P99"])
+	// the metric without series is left out instead of breaking the json
+	as.Len(event.Metrics, 4)
+	as.NotContains(event.Metrics, "store_write_query_avg")
+	// the window starts at the connection
+	lock.Lock()
+	defer lock.Unlock()
+	as.Equal(map[string]bool{strconv.FormatInt(event.Start.Unix(), 10): true}, starts)
+}
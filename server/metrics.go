@@ -0,0 +1,171 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+const namespace = "analyze"
+
+var (
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Bucketed histogram of the request duration by route.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"route", "method", "code"})
+
+	promQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "prometheus",
+		Name:      "query_duration_seconds",
+		Help:      "Bucketed histogram of the prometheus query duration.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"result"})
+
+	promQueryErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "prometheus",
+		Name:      "query_errors_total",
+		Help:      "Counter of the failed prometheus queries.",
+	})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Bucketed histogram of the db statement duration by operation and table.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"operation", "table"})
+
+	// JobQueueDepth is the number of the pending jobs of the background queues.
+	JobQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "job",
+		Name:      "queue_depth",
+		Help:      "Number of the pending jobs by queue.",
+	}, []string{"queue"})
+)
+
+// registry holds the metrics of the analyzer itself, it is separated from the default registry of the libraries.
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		requestDuration,
+		promQueryDuration,
+		promQueryErrors,
+		dbDuration,
+		JobQueueDepth,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// statusWriter records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps the streaming responses working through the middleware.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// MetricsMiddleware observes the duration of every request by its route template, so the label cardinality is bounded.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(sw.code)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observePrometheusQuery is the core.QueryHook of the prometheus source.
+func observePrometheusQuery(_ string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+		promQueryErrors.Inc()
+	}
+	promQueryDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
+
+const dbStartKey = "analyze:start"
+
+// instrumentDB observes the duration of every statement with the gorm callbacks.
+func instrumentDB(db *gorm.DB) {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(dbStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(dbStartKey)
+			if !ok {
+				return
+			}
+			dbDuration.WithLabelValues(operation, tx.Statement.Table).Observe(time.Since(v.(time.Time)).Seconds())
+		}
+	}
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("analyze:before_create", before)
+	callback.Create().After("gorm:create").Register("analyze:after_create", after("create"))
+	callback.Query().Before("gorm:query").Register("analyze:before_query", before)
+	callback.Query().After("gorm:query").Register("analyze:after_query", after("query"))
+	callback.Update().Before("gorm:update").Register("analyze:before_update", before)
+	callback.Update().After("gorm:update").Register("analyze:after_update", after("update"))
+	callback.Delete().Before("gorm:delete").Register("analyze:before_delete", before)
+	callback.Delete().After("gorm:delete").Register("analyze:after_delete", after("delete"))
+	callback.Row().Before("gorm:row").Register("analyze:before_row", before)
+	callback.Row().After("gorm:row").Register("analyze:after_row", after("row"))
+	callback.Raw().Before("gorm:raw").Register("analyze:before_raw", before)
+	callback.Raw().After("gorm:raw").Register("analyze:after_raw", after("raw"))
+}
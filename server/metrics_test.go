@@ -0,0 +1,41 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	as := assert.New(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/analyze/series/{workload_id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.Handle("/metrics", metricsHandler())
+	router.Use(MetricsMiddleware)
+
+	for _, id := range []string{"1", "2"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/analyze/series/"+id, nil))
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	as.Equal(http.StatusOK, rec.Code)
+	// the route template is the label, so the two requests share one series.
+	as.True(strings.Contains(rec.Body.String(), `analyze_http_request_duration_seconds_count{code="404",method="GET",route="/analyze/series/{workload_id}"} 2`))
+}
+
+func TestObservePrometheusQuery(t *testing.T) {
+	as := assert.New(t)
+	before := testutil.ToFloat64(promQueryErrors)
+	observePrometheusQuery("up", time.Millisecond, nil)
+	observePrometheusQuery("up", time.Millisecond, errors.New("timeout"))
+	as.Equal(before+1, testutil.ToFloat64(promQueryErrors))
+}
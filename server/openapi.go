@@ -0,0 +1,355 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/bufferflies/pd-analyze/version"
+	"github.com/gorilla/mux"
+)
+
+// param is the query parameter of the route, Type is the openapi type of one value.
+type param struct {
+	Name        string
+	Type        string
+	Array       bool
+	Required    bool
+	Description string
+}
+
+// routeDoc documents the route, nil Response means the route answers plain `ok`.
+type routeDoc struct {
+	Tag         string
+	Summary     string
+	Query       []param
+	Body        interface{}
+	ContentType string
+	Response    interface{}
+}
+
+var labelParam = param{Name: "label", Type: "string", Array: true, Description: "label selector like key=value, key!=value or key=~regexp"}
+
+// apiDocs documents every route of CreateRoute keyed by method and path template, it is the only source of the
+// openapi document served at /openapi.json.
+var apiDocs = map[string]routeDoc{
+	"GET /project/": {Tag: "project", Summary: "list the projects", Response: []repository.Project{}},
+	"POST /project/new": {Tag: "project", Summary: "create the project from the json body, the name and description query parameters are still accepted", Query: []param{
+		{Name: "name", Type: "string"},
+		{Name: "description", Type: "string"},
+	}, Body: repository.Project{}, Response: repository.Project{}},
+	"GET /project/{project_id}":    {Tag: "project", Summary: "get the project", Response: repository.Project{}},
+	"PUT /project/{project_id}":    {Tag: "project", Summary: "update or rename the project, the fields absent in the body are kept", Body: repository.Project{}, Response: repository.Project{}},
+	"DELETE /project/{project_id}": {Tag: "project", Summary: "delete the project with its sessions, workloads, retention and webhooks"},
+	"POST /project/import": {Tag: "project", Summary: "import the project archive, conflict is skip, overwrite or rename", Query: []param{
+		{Name: "conflict", Type: "string", Description: "skip, overwrite or rename"},
+	}, Body: repository.ProjectArchive{}, Response: repository.Project{}},
+	"GET /project/{project_id}/export": {Tag: "project", Summary: "export the project as archive, format is json or gzip", Query: []param{
+		{Name: "format", Type: "string", Description: "json or gzip"},
+	}, Response: repository.ProjectArchive{}},
+	"POST /project/session/new": {Tag: "project", Summary: "create the session", Body: repository.Session{}, Response: repository.Session{}},
+	"POST /project/session/{session_id}": {Tag: "project", Summary: "update the session from the json body, the fields absent in the body are kept, the query parameters are used without json body", Query: []param{
+		{Name: "name", Type: "string"},
+		{Name: "target_object", Type: "string"},
+		{Name: "objects", Type: "string", Array: true},
+	}, Body: repository.Session{}, Response: repository.Session{}},
+	"PUT /project/session/{session_id}":                 {Tag: "project", Summary: "update the session, the fields absent in the body are kept", Body: repository.Session{}, Response: repository.Session{}},
+	"POST /project/session/{session_id}/clone":          {Tag: "project", Summary: "clone the addresses, objectives and dashboards of the session under a new name", Body: api.SessionClone{}, Response: repository.Session{}},
+	"GET /project/sessions/{project_id}":                {Tag: "project", Summary: "list the sessions of the project", Response: []repository.Session{}},
+	"GET /project/session/{session_id}":                 {Tag: "project", Summary: "get the session", Response: repository.Session{}},
+	"DELETE /project/session/{session_id}":              {Tag: "project", Summary: "delete the session with its workloads"},
+	"GET /project/retention/{project_id}":               {Tag: "project", Summary: "get the retention of the project", Response: repository.Retention{}},
+	"POST /project/retention/{project_id}":              {Tag: "project", Summary: "save the retention of the project", Body: repository.Retention{}},
+	"GET /project/webhook/{project_id}":                 {Tag: "project", Summary: "list the webhooks of the project, the secrets are hidden", Response: []repository.Webhook{}},
+	"POST /project/webhook/{project_id}":                {Tag: "project", Summary: "create or update the webhook of the project, events are bench.saved, regression.detected and job.failed", Body: repository.Webhook{}, Response: repository.Webhook{}},
+	"DELETE /project/webhook/{project_id}/{webhook_id}": {Tag: "project", Summary: "delete the webhook with its deliveries"},
+	"GET /project/webhook/{project_id}/{webhook_id}/deliveries": {Tag: "project", Summary: "list the last deliveries of the webhook", Query: []param{
+		{Name: "limit", Type: "integer", Description: "default is 20"},
+	}, Response: []repository.WebhookDelivery{}},
+	"GET /analyze/metrics/{session_id}": {Tag: "analyze", Summary: "get the last metrics of the workload keyed by metrics key", Query: []param{
+		{Name: "workload", Type: "string"},
+		{Name: "limit", Type: "integer", Description: "default is 10"},
+		{Name: "metrics", Type: "string", Array: true},
+	}, Response: map[string][]repository.Metrics{}},
+	"GET /analyze/config/{session_id}": {Tag: "analyze", Summary: "get the workload names and versions of the session", Response: []repository.Workload{}},
+	"GET /analyze/workload/{session_id}": {Tag: "analyze", Summary: "list the workloads of the session", Query: []param{
+		{Name: "workload", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "page", Type: "integer", Description: "default is 1"},
+		{Name: "size", Type: "integer", Description: "default is 20"},
+		labelParam,
+	}, Response: api.WorkloadPage{}},
+	"GET /analyze/bench/{session_id}/{name}": {Tag: "analyze", Summary: "get the workloads of the bench with metrics and labels", Query: []param{labelParam}, Response: []api.WorkloadMetrics{}},
+	"GET /analyze/bench/{session_id}/{name}/export": {Tag: "analyze", Summary: "export the bench as pivot table with workloads as rows and metric keys as columns", Query: []param{
+		{Name: "format", Type: "string", Description: "csv, md or html, default is csv"},
+		{Name: "baseline", Type: "string", Description: "bench name in the session to compare with"},
+		labelParam,
+	}},
+	"GET /analyze/live/{session_id}": {Tag: "analyze", Summary: "stream the summarized catalog metrics of the ongoing window from the prometheus of the session as server-sent events", Query: []param{
+		{Name: "interval", Type: "string", Description: "duration between the events, default is 15s and min is 5s"},
+		{Name: "metrics", Type: "string", Array: true, Description: "catalog metrics names, default is the whole catalog"},
+	}, Response: LiveMetrics{}},
+	"GET /analyze/search": {Tag: "analyze", Summary: "search the workloads by time range, bench, cmd, version, labels and metric values", Query: []param{
+		{Name: "session_id", Type: "integer", Array: true},
+		{Name: "project_id", Type: "integer", Description: "all the sessions of the project are searched"},
+		{Name: "workload", Type: "string"},
+		{Name: "bench", Type: "string"},
+		{Name: "version", Type: "string"},
+		{Name: "cmd", Type: "string", Description: "substring of the command"},
+		{Name: "cmd_regexp", Type: "string", Description: "regexp of the command"},
+		{Name: "from", Type: "integer", Description: "unix timestamp the run starts at or after"},
+		{Name: "to", Type: "integer", Description: "unix timestamp the run ends at or before"},
+		labelParam,
+		{Name: "metric", Type: "string", Array: true, Description: "metric predicate like tikv_cpu_std/avg>0.3, the operator is >, >=, <, <=, = or !="},
+		{Name: "sort", Type: "string", Description: "id, start, end or a metric key, runs without the metric key are skipped, default is id"},
+		{Name: "order", Type: "string", Description: "asc or desc, default is desc"},
+		{Name: "limit", Type: "integer", Description: "default is 20 and max is 200"},
+		{Name: "cursor", Type: "string", Description: "the next cursor of the last page"},
+	}, Response: api.SearchPage{}},
+	"GET /analyze/diff/{workload_id}/{other_id}": {Tag: "analyze", Summary: "diff config and metrics between two workloads", Response: api.WorkloadDiff{}},
+	"GET /analyze/detail/{workload_id}":          {Tag: "analyze", Summary: "get the workload with its metrics and labels", Response: api.WorkloadMetrics{}},
+	"GET /analyze/benches/{session_id}":          {Tag: "analyze", Summary: "list the benches of the session ordered by start time", Response: []repository.BenchSummary{}},
+	"GET /analyze/series/{workload_id}": {Tag: "analyze", Summary: "get the stored raw series of the workload", Query: []param{
+		{Name: "name", Type: "string", Array: true},
+	}, Response: []repository.Series{}},
+	"GET /analyze/query": {Tag: "analyze", Summary: "query the metrics of the workload across sessions or the sessions of the project", Query: []param{
+		{Name: "session_id", Type: "integer", Array: true},
+		{Name: "project_id", Type: "integer"},
+		{Name: "workload", Type: "string", Required: true},
+		{Name: "metrics", Type: "string", Array: true},
+		{Name: "start", Type: "integer", Description: "unix timestamp"},
+		{Name: "end", Type: "integer", Description: "unix timestamp"},
+	}, Response: []api.SessionSeries{}},
+	"GET /analyze/evaluate/{workload_id}": {Tag: "analyze", Summary: "evaluate the checker expression over the stored raw series of the workload", Query: []param{
+		{Name: "name", Type: "string", Required: true},
+		{Name: "expr", Type: "string", Required: true},
+	}, Response: new(interface{})},
+	"POST /analyze/baseline/{session_id}/{name}":   {Tag: "analyze", Summary: "mark the bench as baseline"},
+	"DELETE /analyze/baseline/{session_id}/{name}": {Tag: "analyze", Summary: "unmark the bench as baseline"},
+	"DELETE /analyze/workload/{workload_id}":       {Tag: "analyze", Summary: "delete the workload"},
+	"DELETE /analyze/session/{session_id}": {Tag: "analyze", Summary: "delete the workloads of the session by name", Query: []param{
+		{Name: "workload_name", Type: "string", Required: true},
+	}},
+	"POST /tools/{session_id}/{bench_name}": {Tag: "tools", Summary: "save the records of the bench", Query: []param{
+		{Name: "label", Type: "string", Array: true, Description: "bench label like key=value"},
+	}, Body: []repository.Record{}},
+	"POST /auth/token":                   {Tag: "auth", Summary: "create a db-backed token, the secret is only returned once", Body: api.TokenRequest{}, Response: api.TokenResponse{}},
+	"DELETE /auth/token/{name}":          {Tag: "auth", Summary: "delete the db-backed token"},
+	"GET /ui":                            {Tag: "ui", Summary: "redirect to the web ui"},
+	"GET /ui/":                           {Tag: "ui", Summary: "the embedded web ui, the rest of the path is the static file"},
+	"GET /proxy/{session_id}/{service}":  {Tag: "proxy", Summary: "proxy to the prom, pd, grafana or tidb address of the session, the rest of the path is forwarded"},
+	"POST /proxy/{session_id}/{service}": {Tag: "proxy", Summary: "proxy to the prom, pd, grafana or tidb address of the session, the rest of the path is forwarded"},
+	"GET /openapi.json":                  {Tag: "meta", Summary: "get the openapi document", Response: new(interface{})},
+	"GET /healthz":                       {Tag: "meta", Summary: "liveness probe"},
+	"GET /readyz":                        {Tag: "meta", Summary: "readiness probe, it checks the storage and prometheus, 503 if not ready", Response: ReadyStatus{}},
+	"GET /metrics":                       {Tag: "meta", Summary: "metrics of the analyzer in the prometheus text format"},
+	"GET /version":                       {Tag: "meta", Summary: "build info of the server", Response: version.Info{}},
+}
+
+var pathVarPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// openAPIPath removes the patterns of the path variables.
+func openAPIPath(template string) string {
+	return pathVarPattern.ReplaceAllString(template, "{$1}")
+}
+
+// OpenAPI builds the openapi 3 document of the routes of the router.
+func OpenAPI(router *mux.Router) map[string]interface{} {
+	builder := &schemaBuilder{components: make(map[string]interface{})}
+	paths := make(map[string]map[string]interface{})
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		path := openAPIPath(template)
+		for _, method := range methods {
+			doc, ok := apiDocs[method+" "+path]
+			if !ok {
+				continue
+			}
+			if paths[path] == nil {
+				paths[path] = make(map[string]interface{})
+			}
+			paths[path][strings.ToLower(method)] = builder.operation(path, doc)
+		}
+		return nil
+	})
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "pd-analyze",
+			"version": "1.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": builder.components,
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"bearer": []string{}}},
+	}
+}
+
+func (b *schemaBuilder) operation(path string, doc routeDoc) map[string]interface{} {
+	params := make([]interface{}, 0)
+	for _, m := range pathVarPattern.FindAllStringSubmatch(path, -1) {
+		typ := "string"
+		if strings.HasSuffix(m[1], "_id") {
+			typ = "integer"
+		}
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": typ},
+		})
+	}
+	for _, p := range doc.Query {
+		schema := map[string]interface{}{"type": p.Type}
+		if p.Array {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+		v := map[string]interface{}{"name": p.Name, "in": "query", "required": p.Required, "schema": schema}
+		if p.Description != "" {
+			v["description"] = p.Description
+		}
+		params = append(params, v)
+	}
+	op := map[string]interface{}{
+		"tags":       []string{doc.Tag},
+		"summary":    doc.Summary,
+		"parameters": params,
+	}
+	if doc.Body != nil {
+		contentType := doc.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{contentType: map[string]interface{}{"schema": b.schema(reflect.TypeOf(doc.Body))}},
+		}
+	}
+	ok := map[string]interface{}{
+		"description": "ok",
+		"content":     map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+	}
+	if doc.Response != nil {
+		ok["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(doc.Response))}}
+	}
+	errBody := map[string]interface{}{
+		"description": "error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": b.schema(reflect.TypeOf(api.ErrorBody{}))}},
+	}
+	op["responses"] = map[string]interface{}{"200": ok, "default": errBody}
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder derives the json schemas from the go types, named structs are put into the components.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := b.components[name]; !ok {
+			// the placeholder stops the recursion of self-referencing types.
+			b.components[name] = map[string]interface{}{}
+			properties := make(map[string]interface{})
+			b.properties(t, properties)
+			b.components[name] = map[string]interface{}{"type": "object", "properties": properties}
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// properties collects the json fields of the struct, embedded structs are flattened like encoding/json.
+func (b *schemaBuilder) properties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.properties(f.Type, properties)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = b.schema(f.Type)
+	}
+}
+
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + t.Name()
+}
+
+// openAPIHandler serves the document of the router, the routes are walked once on the first request.
+func openAPIHandler(router *mux.Router) http.HandlerFunc {
+	var once sync.Once
+	var doc map[string]interface{}
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { doc = OpenAPI(router) })
+		writeJSON(w, http.StatusOK, doc)
+	}
+}
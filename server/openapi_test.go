@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// routeKeys returns the method and path of every route of the router.
+func routeKeys(router *mux.Router) map[string]bool {
+	keys := make(map[string]bool)
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err1 := route.GetPathTemplate()
+		methods, err2 := route.GetMethods()
+		if err1 != nil || err2 != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if method != http.MethodOptions {
+				keys[method+" "+openAPIPath(template)] = true
+			}
+		}
+		return nil
+	})
+	return keys
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	as := assert.New(t)
+	router := (&Server{config: &config.Config{}}).CreateRoute()
+	keys := routeKeys(router)
+	for key := range keys {
+		_, ok := apiDocs[key]
+		as.True(ok, "route %s is not documented", key)
+	}
+	for key := range apiDocs {
+		as.True(keys[key], "documented route %s is not routed", key)
+	}
+
+	doc := OpenAPI(router)
+	body, err := json.Marshal(doc)
+	as.Nil(err)
+	var parsed struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	as.Nil(json.Unmarshal(body, &parsed))
+	as.Contains(parsed.Paths["/analyze/bench/{session_id}/{name}"], "get")
+	as.Contains(parsed.Paths["/project/{project_id}/export"], "get")
+	as.Contains(parsed.Components.Schemas, "api.WorkloadMetrics")
+	as.Contains(parsed.Components.Schemas, "repository.Workload")
+}
+
+func TestSchemaBuilder(t *testing.T) {
+	as := assert.New(t)
+	builder := &schemaBuilder{components: make(map[string]interface{})}
+	builder.schema(reflect.TypeOf(api.WorkloadMetrics{}))
+	schema := builder.components["api.WorkloadMetrics"].(map[string]interface{})
+	properties := schema["properties"].(map[string]interface{})
+	// the embedded workload is flattened like encoding/json does.
+	as.Contains(properties, "Name")
+	as.Contains(properties, "Metrics")
+	as.Contains(properties, "Labels")
+	as.Equal(map[string]interface{}{"type": "string", "format": "date-time"}, properties["Start"])
+}
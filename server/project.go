@@ -14,141 +14,549 @@
 package server
 
 import (
+	"bufio"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"log"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
 	"github.com/bufferflies/pd-analyze/repository"
-	"github.com/gorilla/mux"
 )
 
 type ProjectServer struct {
 	project repository.ProjectStorage
+	archive repository.ArchiveStorage
+	webhook repository.WebhookStorage
 }
 
-func NewProjectServer(storage repository.ProjectStorage) *ProjectServer {
+func NewProjectServer(storage repository.ProjectStorage, archive repository.ArchiveStorage, webhook repository.WebhookStorage) *ProjectServer {
 	return &ProjectServer{
 		project: storage,
+		archive: archive,
+		webhook: webhook,
 	}
 }
 
 func (s *ProjectServer) NewProject(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	name := query.Get("name")
-	description := query.Get("description")
-	err := s.project.Save(name, description)
+	var project repository.Project
+	if isJSON(r) {
+		if err := decodeBody(r.Body, &project); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else {
+		query := r.URL.Query()
+		project.Name, project.Description = query.Get("name"), query.Get("description")
+	}
+	project.ID = 0
+	if project.Name == "" {
+		writeError(w, errs.InvalidArgument("name is required"))
+		return
+	}
+	if err := s.project.SaveProject(&project); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+func (s *ProjectServer) GetProject(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	project, err := s.project.GetProject(pid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
 }
 
-func (s *ProjectServer) GetProjects(w http.ResponseWriter, r *http.Request) {
-	projects, err := s.project.GetAll()
+func (s *ProjectServer) UpdateProject(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	body, err := json.Marshal(projects)
+	project, err := s.project.GetProject(pid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
+		return
+	}
+	if err = decodeBody(r.Body, &project); err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(body))
+	if project.ID != pid {
+		writeError(w, errs.InvalidArgument("project id can not be changed"))
+		return
+	}
+	if project.Name == "" {
+		writeError(w, errs.InvalidArgument("name is required"))
+		return
+	}
+	if err = s.project.SaveProject(&project); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
 }
 
-func (s *ProjectServer) NewSession(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+func (s *ProjectServer) DeleteProject(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	var session repository.Session
-	if err = json.Unmarshal(body, &session); err != nil {
-		fmt.Fprint(w, err.Error())
+	if _, err = s.project.GetProject(pid); err != nil {
+		writeError(w, err)
 		return
 	}
-	err = s.project.SaveSession(session)
+	webhooks, err := s.webhook.GetWebhooks(pid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	for _, webhook := range webhooks {
+		if err = s.webhook.DeleteWebhook(webhook.ID); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if err = s.project.DeleteProject(pid); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+// isJSON returns true if the request body is json.
+func isJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+func (s *ProjectServer) GetProjects(w http.ResponseWriter, r *http.Request) {
+	projects, err := s.project.GetAll()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, projects)
+}
+
+func (s *ProjectServer) NewSession(w http.ResponseWriter, r *http.Request) {
+	var session repository.Session
+	if err := decodeBody(r.Body, &session); err != nil {
+		writeError(w, err)
+		return
+	}
+	if session.Name == "" {
+		writeError(w, errs.InvalidArgument("name is required"))
+		return
+	}
+	if _, err := s.project.GetProject(session.PID); err != nil {
+		writeError(w, err)
+		return
+	}
+	session.ID = 0
+	if err := s.project.SaveSession(&session); err != nil {
+		writeError(w, err)
+		return
+	}
+	session.GrafanaAuthorization = ""
+	writeJSON(w, http.StatusOK, session)
 }
 
 func (s *ProjectServer) UpdateSession(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	session, err := s.getSession(sid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
 
-	query := r.URL.Query()
-	name := query.Get("name")
-	targetObject := query.Get("target_object")
-	objects := query["objects"]
-	err = s.project.UpdateSession(uint(sid), name, targetObject, objects)
+	if !isJSON(r) {
+		query := r.URL.Query()
+		name := query.Get("name")
+		targetObject := query.Get("target_object")
+		objects := query["objects"]
+		err = s.project.UpdateSession(sid, name, targetObject, objects)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeOK(w)
+		return
+	}
+	pid, authorization := session.PID, session.GrafanaAuthorization
+	if err = decodeBody(r.Body, &session); err != nil {
+		writeError(w, err)
+		return
+	}
+	// the responses hide the grafana authorization, so the empty one keeps the stored one
+	if session.GrafanaAuthorization == "" {
+		session.GrafanaAuthorization = authorization
+	}
+	switch {
+	case session.ID != sid:
+		err = errs.InvalidArgument("session id can not be changed")
+	case session.PID != pid:
+		err = errs.InvalidArgument("session can not be moved to another project")
+	case session.Name == "":
+		err = errs.InvalidArgument("name is required")
+	}
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	if err = s.project.SaveSession(&session); err != nil {
+		writeError(w, err)
+		return
+	}
+	session.GrafanaAuthorization = ""
+	writeJSON(w, http.StatusOK, session)
 }
 
-func (s *ProjectServer) GetSessions(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	pid, err := strconv.ParseUint(vars["project_id"], 10, 32)
+func (s *ProjectServer) CloneSession(w http.ResponseWriter, r *http.Request) {
+	sid, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	sessions, err := s.project.GetSessions(uint(pid))
+	session, err := s.getSession(sid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	body, err := json.Marshal(sessions)
+	var clone api.SessionClone
+	if err = decodeBody(r.Body, &clone); err != nil {
+		writeError(w, err)
+		return
+	}
+	if clone.Name == "" {
+		writeError(w, errs.InvalidArgument("name is required"))
+		return
+	}
+	if clone.Description != "" {
+		session.Description = clone.Description
+	}
+	session.ID, session.Name = 0, clone.Name
+	session.CreatedAt, session.UpdatedAt = time.Time{}, time.Time{}
+	if err = s.project.SaveSession(&session); err != nil {
+		writeError(w, err)
+		return
+	}
+	session.GrafanaAuthorization = ""
+	writeJSON(w, http.StatusOK, session)
+}
+
+func (s *ProjectServer) GetSessions(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sessions, err := s.project.GetSessions(pid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, string(body))
+	for i := range sessions {
+		sessions[i].GrafanaAuthorization = ""
+	}
+	writeJSON(w, http.StatusOK, sessions)
 }
 
 func (s *ProjectServer) GetSession(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	session, err := s.project.GetSession(uint(sid))
+	session, err := s.getSession(sid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	body, err := json.Marshal(session)
+	session.GrafanaAuthorization = ""
+	writeJSON(w, http.StatusOK, session)
+}
+
+// getSession returns the session, it is not found error if the session does not exist.
+func (s *ProjectServer) getSession(sid uint) (repository.Session, error) {
+	session, err := s.project.GetSession(sid)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
-		return
+		return session, err
 	}
-	fmt.Fprint(w, string(body))
+	if session.ID == 0 {
+		return session, errs.NotFound("session %d not found", sid)
+	}
+	return session, nil
 }
 
 func (s *ProjectServer) DeleteSession(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseUint(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = s.project.DeleteSession(sid); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (s *ProjectServer) GetRetention(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	retention, err := s.project.GetRetention(pid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, retention)
+}
+
+func (s *ProjectServer) SaveRetention(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var retention repository.Retention
+	if err = decodeBody(r.Body, &retention); err != nil {
+		writeError(w, err)
+		return
+	}
+	if retention.KeepRuns < 0 || retention.KeepDays < 0 {
+		writeError(w, errs.InvalidArgument("keep_runs and keep_days must not be negative"))
+		return
+	}
+	retention.PID = pid
+	if err = s.project.SaveRetention(retention); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (s *ProjectServer) ExportProject(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "gzip" {
+		writeError(w, errs.InvalidArgument("query parameter format must be json or gzip"))
+		return
+	}
+	archive, err := s.archive.Export(pid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	name := fmt.Sprintf("project-%d.json", pid)
+	var writer io.Writer = w
+	if format == "gzip" {
+		name += ".gz"
+		w.Header().Set("Content-Type", "application/gzip")
+		gw := gzip.NewWriter(w)
+		defer gw.Close()
+		writer = gw
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if err := json.NewEncoder(writer).Encode(archive); err != nil {
+		log.Printf("export project %d failed, err:%v", pid, err)
+	}
+}
+
+func (s *ProjectServer) ImportProject(w http.ResponseWriter, r *http.Request) {
+	conflict := r.URL.Query().Get("conflict")
+	switch conflict {
+	case "", repository.ConflictSkip, repository.ConflictOverwrite, repository.ConflictRename:
+	default:
+		writeError(w, errs.InvalidArgument("query parameter conflict must be skip, overwrite or rename"))
+		return
+	}
+	archive, err := readProjectArchive(r.Body)
+	if err != nil {
+		writeError(w, errs.Wrap(errs.CodeInvalidArgument, err, "archive is invalid"))
+		return
+	}
+	project, err := s.archive.Import(archive, conflict)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+func (s *ProjectServer) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	if err = s.project.DeleteSession(uint(sid)); err != nil {
-		fmt.Fprint(w, err.Error())
+	webhooks, err := s.webhook.GetWebhooks(pid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (s *ProjectServer) SaveWebhook(w http.ResponseWriter, r *http.Request) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	var webhook repository.Webhook
+	if err = decodeBody(r.Body, &webhook); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = validateWebhook(&webhook); err != nil {
+		writeError(w, err)
+		return
+	}
+	if webhook.ID != 0 {
+		old, err := s.webhook.GetWebhook(webhook.ID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if old.PID != pid {
+			writeError(w, errs.NotFound("webhook %d not found in project %d", webhook.ID, pid))
+			return
+		}
+		// the responses hide the secret, so the empty secret keeps the stored one
+		if webhook.Secret == "" {
+			webhook.Secret = old.Secret
+		}
+		webhook.CreatedAt = old.CreatedAt
+	}
+	webhook.PID = pid
+	if err = s.webhook.SaveWebhook(&webhook); err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook.Secret = ""
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// validateWebhook checks the url, events and format of the webhook.
+func validateWebhook(webhook *repository.Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errs.InvalidArgument("webhook url %q must be a http or https url", webhook.URL)
+	}
+	if webhook.Events != "" {
+		events := strings.Split(webhook.Events, ",")
+		for i, event := range events {
+			events[i] = strings.TrimSpace(event)
+			if !webhookEvents[events[i]] {
+				return errs.InvalidArgument("webhook event %q is unknown", events[i])
+			}
+		}
+		webhook.Events = strings.Join(events, ",")
+	}
+	if webhook.Format == "" {
+		webhook.Format = "json"
+	}
+	_, err = formatPayload(webhook.Format, WebhookPayload{})
+	return err
+}
+
+func (s *ProjectServer) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := s.projectWebhook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = s.webhook.DeleteWebhook(webhook.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeOK(w)
+}
+
+func (s *ProjectServer) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, err := s.projectWebhook(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	limit, err := queryInt(r.URL.Query(), "limit", 20, 1)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	deliveries, err := s.webhook.GetDeliveries(webhook.ID, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// projectWebhook returns the webhook of the path, webhooks of the other projects are not found.
+func (s *ProjectServer) projectWebhook(r *http.Request) (repository.Webhook, error) {
+	pid, err := pathUint(r, "project_id")
+	if err != nil {
+		return repository.Webhook{}, err
+	}
+	id, err := pathUint(r, "webhook_id")
+	if err != nil {
+		return repository.Webhook{}, err
+	}
+	webhook, err := s.webhook.GetWebhook(id)
+	if err != nil {
+		return repository.Webhook{}, err
+	}
+	if webhook.PID != pid {
+		return repository.Webhook{}, errs.NotFound("webhook %d not found in project %d", id, pid)
+	}
+	return webhook, nil
+}
+
+// readProjectArchive decodes the archive in json or gzip'd json.
+func readProjectArchive(reader io.Reader) (*repository.ProjectArchive, error) {
+	br := bufio.NewReader(reader)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		reader = gr
+	} else {
+		reader = br
+	}
+	var archive repository.ProjectArchive
+	if err := json.NewDecoder(reader).Decode(&archive); err != nil {
+		return nil, err
+	}
+	return &archive, nil
 }
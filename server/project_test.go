@@ -0,0 +1,141 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadProjectArchive(t *testing.T) {
+	as := assert.New(t)
+	archive := repository.ProjectArchive{
+		Version: repository.ArchiveVersion,
+		Project: repository.Project{ID: 1, Name: "pd"},
+		Sessions: []repository.SessionArchive{
+			{Session: repository.Session{ID: 2, PID: 1, Name: "hot"}},
+		},
+	}
+	body, err := json.Marshal(archive)
+	as.Nil(err)
+
+	rst, err := readProjectArchive(bytes.NewReader(body))
+	as.Nil(err)
+	as.Equal(archive, *rst)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(body)
+	as.Nil(gw.Close())
+	rst, err = readProjectArchive(&buf)
+	as.Nil(err)
+	as.Equal(archive, *rst)
+
+	_, err = readProjectArchive(bytes.NewReader([]byte("{")))
+	as.NotNil(err)
+}
+
+func (s *stubProjectStorage) GetProject(pid uint) (repository.Project, error) {
+	project, ok := s.projects[pid]
+	if !ok {
+		return project, errs.NotFound("project %d not found", pid)
+	}
+	return project, nil
+}
+
+func (s *stubProjectStorage) SaveProject(project *repository.Project) error {
+	if project.ID == 0 {
+		project.ID = uint(len(s.projects) + 1)
+	}
+	s.projects[project.ID] = *project
+	return nil
+}
+
+func (s *stubProjectStorage) SaveSession(session *repository.Session) error {
+	if session.ID == 0 {
+		session.ID = uint(len(s.sessions) + 1)
+	}
+	s.sessions[session.ID] = *session
+	return nil
+}
+
+func TestProjectCRUD(t *testing.T) {
+	as := assert.New(t)
+	storage := &stubProjectStorage{
+		projects: map[uint]repository.Project{},
+		sessions: map[uint]repository.Session{},
+	}
+	router := mux.NewRouter()
+	s := NewProjectServer(storage, nil, nil)
+	router.HandleFunc("/project/new", s.NewProject).Methods(http.MethodPost)
+	router.HandleFunc("/project/{project_id:[0-9]+}", s.UpdateProject).Methods(http.MethodPut)
+	router.HandleFunc("/project/session/new", s.NewSession).Methods(http.MethodPost)
+	router.HandleFunc("/project/session/{session_id}", s.UpdateSession).Methods(http.MethodPut)
+	router.HandleFunc("/project/session/{session_id}", s.GetSession).Methods(http.MethodGet)
+	router.HandleFunc("/project/session/{session_id}/clone", s.CloneSession).Methods(http.MethodPost)
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/project/new", `{"name":"pd","description":"scheduling"}`)
+	as.Equal(http.StatusOK, w.Code)
+	as.Equal("scheduling", storage.projects[1].Description)
+	w = serve(http.MethodPost, "/project/new?name=tikv", "")
+	as.Equal(http.StatusOK, w.Code)
+	as.Equal("tikv", storage.projects[2].Name)
+	w = serve(http.MethodPost, "/project/new", `{"description":"no name"}`)
+	as.Equal(http.StatusBadRequest, w.Code)
+
+	w = serve(http.MethodPut, "/project/1", `{"name":"pd-v2"}`)
+	as.Equal(http.StatusOK, w.Code)
+	as.Equal(repository.Project{ID: 1, Name: "pd-v2", Description: "scheduling"}, storage.projects[1])
+	as.Equal(http.StatusNotFound, serve(http.MethodPut, "/project/9", `{"name":"x"}`).Code)
+
+	as.Equal(http.StatusNotFound, serve(http.MethodPost, "/project/session/new", `{"pid":9,"name":"hot"}`).Code)
+	w = serve(http.MethodPost, "/project/session/new", `{"pid":1,"name":"hot","prom_address":"http://prom","grafana_dashboards":"a,b","grafana_authorization":"Bearer grafana"}`)
+	as.Equal(http.StatusOK, w.Code)
+	var session repository.Session
+	as.Nil(json.Unmarshal(w.Body.Bytes(), &session))
+	as.Equal(uint(1), session.ID)
+	// the grafana credential is stored but never returned.
+	as.NotContains(w.Body.String(), "grafana_authorization")
+	as.Equal("Bearer grafana", storage.sessions[1].GrafanaAuthorization)
+	w = serve(http.MethodGet, "/project/session/1", "")
+	as.Equal(http.StatusOK, w.Code)
+	as.NotContains(w.Body.String(), "Bearer grafana")
+
+	as.Equal(http.StatusBadRequest, serve(http.MethodPut, "/project/session/1", `{"pid":2}`).Code)
+	w = serve(http.MethodPut, "/project/session/1", `{"descript":"hot region"}`)
+	as.Equal(http.StatusOK, w.Code)
+	as.Equal("http://prom", storage.sessions[1].PromAddress)
+	as.Equal("hot region", storage.sessions[1].Description)
+	w = serve(http.MethodPut, "/project/session/1", `{"grafana_authorization":""}`)
+	as.Equal(http.StatusOK, w.Code)
+	as.NotContains(w.Body.String(), "Bearer grafana")
+	as.Equal("Bearer grafana", storage.sessions[1].GrafanaAuthorization)
+
+	w = serve(http.MethodPost, "/project/session/1/clone", `{"name":"hot-copy"}`)
+	as.Equal(http.StatusOK, w.Code)
+	clone := storage.sessions[2]
+	as.Equal("hot-copy", clone.Name)
+	as.Equal(uint(1), clone.PID)
+	as.Equal("hot region", clone.Description)
+	as.Equal("a,b", clone.GrafanaDashboards)
+	as.Equal("Bearer grafana", clone.GrafanaAuthorization)
+	as.NotContains(w.Body.String(), "Bearer grafana")
+	as.Equal(http.StatusBadRequest, serve(http.MethodPost, "/project/session/1/clone", `{}`).Code)
+}
@@ -14,42 +14,161 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httputil"
 	url2 "net/url"
+	"path"
 	"strings"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
 )
 
+// proxyServices maps the proxied service to its address registered on the session.
+var proxyServices = map[string]func(repository.Session) string{
+	"prom":    func(s repository.Session) string { return s.PromAddress },
+	"pd":      func(s repository.Session) string { return s.PdAddress },
+	"grafana": func(s repository.Session) string { return s.GrafanaAddress },
+	"tidb":    func(s repository.Session) string { return s.TidbAddress },
+}
+
+// strippedHeaders are the credentials of the client that must not reach the proxied service.
+var strippedHeaders = []string{"Authorization", "X-Auth-Token", "Cookie", "Target"}
+
+// Proxy forwards `/proxy/{session_id}/{service}/...` to the address of the service registered on the session.
 type Proxy struct {
-	client *http.Client
+	storage   repository.ProjectStorage
+	transport http.RoundTripper
+	timeout   time.Duration
+	maxBody   int64
 }
 
-func NewProxy() *Proxy {
+func NewProxy(storage repository.ProjectStorage, timeout time.Duration, maxBody int64) *Proxy {
 	return &Proxy{
-		client: &http.Client{},
+		storage:   storage,
+		transport: &http.Transport{Proxy: http.ProxyFromEnvironment, ResponseHeaderTimeout: timeout},
+		timeout:   timeout,
+		maxBody:   maxBody,
 	}
 }
 
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	uri := strings.Trim(req.RequestURI, "/proxy")
-	target := fmt.Sprintf("%s/%s", req.Header.Get("target"), uri)
-	url, err := url2.Parse(target)
+	start := time.Now()
+	sid, err := pathUint(req, "session_id")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	service := mux.Vars(req)["service"]
+	address, ok := proxyServices[service]
+	if !ok {
+		writeError(w, errs.NotFound("service %s is not proxied, it must be prom, pd, grafana or tidb", service))
+		return
+	}
+	session, err := p.storage.GetSession(sid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if session.ID == 0 {
+		writeError(w, errs.NotFound("session %d not found", sid))
+		return
+	}
+	target, err := proxyTarget(address(session))
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, errs.Wrap(errs.CodeNotFound, err, "session %d has no valid %s address", sid, service))
 		return
 	}
+	if req.ContentLength > p.maxBody {
+		writeError(w, errs.InvalidArgument("request body is larger than %d bytes", p.maxBody))
+		return
+	}
+	prefix := fmt.Sprintf("/proxy/%d/%s", sid, service)
+	rest := strings.TrimPrefix(req.URL.Path, prefix)
 
-	req.URL = url
-	req.RequestURI = req.URL.Path
+	ctx, cancel := context.WithTimeout(req.Context(), p.timeout)
+	defer cancel()
+	proxy := &httputil.ReverseProxy{
+		Transport: p.transport,
+		Director: func(r *http.Request) {
+			r.URL.Scheme = target.Scheme
+			r.URL.Host = target.Host
+			r.URL.Path = path.Join("/", target.Path, rest)
+			if strings.HasSuffix(rest, "/") && !strings.HasSuffix(r.URL.Path, "/") {
+				r.URL.Path += "/"
+			}
+			r.URL.RawPath = ""
+			r.Host = target.Host
+			for _, h := range strippedHeaders {
+				r.Header.Del(h)
+			}
+			if service == "grafana" && session.GrafanaAuthorization != "" {
+				r.Header.Set("Authorization", session.GrafanaAuthorization)
+			}
+		},
+		ModifyResponse: func(rsp *http.Response) error {
+			if rsp.ContentLength > p.maxBody {
+				// the upstream is at fault, the error handler reports it as bad gateway.
+				return fmt.Errorf("response body is larger than %d bytes", p.maxBody)
+			}
+			rsp.Body = &limitedBody{ReadCloser: rsp.Body, remain: p.maxBody}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, errs.Wrap(errs.CodeBadGateway, err, "proxy to %s failed", service))
+		},
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, p.maxBody)
+	// the proxied service sets its own content type.
+	w.Header().Del("Content-Type")
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	proxy.ServeHTTP(sw, req.WithContext(ctx))
+	log.Printf("proxy session:%d service:%s method:%s path:%s status:%d duration:%s", sid, service, req.Method, rest, sw.code, time.Since(start))
+}
 
-	t := req.Header.Get("Target")
-	url, err = url2.Parse(t)
+// proxyTarget parses the registered address, the scheme defaults to http.
+func proxyTarget(address string) (*url2.URL, error) {
+	if address == "" {
+		return nil, fmt.Errorf("address is empty")
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	target, err := url2.Parse(address)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
-		return
+		return nil, err
 	}
-	proxy := httputil.NewSingleHostReverseProxy(url)
-	proxy.ServeHTTP(w, req)
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("address %s must be a http or https url", address)
+	}
+	return target, nil
+}
+
+// limitedBody fails the read once the body exceeds the limit, so a huge response is cut off.
+type limitedBody struct {
+	io.ReadCloser
+	remain int64
+}
 
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remain <= 0 {
+		// probe whether the body has more bytes than the limit.
+		var probe [1]byte
+		if n, _ := b.ReadCloser.Read(probe[:]); n > 0 {
+			return 0, fmt.Errorf("response body exceeds the limit")
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remain {
+		p = p[:b.remain]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remain -= int64(n)
+	return n, err
 }
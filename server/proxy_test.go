@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProjectStorage struct {
+	repository.ProjectStorage
+	sessions   map[uint]repository.Session
+	projects   map[uint]repository.Project
+	retentions []repository.Retention
+}
+
+func (s *stubProjectStorage) GetSession(sid uint) (repository.Session, error) {
+	return s.sessions[sid], nil
+}
+
+func TestProxy(t *testing.T) {
+	as := assert.New(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		as.Empty(r.Header.Get("X-Auth-Token"))
+		as.Empty(r.Header.Get("Cookie"))
+		w.Header().Set("X-Path", r.URL.Path+"?"+r.URL.RawQuery)
+		w.Header().Set("X-Authorization", r.Header.Get("Authorization"))
+		if r.URL.Path == "/big" {
+			w.Write([]byte(strings.Repeat("x", 2048)))
+			return
+		}
+		if r.URL.Path == "/prometheus/large" {
+			w.Header().Set("Content-Length", "2048")
+			w.Write([]byte(strings.Repeat("x", 2048)))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	storage := &stubProjectStorage{sessions: map[uint]repository.Session{
+		1: {ID: 1, PromAddress: upstream.URL + "/prometheus", GrafanaAddress: strings.TrimPrefix(upstream.URL, "http://"), GrafanaAuthorization: "Bearer grafana"},
+	}}
+	router := mux.NewRouter()
+	router.PathPrefix("/proxy/{session_id:[0-9]+}/{service}").Handler(NewProxy(storage, time.Second, 1024))
+
+	serve := func(method, url string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer client")
+		req.Header.Set("X-Auth-Token", "client")
+		req.Header.Set("Cookie", "session=client")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/proxy/1/prom/api/v1/query?query=up", "")
+	as.Equal(http.StatusOK, rec.Code)
+	as.Equal("/prometheus/api/v1/query?query=up", rec.Header().Get("X-Path"))
+	// the token of the client never reaches the proxied service.
+	as.Empty(rec.Header().Get("X-Authorization"))
+
+	rec = serve(http.MethodGet, "/proxy/1/grafana/api/dashboards/uid/abc", "")
+	as.Equal(http.StatusOK, rec.Code)
+	as.Equal("/api/dashboards/uid/abc?", rec.Header().Get("X-Path"))
+	as.Equal("Bearer grafana", rec.Header().Get("X-Authorization"))
+
+	as.Equal(http.StatusNotFound, serve(http.MethodGet, "/proxy/1/pd/pd/api/v1/config", "").Code)
+	as.Equal(http.StatusNotFound, serve(http.MethodGet, "/proxy/1/etcd/v3", "").Code)
+	as.Equal(http.StatusNotFound, serve(http.MethodGet, "/proxy/2/prom/api/v1/query", "").Code)
+	as.Equal(http.StatusBadRequest, serve(http.MethodPost, "/proxy/1/prom/api/v1/query", strings.Repeat("x", 2048)).Code)
+
+	rec = serve(http.MethodGet, "/proxy/1/prom/big", "")
+	as.True(rec.Body.Len() <= 1024)
+	// the oversized response is the fault of the upstream, not the client.
+	rec = serve(http.MethodGet, "/proxy/1/prom/large", "")
+	as.Equal(http.StatusBadGateway, rec.Code)
+	as.Contains(rec.Body.String(), `"code":"bad_gateway"`)
+}
+
+func TestProxyTarget(t *testing.T) {
+	as := assert.New(t)
+	target, err := proxyTarget("127.0.0.1:9090")
+	as.Nil(err)
+	as.Equal("http://127.0.0.1:9090", target.String())
+	_, err = proxyTarget("")
+	as.NotNil(err)
+	_, err = proxyTarget("file:///etc/passwd")
+	as.NotNil(err)
+}
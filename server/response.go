@@ -0,0 +1,95 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/gorilla/mux"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	e := errs.Convert(err)
+	status := e.Code.StatusCode()
+	if status == http.StatusInternalServerError {
+		log.Printf("request failed, err:%v", err)
+	}
+	writeJSON(w, status, api.ErrorBody{Code: e.Code, Message: e.Error(), Details: e.Details})
+}
+
+func writeOK(w http.ResponseWriter) {
+	fmt.Fprint(w, "ok")
+}
+
+// pathUint returns the unsigned integer path variable.
+func pathUint(r *http.Request, name string) (uint, error) {
+	v, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		return 0, errs.InvalidArgument("path parameter %s must be an unsigned integer", name).WithDetails(map[string]string{"parameter": name})
+	}
+	return uint(v), nil
+}
+
+// queryInt returns the integer query parameter, the default is used if it is empty.
+func queryInt(query url.Values, name string, def, min int) (int, error) {
+	s := query.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < min {
+		return 0, errs.InvalidArgument("query parameter %s must be an integer not less than %d", name, min).WithDetails(map[string]string{"parameter": name})
+	}
+	return v, nil
+}
+
+// queryUint returns the unsigned integer query parameter, zero is returned if it is empty.
+func queryUint(query url.Values, name string) (uint, error) {
+	s := query.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, errs.InvalidArgument("query parameter %s must be an unsigned integer", name).WithDetails(map[string]string{"parameter": name})
+	}
+	return uint(v), nil
+}
+
+// decodeBody decodes the json body into v.
+func decodeBody(body io.Reader, v interface{}) error {
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return errs.Wrap(errs.CodeInvalidArgument, err, "request body is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWriteError(t *testing.T) {
+	as := assert.New(t)
+	cases := []struct {
+		err    error
+		status int
+		code   errs.Code
+	}{
+		{errs.InvalidArgument("bad"), http.StatusBadRequest, errs.CodeInvalidArgument},
+		{errs.Argument_Not_Match, http.StatusBadRequest, errs.CodeInvalidArgument},
+		{errs.NotFound("missing"), http.StatusNotFound, errs.CodeNotFound},
+		{fmt.Errorf("find: %w", gorm.ErrRecordNotFound), http.StatusNotFound, errs.CodeNotFound},
+		{errs.Conflict("exists"), http.StatusConflict, errs.CodeConflict},
+		{errors.New("db down"), http.StatusInternalServerError, errs.CodeInternal},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeError(rec, c.err)
+		as.Equal(c.status, rec.Code)
+		var body api.ErrorBody
+		as.Nil(json.Unmarshal(rec.Body.Bytes(), &body))
+		as.Equal(c.code, body.Code)
+		as.Equal(c.err.Error(), body.Message)
+	}
+}
+
+func TestPathAndQueryValidation(t *testing.T) {
+	as := assert.New(t)
+	router := mux.NewRouter()
+	router.HandleFunc("/{session_id}", func(w http.ResponseWriter, r *http.Request) {
+		sid, err := pathUint(r, "session_id")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		page, err := queryInt(r.URL.Query(), "page", 1, 1)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, []int{int(sid), page})
+	})
+
+	for path, status := range map[string]int{"/1": http.StatusOK, "/1?page=2": http.StatusOK, "/a": http.StatusBadRequest, "/1?page=0": http.StatusBadRequest} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		as.Equal(status, rec.Code, path)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/a", nil))
+	var body api.ErrorBody
+	as.Nil(json.Unmarshal(rec.Body.Bytes(), &body))
+	as.Equal(map[string]interface{}{"parameter": "session_id"}, body.Details)
+}
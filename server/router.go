@@ -14,6 +14,7 @@
 package server
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 
@@ -21,59 +22,126 @@ import (
 	"github.com/bufferflies/pd-analyze/core"
 	"github.com/bufferflies/pd-analyze/repository"
 	"github.com/gorilla/mux"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
 type Server struct {
 	config          *config.Config
+	db              *gorm.DB
 	source          core.Source
 	checker         core.Parser
 	projectStorage  repository.ProjectStorage
 	workloadStorage repository.WorkloadStorage
+	archiveStorage  repository.ArchiveStorage
+	webhookStorage  repository.WebhookStorage
+	grafana         *Grafana
+	notifier        *Notifier
+	tokenStorage    repository.TokenStorage
+	// auth is nil if no token store is configured.
+	auth *Auth
+	// draining is set to 1 once the shutdown starts.
+	draining int32
+}
+
+// newMysqlManager opens the storage, the driver lives in the server so the api consumers don't link it.
+func newMysqlManager(address string, database string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("root@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", address, database)
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	return db, err
 }
 
 func NewServer(config *config.Config) *Server {
 	source := core.NewPrometheus(config.PrometheusAddress)
+	source.SetHook(observePrometheusQuery)
 	checker := core.NewChecker(source)
-	db, err := repository.NewMysqlManager(config.StorageAddress, "tinker")
+	db, err := newMysqlManager(config.StorageAddress, "tinker")
 	if err != nil {
 		log.Fatal("storage init failed", err)
 	}
+	instrumentDB(db)
 	projectStorage := repository.NewProjectDao(db)
 	workloadStorage := repository.NewWorkload(db, projectStorage)
-	return &Server{
+	webhookStorage := repository.NewWebhookDao(db)
+	server := &Server{
 		config:          config,
+		db:              db,
 		source:          source,
 		checker:         checker,
 		projectStorage:  projectStorage,
 		workloadStorage: workloadStorage,
+		archiveStorage:  repository.NewArchiveDao(db),
+		webhookStorage:  webhookStorage,
+		grafana:         NewGrafana(),
+		notifier:        NewNotifier(webhookStorage, config.WebhookRetries),
+	}
+	var stores []TokenStore
+	if config.TokenFile != "" {
+		store, err := NewFileTokenStore(config.TokenFile)
+		if err != nil {
+			log.Fatal("token file load failed", err)
+		}
+		stores = append(stores, store)
+	}
+	if config.TokenDB {
+		server.tokenStorage = repository.NewTokenDao(db)
+		stores = append(stores, NewDBTokenStore(server.tokenStorage))
+	}
+	if len(stores) > 0 {
+		server.auth = NewAuth(server, stores...)
 	}
+	return server
 }
 
-func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Access-Control-Allow-Headers", "X-Requested-With, Content-Type,Origin, Authorization, Accept, Client-Security-Token, Accept-Encoding, X-Auth-Token, content-type,Target")
-		w.Header().Set("content-type", "application/json")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE,PUT")
-		if r.Method == http.MethodOptions {
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// CORSMiddleware allows the origins in the allowlist, any origin is allowed if it is empty.
+func CORSMiddleware(origins []string) mux.MiddlewareFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[o] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(allowed) == 0 {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if origin := r.Header.Get("Origin"); allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Add("Access-Control-Allow-Headers", "X-Requested-With, Content-Type,Origin, Authorization, Accept, Client-Security-Token, Accept-Encoding, X-Auth-Token, content-type")
+			w.Header().Set("content-type", "application/json")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE,PUT")
+			if r.Method == http.MethodOptions {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func (server *Server) CreateRoute() *mux.Router {
 	router := mux.NewRouter()
 
 	projectRouter := router.PathPrefix("/project").Subrouter()
-	projectServer := NewProjectServer(server.projectStorage)
+	projectServer := NewProjectServer(server.projectStorage, server.archiveStorage, server.webhookStorage)
 	projectRouter.HandleFunc("/", projectServer.GetProjects).Methods(http.MethodGet)
 	projectRouter.HandleFunc("/new", projectServer.NewProject).Methods(http.MethodPost)
+	projectRouter.HandleFunc("/import", projectServer.ImportProject).Methods(http.MethodPost)
+	projectRouter.HandleFunc("/{project_id:[0-9]+}", projectServer.GetProject).Methods(http.MethodGet)
+	projectRouter.HandleFunc("/{project_id:[0-9]+}", projectServer.UpdateProject).Methods(http.MethodPut)
+	projectRouter.HandleFunc("/{project_id:[0-9]+}", projectServer.DeleteProject).Methods(http.MethodDelete, http.MethodOptions)
+	projectRouter.HandleFunc("/{project_id:[0-9]+}/export", projectServer.ExportProject).Methods(http.MethodGet)
 	projectRouter.HandleFunc("/session/new", projectServer.NewSession).Methods(http.MethodPost)
-	projectRouter.HandleFunc("/session/{session_id}", projectServer.UpdateSession).Methods(http.MethodPost)
+	projectRouter.HandleFunc("/session/{session_id}", projectServer.UpdateSession).Methods(http.MethodPost, http.MethodPut)
+	projectRouter.HandleFunc("/session/{session_id}/clone", projectServer.CloneSession).Methods(http.MethodPost)
 	projectRouter.HandleFunc("/sessions/{project_id}", projectServer.GetSessions).Methods(http.MethodGet)
 	projectRouter.HandleFunc("/session/{session_id}", projectServer.GetSession).Methods(http.MethodGet)
 	projectRouter.HandleFunc("/session/{session_id}", projectServer.DeleteSession).Methods(http.MethodDelete, http.MethodOptions)
+	projectRouter.HandleFunc("/retention/{project_id}", projectServer.GetRetention).Methods(http.MethodGet)
+	projectRouter.HandleFunc("/retention/{project_id}", projectServer.SaveRetention).Methods(http.MethodPost)
+	projectRouter.HandleFunc("/webhook/{project_id}", projectServer.GetWebhooks).Methods(http.MethodGet)
+	projectRouter.HandleFunc("/webhook/{project_id}", projectServer.SaveWebhook).Methods(http.MethodPost)
+	projectRouter.HandleFunc("/webhook/{project_id}/{webhook_id}", projectServer.DeleteWebhook).Methods(http.MethodDelete, http.MethodOptions)
+	projectRouter.HandleFunc("/webhook/{project_id}/{webhook_id}/deliveries", projectServer.GetDeliveries).Methods(http.MethodGet)
 
 	analyzeRouters := router.PathPrefix("/analyze").Subrouter()
 	analyze := NewPromAnalyze(server)
@@ -81,6 +149,16 @@ func (server *Server) CreateRoute() *mux.Router {
 	analyzeRouters.HandleFunc("/config/{session_id}", analyze.GetWorkloadNames).Methods(http.MethodGet)
 	analyzeRouters.HandleFunc("/workload/{session_id}", analyze.GetWorkloads).Methods(http.MethodGet)
 	analyzeRouters.HandleFunc("/bench/{session_id}/{name}", analyze.GetBench).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/bench/{session_id}/{name}/export", analyze.ExportBench).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/diff/{workload_id}/{other_id}", analyze.DiffWorkloads).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/series/{workload_id}", analyze.GetSeries).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/detail/{workload_id}", analyze.GetWorkloadDetail).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/benches/{session_id}", analyze.GetBenches).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/live/{session_id}", analyze.Live).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/search", analyze.SearchWorkloads).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/query", analyze.QueryMetrics).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/evaluate/{workload_id}", analyze.Evaluate).Methods(http.MethodGet)
+	analyzeRouters.HandleFunc("/baseline/{session_id}/{name}", analyze.SetBaseline).Methods(http.MethodPost, http.MethodDelete, http.MethodOptions)
 	analyzeRouters.HandleFunc("/workload/{workload_id}", analyze.DeleteWorkloads).Methods(http.MethodDelete, http.MethodOptions)
 	analyzeRouters.HandleFunc("/session/{session_id}", analyze.DeleteWorkloadByName).Methods(http.MethodDelete, http.MethodOptions)
 
@@ -88,7 +166,25 @@ func (server *Server) CreateRoute() *mux.Router {
 	tools := NewTools(server)
 	toolRouters.HandleFunc("/{session_id}/{bench_name}", tools.AnalyzeSchedule).Methods(http.MethodPost)
 
-	router.PathPrefix("/proxy/{path}").Handler(NewProxy())
-	router.Use(CORSMiddleware)
+	authRouters := router.PathPrefix("/auth").Subrouter()
+	authRouters.HandleFunc("/token", server.CreateToken).Methods(http.MethodPost)
+	authRouters.HandleFunc("/token/{name}", server.DeleteToken).Methods(http.MethodDelete, http.MethodOptions)
+
+	proxy := NewProxy(server.projectStorage, server.config.ProxyTimeout, server.config.ProxyMaxBodySize)
+	router.PathPrefix("/proxy/{session_id:[0-9]+}/{service}").Handler(proxy).Methods(http.MethodGet, http.MethodPost)
+	router.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently)).Methods(http.MethodGet)
+	router.PathPrefix("/ui/").Handler(uiHandler()).Methods(http.MethodGet)
+	router.HandleFunc("/openapi.json", openAPIHandler(router)).Methods(http.MethodGet)
+	router.Handle("/metrics", metricsHandler()).Methods(http.MethodGet)
+	router.HandleFunc("/healthz", server.Healthz).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", server.Readyz).Methods(http.MethodGet)
+	router.HandleFunc("/version", server.Version).Methods(http.MethodGet)
+	router.Use(MetricsMiddleware, CORSMiddleware(server.config.AllowOrigins))
+	if server.config.WriteTimeout > 0 {
+		router.Use(WriteDeadlineMiddleware(server.config.WriteTimeout))
+	}
+	if server.auth != nil {
+		router.Use(server.auth.Middleware)
+	}
 	return router
 }
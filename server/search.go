@@ -0,0 +1,157 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+const maxSearchLimit = 200
+
+func (analyze *PromAnalyze) SearchWorkloads(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search, err := parseSearch(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var scoped bool
+	search.SessionIDs, scoped, err = analyze.querySessions(query)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if scoped && len(search.SessionIDs) == 0 {
+		writeJSON(w, http.StatusOK, api.SearchPage{Workloads: []api.SearchHit{}})
+		return
+	}
+	loads, next, err := analyze.server.workloadStorage.SearchWorkloads(search)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = analyze.server.withLinks(loads); err != nil {
+		writeError(w, err)
+		return
+	}
+	keys := make([]string, 0, len(search.Metrics)+1)
+	for _, p := range search.Metrics {
+		keys = append(keys, p.Key)
+	}
+	if search.Sort != repository.SortID && search.Sort != repository.SortStart && search.Sort != repository.SortEnd {
+		keys = append(keys, search.Sort)
+	}
+	page := api.SearchPage{Workloads: make([]api.SearchHit, len(loads)), Next: next}
+	for i, l := range loads {
+		page.Workloads[i].Workload = l
+		if len(keys) == 0 {
+			continue
+		}
+		metrics, err := analyze.server.workloadStorage.GetMetricsByLoads(l.ID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		values := api.WorkloadMetrics{Metrics: metrics}.MetricsMap()
+		page.Workloads[i].Metrics = make(map[string]float64, len(keys))
+		for _, k := range keys {
+			if v, ok := values[k]; ok {
+				page.Workloads[i].Metrics[k] = v
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseSearch parses the filters, sort and page of the search except the sessions.
+func parseSearch(query url.Values) (repository.WorkloadSearch, error) {
+	get := query.Get
+	search := repository.WorkloadSearch{
+		Name:      get("workload"),
+		BenchName: get("bench"),
+		Version:   get("version"),
+		Cmd:       get("cmd"),
+		CmdRegexp: get("cmd_regexp"),
+		Sort:      get("sort"),
+		Cursor:    get("cursor"),
+	}
+	var err error
+	if search.From, err = parseUnix(get("from")); err != nil {
+		return search, errs.InvalidArgument("query parameter from must be an unix timestamp")
+	}
+	if search.To, err = parseUnix(get("to")); err != nil {
+		return search, errs.InvalidArgument("query parameter to must be an unix timestamp")
+	}
+	if search.Labels, err = repository.ParseLabelSelectors(query["label"]); err != nil {
+		return search, err
+	}
+	for _, s := range query["metric"] {
+		p, err := repository.ParseMetricPredicate(s)
+		if err != nil {
+			return search, err
+		}
+		search.Metrics = append(search.Metrics, p)
+	}
+	if search.Sort == "" {
+		search.Sort = repository.SortID
+	}
+	switch get("order") {
+	case "", "desc":
+	case "asc":
+		search.Asc = true
+	default:
+		return search, errs.InvalidArgument("query parameter order must be asc or desc")
+	}
+	if search.Limit, err = queryInt(query, "limit", 20, 1); err != nil {
+		return search, err
+	}
+	if search.Limit > maxSearchLimit {
+		return search, errs.InvalidArgument("query parameter limit must not be greater than %d", maxSearchLimit)
+	}
+	return search, nil
+}
+
+// querySessions returns the sessions in the session_id and project_id query parameters, scoped is false if neither is set.
+func (analyze *PromAnalyze) querySessions(query url.Values) (sessionIDs []uint, scoped bool, err error) {
+	sessionIDs = make([]uint, 0)
+	for _, v := range query["session_id"] {
+		sid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, false, errs.InvalidArgument("query parameter session_id must be an unsigned integer")
+		}
+		sessionIDs = append(sessionIDs, uint(sid))
+		scoped = true
+	}
+	pid, err := queryUint(query, "project_id")
+	if err != nil {
+		return nil, false, err
+	}
+	if pid > 0 {
+		sessions, err := analyze.server.projectStorage.GetSessions(pid)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, s := range sessions {
+			sessionIDs = append(sessionIDs, s.ID)
+		}
+		scoped = true
+	}
+	return sessionIDs, scoped, nil
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubWorkloadStorage struct {
+	repository.WorkloadStorage
+	search  repository.WorkloadSearch
+	loads   []repository.Workload
+	metrics map[uint][]repository.Metrics
+	deleted []uint
+}
+
+func (s *stubWorkloadStorage) SearchWorkloads(search repository.WorkloadSearch) ([]repository.Workload, string, error) {
+	s.search = search
+	return s.loads, "next", nil
+}
+
+func (s *stubWorkloadStorage) GetMetricsByLoads(wID uint) ([]repository.Metrics, error) {
+	return s.metrics[wID], nil
+}
+
+func TestSearchWorkloads(t *testing.T) {
+	as := assert.New(t)
+	storage := &stubWorkloadStorage{
+		loads: []repository.Workload{{ID: 3, SessionID: 1, Name: "w1"}},
+		metrics: map[uint][]repository.Metrics{3: {
+			{Key: "tikv_cpu_std/avg", Value: 0.4}, {Key: "qps", Value: 100}, {Key: "p99", Value: 8},
+		}},
+	}
+	server := &Server{
+		config:          &config.Config{},
+		workloadStorage: storage,
+		projectStorage:  &stubProjectStorage{sessions: map[uint]repository.Session{1: {ID: 1}}},
+	}
+	router := server.CreateRoute()
+	search := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/analyze/search?"+query, nil))
+		return w
+	}
+
+	w := search("session_id=1&bench=tpcc&cmd=--threads%3D64&from=100&label=pr%3D1&metric=tikv_cpu_std/avg%3E0.3&sort=qps&order=asc&limit=5&cursor=abc")
+	as.Equal(http.StatusOK, w.Code, w.Body.String())
+	as.Equal(repository.WorkloadSearch{
+		SessionIDs: []uint{1},
+		BenchName:  "tpcc",
+		Cmd:        "--threads=64",
+		From:       time.Unix(100, 0),
+		Labels:     []repository.LabelSelector{{Key: "pr", Op: repository.LabelEqual, Value: "1"}},
+		Metrics:    []repository.MetricPredicate{{Key: "tikv_cpu_std/avg", Op: ">", Value: 0.3}},
+		Sort:       "qps",
+		Asc:        true,
+		Cursor:     "abc",
+		Limit:      5,
+	}, storage.search)
+	var page api.SearchPage
+	as.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	as.Equal("next", page.Next)
+	as.Len(page.Workloads, 1)
+	as.Equal(map[string]float64{"tikv_cpu_std/avg": 0.4, "qps": 100}, page.Workloads[0].Metrics)
+
+	w = search("")
+	as.Equal(http.StatusOK, w.Code)
+	as.Equal(repository.SortID, storage.search.Sort)
+	as.Equal(20, storage.search.Limit)
+	page = api.SearchPage{}
+	as.NoError(json.Unmarshal(w.Body.Bytes(), &page))
+	as.Nil(page.Workloads[0].Metrics)
+
+	for _, query := range []string{"metric=qps", "order=up", "limit=1000", "from=yesterday", "session_id=x"} {
+		as.Equal(http.StatusBadRequest, search(query).Code, query)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+// seriesSource reads the stored raw series of the workload as core.Source, metrics is the series name.
+type seriesSource struct {
+	storage repository.WorkloadStorage
+	wID     uint
+}
+
+func newSeriesSource(storage repository.WorkloadStorage, wID uint) *seriesSource {
+	return &seriesSource{storage: storage, wID: wID}
+}
+
+func (s *seriesSource) Source(metrics, start, end string) (data [][]float64, err error) {
+	from, to := int64(math.MinInt64), int64(math.MaxInt64)
+	if start != "" {
+		if from, err = strconv.ParseInt(start, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if end != "" {
+		if to, err = strconv.ParseInt(end, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	series, err := s.storage.GetSeries(s.wID, []string{metrics})
+	if err != nil {
+		return nil, err
+	}
+	data = make([][]float64, len(series))
+	for i, ss := range series {
+		values := make([]float64, 0, len(ss.Values))
+		for j, ts := range ss.Timestamps {
+			if ts >= from && ts <= to {
+				values = append(values, ss.Values[j])
+			}
+		}
+		data[i] = values
+	}
+	return data, nil
+}
@@ -14,14 +14,12 @@
 package server
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
 
+	"github.com/bufferflies/pd-analyze/errs"
 	"github.com/bufferflies/pd-analyze/repository"
 )
 
@@ -44,36 +42,40 @@ func NewTools(server *Server) *Tools {
 	}
 }
 
-// @Tags analyze
-// @Summary analyze  scheduler
-// @Produce json
-// @Success 200 {object}
-// @Failure 500 {string} string "PD server failed to proceed the request."
-// @Router /tools/{session_id}/{bench_name} [Post]
 func (analyze *Tools) AnalyzeSchedule(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	sid, err := strconv.ParseInt(vars["session_id"], 10, 32)
+	sid, err := pathUint(r, "session_id")
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	benchName := vars["bench_name"]
+	benchName := mux.Vars(r)["bench_name"]
 
-	body, err := ioutil.ReadAll(r.Body)
+	var records []repository.Record
+	if err := decodeBody(r.Body, &records); err != nil {
+		writeError(w, err)
+		return
+	}
+	labels, err := repository.ParseLabels(r.URL.Query()["label"])
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		writeError(w, err)
 		return
 	}
-	var records []repository.Record
-
-	if err := json.Unmarshal(body, &records); err != nil {
-		fmt.Fprint(w, err.Error())
+	session, err := analyze.server.projectStorage.GetSession(sid)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if session.ID == 0 {
+		writeError(w, errs.NotFound("session %d not found", sid))
 		return
 	}
-	err = analyze.server.workloadStorage.SaveRecords(uint(sid), benchName, records)
+	err = analyze.server.workloadStorage.SaveRecords(sid, benchName, records, labels)
 	if err != nil {
-		fmt.Fprint(w, err.Error())
+		analyze.server.notifyJobFailed(session.PID, sid, benchName, fmt.Errorf("save records failed: %v", err))
+		writeError(w, err)
 		return
 	}
-	fmt.Fprint(w, "ok")
+	go analyze.server.grafana.AnnotateRecords(session, benchName, records)
+	go analyze.server.notifyBenchSaved(session, benchName)
+	writeOK(w)
 }
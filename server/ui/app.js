@@ -0,0 +1,354 @@
+// the single page ui of pd-analyze, it only talks to the json api of the same server.
+'use strict';
+
+const view = document.getElementById('view');
+const crumbs = document.getElementById('crumbs');
+const errorBox = document.getElementById('error');
+const tokenInput = document.getElementById('token');
+
+tokenInput.value = localStorage.getItem('pd-analyze-token') || '';
+document.getElementById('token-form').addEventListener('submit', (e) => {
+  e.preventDefault();
+  localStorage.setItem('pd-analyze-token', tokenInput.value);
+  route();
+});
+
+// request calls the api, failed responses are thrown with the message of the error body.
+async function request(method, path, query, body) {
+  const url = new URL(path, location.origin);
+  for (const [k, v] of Object.entries(query || {})) {
+    for (const item of [].concat(v)) {
+      if (item !== undefined && item !== '') url.searchParams.append(k, item);
+    }
+  }
+  const headers = {};
+  const token = localStorage.getItem('pd-analyze-token');
+  if (token) headers['Authorization'] = 'Bearer ' + token;
+  if (body !== undefined) headers['Content-Type'] = 'application/json';
+  const rsp = await fetch(url, { method, headers, body: body === undefined ? undefined : JSON.stringify(body) });
+  if (!rsp.ok) {
+    let message = rsp.status + ' ' + rsp.statusText;
+    try {
+      const e = await rsp.json();
+      message = e.code + ': ' + e.message;
+    } catch (_) { /* not the error body */ }
+    throw new Error(message);
+  }
+  return rsp;
+}
+
+async function api(method, path, query, body) {
+  const rsp = await request(method, path, query, body);
+  const type = rsp.headers.get('Content-Type') || '';
+  return type.includes('json') ? rsp.json() : rsp.text();
+}
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [k, v] of Object.entries(attrs || {})) {
+    if (k.startsWith('on')) node.addEventListener(k.slice(2), v);
+    else if (v !== undefined && v !== null && v !== false) node.setAttribute(k, v);
+  }
+  for (const child of children.flat()) {
+    if (child === null || child === undefined) continue;
+    node.append(child instanceof Node ? child : document.createTextNode(String(child)));
+  }
+  return node;
+}
+
+function link(href, text) {
+  return el('a', { href }, text);
+}
+
+function table(headers, rows) {
+  return el('table', null,
+    el('tr', null, headers.map((h) => el('th', null, h))),
+    rows.map((row) => el('tr', null, row.map((c) => (c instanceof Node && c.tagName === 'TD') ? c : el('td', null, c)))));
+}
+
+function num(v, delta) {
+  const td = el('td', { class: 'num' }, v === undefined ? '' : format(v));
+  if (delta !== undefined) {
+    td.append(' ', el('span', { class: delta >= 0 ? 'up' : 'down' }, (delta >= 0 ? '+' : '') + (delta * 100).toFixed(2) + '%'));
+  }
+  return td;
+}
+
+function format(v) {
+  return Number.isInteger(v) ? String(v) : Number(v).toPrecision(6);
+}
+
+function time(t) {
+  return t ? new Date(t).toLocaleString() : '';
+}
+
+function form(fields, submit, label) {
+  const inputs = {};
+  const node = el('form', { class: 'inline' },
+    fields.map((f) => {
+      inputs[f.name] = el('input', { name: f.name, placeholder: f.placeholder || f.name, value: f.value, required: f.required });
+      return inputs[f.name];
+    }),
+    el('button', { type: 'submit' }, label));
+  node.addEventListener('submit', async (e) => {
+    e.preventDefault();
+    const values = {};
+    for (const [k, input] of Object.entries(inputs)) values[k] = input.value.trim();
+    await guard(() => submit(values));
+  });
+  return node;
+}
+
+async function guard(fn) {
+  errorBox.hidden = true;
+  try {
+    await fn();
+  } catch (e) {
+    errorBox.textContent = e.message;
+    errorBox.hidden = false;
+  }
+}
+
+function setCrumbs(...items) {
+  crumbs.replaceChildren(...items.flatMap((item, i) => i ? [' / ', item] : [item]));
+}
+
+// download fetches the export with the token and saves it as file.
+async function download(path, query, name) {
+  const rsp = await request('GET', path, query);
+  const url = URL.createObjectURL(await rsp.blob());
+  el('a', { href: url, download: name }).click();
+  URL.revokeObjectURL(url);
+}
+
+const routes = [
+  [/^#?\/?$/, projectsView],
+  [/^#\/project\/(\d+)$/, sessionsView],
+  [/^#\/session\/(\d+)$/, sessionView],
+  [/^#\/bench\/(\d+)\/(.+)$/, benchView],
+  [/^#\/trend\/(\d+)\/(.+)$/, trendView],
+  [/^#\/diff\/(\d+)\/(\d+)$/, diffView],
+  [/^#\/live\/(\d+)$/, liveView],
+];
+
+// stop is called before the next view renders, it closes the live stream.
+let stop = () => {};
+
+async function route() {
+  stop();
+  stop = () => {};
+  for (const [pattern, render] of routes) {
+    const m = location.hash.match(pattern);
+    if (m) {
+      view.replaceChildren(el('p', { class: 'muted' }, 'loading...'));
+      await guard(() => render(...m.slice(1).map(decodeURIComponent)));
+      return;
+    }
+  }
+  location.hash = '#/';
+}
+
+window.addEventListener('hashchange', route);
+route();
+
+async function projectsView() {
+  setCrumbs(link('#/', 'projects'));
+  const projects = await api('GET', '/project/');
+  view.replaceChildren(
+    el('h2', null, 'projects'),
+    table(['id', 'name', 'description'], (projects || []).map((p) => [p.ID, link('#/project/' + p.ID, p.Name), p.Description])),
+    el('h3', null, 'new project'),
+    form([{ name: 'name', required: true }, { name: 'description' }], async (v) => {
+      await api('POST', '/project/new', undefined, v);
+      route();
+    }, 'create'));
+}
+
+async function sessionsView(pid) {
+  setCrumbs(link('#/', 'projects'), link('#/project/' + pid, 'project ' + pid));
+  const sessions = await api('GET', '/project/sessions/' + pid);
+  view.replaceChildren(
+    el('h2', null, 'sessions of project ' + pid),
+    table(['id', 'name', 'description', 'prometheus', 'created', ''], (sessions || []).map((s) => [
+      s.id, link('#/session/' + s.id, s.name), s.descript, s.prom_address, time(s.CreatedAt),
+      el('button', { class: 'danger', onclick: () => guard(async () => {
+        if (!confirm('delete session ' + s.name + ' with all its workloads?')) return;
+        await api('DELETE', '/project/session/' + s.id);
+        route();
+      }) }, 'delete'),
+    ])),
+    el('h3', null, 'new session'),
+    form([
+      { name: 'name', required: true }, { name: 'descript', placeholder: 'description' },
+      { name: 'prom_address', placeholder: 'prometheus address' }, { name: 'pd_address', placeholder: 'pd address' },
+      { name: 'grafana_address', placeholder: 'grafana address' },
+    ], async (v) => {
+      await api('POST', '/project/session/new', undefined, Object.assign({ pid: Number(pid) }, v));
+      route();
+    }, 'create'));
+}
+
+async function sessionView(sid) {
+  const session = await api('GET', '/project/session/' + sid);
+  setCrumbs(link('#/', 'projects'), link('#/project/' + session.pid, 'project ' + session.pid), link('#/session/' + sid, session.name));
+  const page = await api('GET', '/analyze/workload/' + sid, { size: 200 });
+  const benches = new Map();
+  for (const w of page.workloads || []) {
+    const bench = benches.get(w.BenchName) || { name: w.BenchName, runs: 0, start: w.Start, baseline: false };
+    bench.runs++;
+    bench.baseline = bench.baseline || w.Baseline;
+    if (w.Start > bench.start) bench.start = w.Start;
+    benches.set(w.BenchName, bench);
+  }
+  const names = await api('GET', '/analyze/config/' + sid);
+  view.replaceChildren(
+    el('h2', null, 'session ' + session.name),
+    el('p', null, link('#/live/' + sid, 'watch the live metrics')),
+    el('h3', null, 'benches'),
+    table(['bench', 'workloads', 'last start', 'baseline'], [...benches.values()].map((b) => [
+      link('#/bench/' + sid + '/' + encodeURIComponent(b.name), b.name), b.runs, time(b.start), b.baseline ? 'yes' : '',
+    ])),
+    page.count > (page.workloads || []).length ? el('p', { class: 'muted' }, 'only the last 200 of ' + page.count + ' workloads are listed') : null,
+    el('h3', null, 'workload trends'),
+    el('p', null, (names || []).map((w) => [link('#/trend/' + sid + '/' + encodeURIComponent(w.Name), w.Name), ' '])),
+    el('h3', null, 'compare workloads'),
+    form([{ name: 'old', placeholder: 'workload id', required: true }, { name: 'new', placeholder: 'other workload id', required: true }], (v) => {
+      location.hash = '#/diff/' + v.old + '/' + v.new;
+    }, 'compare'));
+}
+
+async function benchView(sid, name) {
+  setCrumbs(link('#/', 'projects'), link('#/session/' + sid, 'session ' + sid), link('#/bench/' + sid + '/' + encodeURIComponent(name), name));
+  const loads = await api('GET', '/analyze/bench/' + sid + '/' + encodeURIComponent(name));
+  const keys = [...new Set(loads.flatMap((l) => (l.Metrics || []).map((m) => m.Key)))].sort();
+  const values = (l) => Object.fromEntries((l.Metrics || []).map((m) => [m.Key, m.Value]));
+  const baseline = el('input', { placeholder: 'baseline bench' });
+  const exportPath = '/analyze/bench/' + sid + '/' + encodeURIComponent(name) + '/export';
+  view.replaceChildren(
+    el('h2', null, 'bench ' + name),
+    el('form', { class: 'inline', onsubmit: (e) => e.preventDefault() }, baseline,
+      ['csv', 'md', 'html'].map((format) => el('button', { type: 'button', onclick: () => guard(() =>
+        download(exportPath, { format, baseline: baseline.value.trim() }, name + '.' + format)) }, 'export ' + format))),
+    table(['id', 'workload', 'start', 'links'].concat(keys), loads.map((l) => {
+      const v = values(l);
+      return [l.ID, link('#/trend/' + sid + '/' + encodeURIComponent(l.Name), l.Name), time(l.Start),
+        el('span', null, (l.Links || []).map((d) => [el('a', { href: d.url, target: '_blank' }, d.dashboard), ' ']))]
+        .concat(keys.map((k) => num(v[k])));
+    })));
+}
+
+async function trendView(sid, workload) {
+  setCrumbs(link('#/', 'projects'), link('#/session/' + sid, 'session ' + sid), link('#/trend/' + sid + '/' + encodeURIComponent(workload), workload));
+  // default to the metric keys of the latest run of the workload.
+  let keys = [];
+  const page = await api('GET', '/analyze/workload/' + sid, { workload, size: 1 });
+  const latest = (page.workloads || [])[0];
+  if (latest) {
+    const loads = await api('GET', '/analyze/bench/' + sid + '/' + encodeURIComponent(latest.BenchName));
+    const load = loads.find((l) => l.ID === latest.ID) || {};
+    keys = (load.Metrics || []).map((m) => m.Key).sort();
+  }
+  const charts = el('div', { class: 'charts' });
+  const draw = async (metrics, limit) => {
+    const result = await api('GET', '/analyze/metrics/' + sid, { workload, metrics, limit });
+    charts.replaceChildren(...metrics.map((k) => el('div', { class: 'chart' }, el('div', null, k), lineChart((result[k] || []).slice().reverse()))));
+  };
+  view.replaceChildren(
+    el('h2', null, 'trend of ' + workload),
+    form([{ name: 'metrics', value: keys.join(','), placeholder: 'metric keys, comma separated' }, { name: 'limit', value: '30' }], async (v) => {
+      await draw(v.metrics.split(',').map((k) => k.trim()).filter((k) => k), v.limit);
+    }, 'draw'),
+    charts);
+  if (keys.length) await draw(keys, 30);
+}
+
+// lineChart draws the values in order of start as svg.
+function lineChart(points) {
+  const width = 360, height = 160, pad = 32;
+  const ns = 'http://www.w3.org/2000/svg';
+  const svg = document.createElementNS(ns, 'svg');
+  svg.setAttribute('width', width);
+  svg.setAttribute('height', height);
+  const add = (tag, attrs, text) => {
+    const node = document.createElementNS(ns, tag);
+    for (const [k, v] of Object.entries(attrs)) node.setAttribute(k, v);
+    if (text !== undefined) node.textContent = text;
+    svg.append(node);
+    return node;
+  };
+  if (!points.length) {
+    add('text', { x: pad, y: height / 2 }, 'no data');
+    return svg;
+  }
+  const values = points.map((p) => p.Value);
+  let min = Math.min(...values), max = Math.max(...values);
+  if (min === max) { min -= 1; max += 1; }
+  const x = (i) => pad + (points.length === 1 ? (width - 2 * pad) / 2 : i * (width - 2 * pad) / (points.length - 1));
+  const y = (v) => height - pad - (v - min) / (max - min) * (height - 2 * pad);
+  add('line', { x1: pad, y1: height - pad, x2: width - pad, y2: height - pad, stroke: '#ccc' });
+  add('text', { x: 2, y: pad }, format(max));
+  add('text', { x: 2, y: height - pad }, format(min));
+  add('polyline', { points: points.map((p, i) => x(i) + ',' + y(p.Value)).join(' '), fill: 'none', stroke: '#4a7ebb', 'stroke-width': 2 });
+  points.forEach((p, i) => {
+    const dot = add('circle', { cx: x(i), cy: y(p.Value), r: 3, fill: '#4a7ebb' });
+    const title = document.createElementNS(ns, 'title');
+    title.textContent = 'workload ' + p.WID + ' ' + time(p.Start) + ': ' + format(p.Value);
+    dot.append(title);
+  });
+  return svg;
+}
+
+async function diffView(wid, oid) {
+  const diff = await api('GET', '/analyze/diff/' + wid + '/' + oid);
+  setCrumbs(link('#/', 'projects'), link('#/session/' + diff.new.SessionID, 'session ' + diff.new.SessionID), link('#/diff/' + wid + '/' + oid, 'compare'));
+  const sign = { added: '+', removed: '-', changed: '~' };
+  view.replaceChildren(
+    el('h2', null, diff.old.Name + ' (' + diff.old.ID + ') versus ' + diff.new.Name + ' (' + diff.new.ID + ')'),
+    el('h3', null, 'metrics'),
+    table(['key', 'old', 'new', 'delta'], (diff.metrics || []).map((m) => [m.key, num(m.old), num(m.new), num(m.delta, m.ratio)])),
+    el('h3', null, 'config'),
+    (diff.config || []).length ? table(['', 'path', 'old', 'new'], diff.config.map((c) => [
+      sign[c.type], c.path, JSON.stringify(c.old), JSON.stringify(c.new),
+    ])) : el('p', { class: 'muted' }, 'no config change'));
+}
+
+// liveView reads the server-sent events with fetch, EventSource can not send the token.
+async function liveView(sid) {
+  setCrumbs(link('#/', 'projects'), link('#/session/' + sid, 'session ' + sid), link('#/live/' + sid, 'live'));
+  const controller = new AbortController();
+  stop = () => controller.abort();
+  const history = {};
+  const status = el('p', { class: 'muted' }, 'connecting...');
+  const charts = el('div', { class: 'charts' });
+  view.replaceChildren(el('h2', null, 'live metrics of session ' + sid), status, charts);
+  const render = (event) => {
+    status.textContent = 'updated at ' + time(event.time);
+    for (const [k, v] of Object.entries(event.metrics)) {
+      history[k] = (history[k] || []).concat({ WID: '-', Start: event.time, Value: v }).slice(-60);
+    }
+    charts.replaceChildren(...Object.keys(history).sort().map((k) => el('div', { class: 'chart' }, el('div', null, k), lineChart(history[k]))));
+  };
+  const rsp = await request('GET', '/analyze/live/' + sid, {});
+  if (controller.signal.aborted) {
+    rsp.body.cancel();
+    return;
+  }
+  const reader = rsp.body.pipeThrough(new TextDecoderStream()).getReader();
+  controller.signal.addEventListener('abort', () => reader.cancel());
+  let buffer = '';
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) break;
+    buffer += value;
+    let end;
+    while ((end = buffer.indexOf('\n\n')) >= 0) {
+      const block = buffer.slice(0, end);
+      buffer = buffer.slice(end + 2);
+      const event = (block.match(/^event: (.*)$/m) || [])[1];
+      const data = (block.match(/^data: (.*)$/m) || [])[1];
+      if (event === 'metrics') render(JSON.parse(data));
+      if (event === 'error') status.textContent = 'query failed: ' + JSON.parse(data).message;
+    }
+  }
+  if (!controller.signal.aborted) status.textContent = 'stream closed, reload to reconnect';
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bufferflies/pd-analyze/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUI(t *testing.T) {
+	as := assert.New(t)
+	server := &Server{config: &config.Config{}}
+	server.auth = NewAuth(server)
+	router := server.CreateRoute()
+
+	for path, contentType := range map[string]string{
+		"/ui/":          "text/html; charset=utf-8",
+		"/ui/style.css": "text/css; charset=utf-8",
+		"/ui/app.js":    "javascript",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		as.Equal(http.StatusOK, w.Code, path)
+		as.Contains(w.Header().Get("Content-Type"), contentType, path)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	as.Equal(http.StatusMovedPermanently, w.Code)
+	as.Equal("/ui/", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui/missing.js", nil))
+	as.Equal(http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,386 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/api"
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+)
+
+const (
+	EventBenchSaved         = "bench.saved"
+	EventRegressionDetected = "regression.detected"
+	EventJobFailed          = "job.failed"
+)
+
+var webhookEvents = map[string]bool{EventBenchSaved: true, EventRegressionDetected: true, EventJobFailed: true}
+
+const (
+	webhookQueueSize       = 1024
+	webhookWorkerQueueSize = 64
+	webhookWorkerIdle      = 5 * time.Minute
+	webhookTimeout         = 10 * time.Second
+)
+
+// WorkloadDelta is the metric deltas of the workload versus the latest baseline run of the same workload name.
+type WorkloadDelta struct {
+	WID         uint               `json:"wid"`
+	Workload    string             `json:"workload"`
+	BaselineID  uint               `json:"baseline_id,omitempty"`
+	Metrics     []core.MetricDelta `json:"metrics,omitempty"`
+	Regressions []core.MetricDelta `json:"regressions,omitempty"` // the adverse deltas whose ratio exceeds the threshold
+}
+
+// WebhookPayload is the generic json payload of the events.
+type WebhookPayload struct {
+	Event     string          `json:"event"`
+	ProjectID uint            `json:"project_id"`
+	SessionID uint            `json:"session_id"`
+	BenchName string          `json:"bench_name,omitempty"`
+	Time      time.Time       `json:"time"`
+	Message   string          `json:"message,omitempty"`
+	Workloads []WorkloadDelta `json:"workloads,omitempty"`
+}
+
+// Text renders the payload for the chats.
+func (p WebhookPayload) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[pd-analyze] %s project:%d session:%d", p.Event, p.ProjectID, p.SessionID)
+	if p.BenchName != "" {
+		fmt.Fprintf(&b, " bench:%s", p.BenchName)
+	}
+	if p.Message != "" {
+		fmt.Fprintf(&b, "\n%s", p.Message)
+	}
+	for _, w := range p.Workloads {
+		deltas := w.Metrics
+		if p.Event == EventRegressionDetected {
+			deltas = w.Regressions
+		}
+		for _, d := range deltas {
+			fmt.Fprintf(&b, "\n%s %s: %.4f -> %.4f (%+.2f%%)", w.Workload, d.Key, d.Old, d.New, d.Ratio*100)
+		}
+	}
+	return b.String()
+}
+
+// formatPayload renders the payload as the generic json or the slack/lark compatible message.
+func formatPayload(format string, payload WebhookPayload) ([]byte, error) {
+	switch format {
+	case "", "json":
+		return json.Marshal(payload)
+	case "slack":
+		return json.Marshal(map[string]string{"text": payload.Text()})
+	case "lark":
+		return json.Marshal(map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": payload.Text()},
+		})
+	default:
+		return nil, errs.InvalidArgument("webhook format %s must be json, slack or lark", format)
+	}
+}
+
+// signPayload returns the hex hmac-sha256 of the body.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookJob struct {
+	webhook repository.Webhook
+	payload WebhookPayload
+}
+
+// Notifier delivers the events to the webhooks of the project, every attempt is logged in the storage.
+type Notifier struct {
+	storage repository.WebhookStorage
+	client  *http.Client
+	queue   chan webhookJob
+	retries int
+	backoff time.Duration
+	// idle is how long a worker waits for the events of its webhook before it stops, so the deleted webhooks
+	// do not keep their workers.
+	idle time.Duration
+	// workers is the number of the running workers.
+	workers int32
+}
+
+func NewNotifier(storage repository.WebhookStorage, retries int) *Notifier {
+	return &Notifier{
+		storage: storage,
+		client:  &http.Client{Timeout: webhookTimeout},
+		queue:   make(chan webhookJob, webhookQueueSize),
+		retries: retries,
+		backoff: time.Second,
+		idle:    webhookWorkerIdle,
+	}
+}
+
+// Notify enqueues the payload for the webhooks subscribing the event, it never blocks the caller.
+func (n *Notifier) Notify(payload WebhookPayload) {
+	if payload.Time.IsZero() {
+		payload.Time = time.Now()
+	}
+	webhooks, err := n.storage.GetWebhooks(payload.ProjectID)
+	if err != nil {
+		log.Printf("get webhooks of project %d failed, err:%v", payload.ProjectID, err)
+		return
+	}
+	for _, w := range webhooks {
+		if !w.Subscribes(payload.Event) {
+			continue
+		}
+		select {
+		case n.queue <- webhookJob{webhook: w, payload: payload}:
+			JobQueueDepth.WithLabelValues("webhook").Inc()
+		default:
+			log.Printf("webhook queue is full, event %s of webhook %d is dropped", payload.Event, w.ID)
+		}
+	}
+}
+
+// Run dispatches the queued events to the workers of the webhooks until the context is done, every webhook
+// is delivered by its own worker in order, so the retries of a dead endpoint only delay its own events.
+// The idle worker is stopped and started again by the next event of its webhook.
+func (n *Notifier) Run(ctx context.Context) {
+	workers := make(map[uint]chan webhookJob)
+	idle := make(chan uint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-idle:
+			// the worker delivers the jobs already in its queue, then stops once the queue is closed
+			close(workers[id])
+			delete(workers, id)
+		case job := <-n.queue:
+			JobQueueDepth.WithLabelValues("webhook").Dec()
+			worker, ok := workers[job.webhook.ID]
+			if !ok {
+				worker = make(chan webhookJob, webhookWorkerQueueSize)
+				workers[job.webhook.ID] = worker
+				atomic.AddInt32(&n.workers, 1)
+				go n.work(ctx, job.webhook.ID, worker, idle)
+			}
+			select {
+			case worker <- job:
+			default:
+				log.Printf("queue of webhook %d is full, event %s is dropped", job.webhook.ID, job.payload.Event)
+			}
+		}
+	}
+}
+
+// work delivers the events of one webhook until the context is done or its queue is closed, it reports the
+// webhook to idle once no event comes within the idle duration.
+func (n *Notifier) work(ctx context.Context, id uint, jobs <-chan webhookJob, idle chan<- uint) {
+	defer atomic.AddInt32(&n.workers, -1)
+	timer := time.NewTimer(n.idle)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job, ok := <-jobs:
+			if !ok {
+				return
+			}
+			n.deliver(ctx, job)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(n.idle)
+		case <-timer.C:
+			select {
+			case idle <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// deliver sends the event with exponential backoff, it gives up after the retries.
+func (n *Notifier) deliver(ctx context.Context, job webhookJob) {
+	body, err := formatPayload(job.webhook.Format, job.payload)
+	if err != nil {
+		log.Printf("format event %s of webhook %d failed, err:%v", job.payload.Event, job.webhook.ID, err)
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		status, err := n.send(ctx, job.webhook, job.payload.Event, body)
+		delivery := &repository.WebhookDelivery{
+			WebhookID: job.webhook.ID,
+			Event:     job.payload.Event,
+			Payload:   string(body),
+			Attempt:   attempt,
+			Status:    status,
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if e := n.storage.SaveDelivery(delivery); e != nil {
+			log.Printf("save delivery of webhook %d failed, err:%v", job.webhook.ID, e)
+		}
+		if err == nil || attempt > n.retries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(n.backoff << uint(attempt-1)):
+		}
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, webhook repository.Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Analyze-Event", event)
+	if webhook.Secret != "" {
+		req.Header.Set("X-Analyze-Signature", "sha256="+signPayload(webhook.Secret, body))
+	}
+	rsp, err := n.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		return rsp.StatusCode, fmt.Errorf("response is not ok code:%d", rsp.StatusCode)
+	}
+	return rsp.StatusCode, nil
+}
+
+// notifyBenchSaved fires bench.saved with the deltas versus the baselines, and regression.detected if any delta exceeds the threshold.
+func (server *Server) notifyBenchSaved(session repository.Session, benchName string) {
+	deltas, err := server.benchDeltas(session.ID, benchName)
+	if err != nil {
+		log.Printf("compare bench %s with baseline failed, err:%v", benchName, err)
+		return
+	}
+	payload := WebhookPayload{Event: EventBenchSaved, ProjectID: session.PID, SessionID: session.ID, BenchName: benchName, Time: time.Now(), Workloads: deltas}
+	server.notifier.Notify(payload)
+	regressed := make([]WorkloadDelta, 0)
+	for _, d := range deltas {
+		if len(d.Regressions) > 0 {
+			regressed = append(regressed, d)
+		}
+	}
+	if len(regressed) > 0 {
+		payload.Event, payload.Workloads = EventRegressionDetected, regressed
+		server.notifier.Notify(payload)
+	}
+}
+
+// notifyJobFailed fires job.failed of the project.
+func (server *Server) notifyJobFailed(pid, sid uint, benchName string, err error) {
+	server.notifier.Notify(WebhookPayload{Event: EventJobFailed, ProjectID: pid, SessionID: sid, BenchName: benchName, Time: time.Now(), Message: err.Error()})
+}
+
+// benchDeltas compares the latest run of every workload of the bench with the latest baseline run of the same
+// workload name in the session, the workloads without baseline have no deltas.
+func (server *Server) benchDeltas(sessionID uint, benchName string) ([]WorkloadDelta, error) {
+	loads, err := server.workloadStorage.GetWorkloadsBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	latest, baselines := latestRuns(loads, benchName)
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]WorkloadDelta, 0, len(names))
+	for _, name := range names {
+		load := latest[name]
+		delta := WorkloadDelta{WID: load.ID, Workload: name}
+		if baseline, ok := baselines[name]; ok {
+			old, err := server.workloadStorage.GetMetricsByLoads(baseline.ID)
+			if err != nil {
+				return nil, err
+			}
+			new, err := server.workloadStorage.GetMetricsByLoads(load.ID)
+			if err != nil {
+				return nil, err
+			}
+			delta.BaselineID = baseline.ID
+			delta.Metrics = core.DiffMetrics(api.WorkloadMetrics{Metrics: old}.MetricsMap(), api.WorkloadMetrics{Metrics: new}.MetricsMap())
+			delta.Regressions = regressions(delta.Metrics, server.config.RegressionThreshold)
+		}
+		result = append(result, delta)
+	}
+	return result, nil
+}
+
+// latestRuns returns the latest run of the bench and the latest baseline run of other benches keyed by workload name.
+func latestRuns(loads []repository.Workload, benchName string) (map[string]repository.Workload, map[string]repository.Workload) {
+	latest := make(map[string]repository.Workload)
+	baselines := make(map[string]repository.Workload)
+	for _, l := range loads {
+		switch {
+		case l.BenchName == benchName:
+			if l.ID > latest[l.Name].ID {
+				latest[l.Name] = l
+			}
+		case l.Baseline:
+			if l.ID > baselines[l.Name].ID {
+				baselines[l.Name] = l
+			}
+		}
+	}
+	return latest, baselines
+}
+
+// regressions returns the deltas whose ratio reaches the threshold in the adverse direction of the metric,
+// e.g. the drop of qps or the rise of latency, zero threshold disables it.
+func regressions(deltas []core.MetricDelta, threshold float64) []core.MetricDelta {
+	if threshold <= 0 {
+		return nil
+	}
+	result := make([]core.MetricDelta, 0)
+	for _, d := range deltas {
+		adverse := d.Ratio
+		if core.HigherIsBetter(d.Key) {
+			adverse = -adverse
+		}
+		if adverse >= threshold {
+			result = append(result, d)
+		}
+	}
+	return result
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bufferflies/pd-analyze/core"
+	"github.com/bufferflies/pd-analyze/errs"
+	"github.com/bufferflies/pd-analyze/repository"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubWebhookStorage struct {
+	repository.WebhookStorage
+	sync.Mutex
+	webhooks   []repository.Webhook
+	deliveries []repository.WebhookDelivery
+}
+
+func (s *stubWebhookStorage) GetWebhooks(pid uint) ([]repository.Webhook, error) {
+	result := make([]repository.Webhook, 0)
+	for _, w := range s.webhooks {
+		if w.PID == pid {
+			result = append(result, w)
+		}
+	}
+	return result, nil
+}
+
+func (s *stubWebhookStorage) GetWebhook(id uint) (repository.Webhook, error) {
+	for _, w := range s.webhooks {
+		if w.ID == id {
+			return w, nil
+		}
+	}
+	return repository.Webhook{}, errs.NotFound("webhook %d not found", id)
+}
+
+func (s *stubWebhookStorage) SaveWebhook(webhook *repository.Webhook) error {
+	for i, w := range s.webhooks {
+		if w.ID == webhook.ID {
+			s.webhooks[i] = *webhook
+			return nil
+		}
+	}
+	webhook.ID = uint(len(s.webhooks) + 1)
+	s.webhooks = append(s.webhooks, *webhook)
+	return nil
+}
+
+func (s *stubWebhookStorage) SaveDelivery(delivery *repository.WebhookDelivery) error {
+	s.Lock()
+	defer s.Unlock()
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+func TestNotifierDeliver(t *testing.T) {
+	as := assert.New(t)
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		as.Equal(EventBenchSaved, r.Header.Get("X-Analyze-Event"))
+		as.Equal("sha256="+signPayload("secret", body), r.Header.Get("X-Analyze-Signature"))
+		var payload WebhookPayload
+		as.NoError(json.Unmarshal(body, &payload))
+		as.Equal("tpcc", payload.BenchName)
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer upstream.Close()
+
+	storage := &stubWebhookStorage{webhooks: []repository.Webhook{
+		{ID: 1, PID: 1, URL: upstream.URL, Secret: "secret"},
+		{ID: 2, PID: 1, URL: upstream.URL, Events: EventJobFailed},
+		{ID: 3, PID: 2, URL: upstream.URL},
+	}}
+	notifier := NewNotifier(storage, 2)
+	notifier.backoff = time.Millisecond
+	notifier.Notify(WebhookPayload{Event: EventBenchSaved, ProjectID: 1, SessionID: 1, BenchName: "tpcc"})
+	as.Len(notifier.queue, 1)
+
+	notifier.deliver(context.Background(), <-notifier.queue)
+	as.Equal(2, calls)
+	as.Len(storage.deliveries, 2)
+	as.Equal(1, storage.deliveries[0].Attempt)
+	as.Equal(http.StatusInternalServerError, storage.deliveries[0].Status)
+	as.NotEmpty(storage.deliveries[0].Error)
+	as.Equal(2, storage.deliveries[1].Attempt)
+	as.Equal(http.StatusOK, storage.deliveries[1].Status)
+	as.Empty(storage.deliveries[1].Error)
+}
+
+func TestNotifierGiveUp(t *testing.T) {
+	as := assert.New(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer upstream.Close()
+
+	storage := &stubWebhookStorage{}
+	notifier := NewNotifier(storage, 1)
+	notifier.backoff = time.Millisecond
+	notifier.deliver(context.Background(), webhookJob{
+		webhook: repository.Webhook{ID: 1, URL: upstream.URL},
+		payload: WebhookPayload{Event: EventJobFailed, Message: "failed"},
+	})
+	as.Len(storage.deliveries, 2)
+	as.Equal(http.StatusBadGateway, storage.deliveries[1].Status)
+}
+
+func TestNotifierDeadEndpoint(t *testing.T) {
+	as := assert.New(t)
+	blocked := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-blocked
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer dead.Close()
+	defer close(blocked)
+	delivered := make(chan struct{}, 1)
+	alive := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer alive.Close()
+
+	storage := &stubWebhookStorage{webhooks: []repository.Webhook{
+		{ID: 1, PID: 1, URL: dead.URL},
+		{ID: 2, PID: 2, URL: alive.URL},
+	}}
+	notifier := NewNotifier(storage, 3)
+	notifier.backoff = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+	notifier.Notify(WebhookPayload{Event: EventJobFailed, ProjectID: 1, Message: "failed"})
+	notifier.Notify(WebhookPayload{Event: EventJobFailed, ProjectID: 2, Message: "failed"})
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		as.Fail("the event of the alive endpoint is blocked by the dead one")
+	}
+}
+
+func TestNotifierIdleWorker(t *testing.T) {
+	as := assert.New(t)
+	delivered := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered <- struct{}{}
+	}))
+	defer ts.Close()
+
+	storage := &stubWebhookStorage{webhooks: []repository.Webhook{{ID: 1, PID: 1, URL: ts.URL}}}
+	notifier := NewNotifier(storage, 0)
+	notifier.idle = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go notifier.Run(ctx)
+	for i := 0; i < 2; i++ {
+		notifier.Notify(WebhookPayload{Event: EventJobFailed, ProjectID: 1, Message: "failed"})
+		select {
+		case <-delivered:
+		case <-time.After(5 * time.Second):
+			as.FailNow("the event is not delivered")
+		}
+		// the worker stops once the webhook is idle, e.g. it is deleted, and the next event starts it again.
+		as.Eventually(func() bool { return atomic.LoadInt32(&notifier.workers) == 0 }, time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestFormatPayload(t *testing.T) {
+	as := assert.New(t)
+	payload := WebhookPayload{
+		Event:     EventRegressionDetected,
+		ProjectID: 1,
+		SessionID: 2,
+		BenchName: "tpcc",
+		Workloads: []WorkloadDelta{{Workload: "w1", Regressions: []core.MetricDelta{{Key: "qps", Old: 100, New: 80, Ratio: -0.2}}}},
+	}
+	body, err := formatPayload("slack", payload)
+	as.NoError(err)
+	var slack map[string]string
+	as.NoError(json.Unmarshal(body, &slack))
+	as.Equal("[pd-analyze] regression.detected project:1 session:2 bench:tpcc\nw1 qps: 100.0000 -> 80.0000 (-20.00%)", slack["text"])
+
+	body, err = formatPayload("lark", payload)
+	as.NoError(err)
+	var lark struct {
+		MsgType string            `json:"msg_type"`
+		Content map[string]string `json:"content"`
+	}
+	as.NoError(json.Unmarshal(body, &lark))
+	as.Equal("text", lark.MsgType)
+	as.Equal(slack["text"], lark.Content["text"])
+
+	_, err = formatPayload("teams", payload)
+	as.Error(err)
+}
+
+func TestRegressions(t *testing.T) {
+	as := assert.New(t)
+	loads := []repository.Workload{
+		{ID: 1, Name: "w1", BenchName: "b1", Baseline: true},
+		{ID: 2, Name: "w1", BenchName: "b2", Baseline: true},
+		{ID: 3, Name: "w1", BenchName: "b3"},
+		{ID: 4, Name: "w1", BenchName: "b3"},
+		{ID: 5, Name: "w2", BenchName: "b3"},
+	}
+	latest, baselines := latestRuns(loads, "b3")
+	as.Equal(uint(4), latest["w1"].ID)
+	as.Equal(uint(5), latest["w2"].ID)
+	as.Equal(uint(2), baselines["w1"].ID)
+	as.NotContains(baselines, "w2")
+
+	deltas := core.DiffMetrics(map[string]float64{"sysbench_qps": 100, "sysbench_latency_p99": 10},
+		map[string]float64{"sysbench_qps": 95, "sysbench_latency_p99": 12})
+	result := regressions(deltas, 0.1)
+	as.Len(result, 1)
+	as.Equal("sysbench_latency_p99", result[0].Key)
+	as.Empty(regressions(deltas, 0))
+
+	// the improvements are not regressions
+	deltas = core.DiffMetrics(map[string]float64{"sysbench_qps": 100, "sysbench_latency_p99": 10},
+		map[string]float64{"sysbench_qps": 120, "sysbench_latency_p99": 8})
+	as.Empty(regressions(deltas, 0.1))
+	deltas = core.DiffMetrics(map[string]float64{"sysbench_qps": 100, "sysbench_latency_p99": 10},
+		map[string]float64{"sysbench_qps": 80, "sysbench_latency_p99": 10})
+	result = regressions(deltas, 0.1)
+	as.Len(result, 1)
+	as.Equal("sysbench_qps", result[0].Key)
+	// the increase of the errors is a regression, their decrease is not.
+	deltas = core.DiffMetrics(map[string]float64{"sysbench_error_rate": 0.01, "ycsb_errors": 10},
+		map[string]float64{"sysbench_error_rate": 0.02, "ycsb_errors": 5})
+	result = regressions(deltas, 0.1)
+	as.Len(result, 1)
+	as.Equal("sysbench_error_rate", result[0].Key)
+
+	as.True(repository.Webhook{}.Subscribes(EventJobFailed))
+	as.True(repository.Webhook{Events: "bench.saved, job.failed"}.Subscribes(EventJobFailed))
+	as.False(repository.Webhook{Events: EventBenchSaved}.Subscribes(EventJobFailed))
+}
+
+func TestSaveWebhook(t *testing.T) {
+	as := assert.New(t)
+	created := time.Unix(1634479813, 0)
+	storage := &stubWebhookStorage{webhooks: []repository.Webhook{
+		{ID: 1, PID: 1, URL: "http://example.com/a", Secret: "secret", Format: "json", CreatedAt: created},
+	}}
+	router := mux.NewRouter()
+	router.HandleFunc("/project/webhook/{project_id:[0-9]+}", NewProjectServer(nil, nil, storage).SaveWebhook).Methods(http.MethodPost)
+	save := func(pid, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/project/webhook/"+pid, strings.NewReader(body)))
+		return w
+	}
+
+	// the secret hidden by the responses is kept
+	w := save("1", `{"id":1,"url":"http://example.com/b","events":"job.failed"}`)
+	as.Equal(http.StatusOK, w.Code)
+	as.NotContains(w.Body.String(), "secret")
+	as.Equal(repository.Webhook{ID: 1, PID: 1, URL: "http://example.com/b", Events: "job.failed", Secret: "secret", Format: "json", CreatedAt: created},
+		storage.webhooks[0])
+
+	as.Equal(http.StatusOK, save("1", `{"id":1,"url":"http://example.com/b","secret":"rotated"}`).Code)
+	as.Equal("rotated", storage.webhooks[0].Secret)
+	as.Equal(created, storage.webhooks[0].CreatedAt)
+
+	as.Equal(http.StatusNotFound, save("2", `{"id":1,"url":"http://example.com/b"}`).Code)
+	as.Equal(http.StatusNotFound, save("1", `{"id":3,"url":"http://example.com/b"}`).Code)
+}
+
+func TestValidateWebhook(t *testing.T) {
+	as := assert.New(t)
+	webhook := repository.Webhook{URL: "https://hooks.example.com/x", Events: "bench.saved, regression.detected"}
+	as.NoError(validateWebhook(&webhook))
+	as.Equal("bench.saved,regression.detected", webhook.Events)
+	as.Equal("json", webhook.Format)
+
+	as.Error(validateWebhook(&repository.Webhook{URL: "ftp://example.com"}))
+	as.Error(validateWebhook(&repository.Webhook{URL: "http://example.com", Events: "bench.deleted"}))
+	as.Error(validateWebhook(&repository.Webhook{URL: "http://example.com", Format: "teams"}))
+}
@@ -0,0 +1,42 @@
+// Copyright 2021 TiKV Project Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package version
+
+import (
+	"runtime"
+)
+
+// These are set by the linker, e.g. -ldflags "-X github.com/bufferflies/pd-analyze/version.Version=v1.0.0".
+var (
+	Version   = "None"
+	GitHash   = "None"
+	BuildTime = "None"
+)
+
+// Info is the build info of the binary.
+type Info struct {
+	Version   string `json:"version"`
+	GitHash   string `json:"git_hash"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func GetInfo() Info {
+	return Info{
+		Version:   Version,
+		GitHash:   GitHash,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}